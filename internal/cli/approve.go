@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// promptApproval decides approvals of local runs: every one is approved
+// with --approve, otherwise the terminal is asked. Prompts take turns since
+// they share stdin.
+func promptApproval(auto bool) func(r *structures.RunInfo, name string, a structures.Approval) {
+	var mu sync.Mutex
+	in := bufio.NewReader(os.Stdin)
+	approver := os.Getenv("USER")
+	if approver == "" {
+		approver = "cli"
+	}
+
+	return func(r *structures.RunInfo, name string, a structures.Approval) {
+		d := structures.ApprovalDecision{Approve: true, Approver: approver, Comment: "approved with --approve"}
+		if !auto {
+			mu.Lock()
+			defer mu.Unlock()
+			d = ask(in, approver, name, a)
+		}
+		// Whoever runs the pipeline locally decides, whatever its approvers.
+		d.Force = true
+		if _, err := r.Status.Decide(name, d); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: approval of %s: %v\n", name, err)
+		}
+	}
+}
+
+func ask(in *bufio.Reader, approver string, name string, a structures.Approval) structures.ApprovalDecision {
+	if a.Plan != "" {
+		fmt.Println(strings.TrimRight(a.Plan, "\n"))
+	}
+	what := name
+	if a.Summary != "" {
+		what = fmt.Sprintf("%s (%s)", name, a.Summary)
+	}
+	fmt.Printf("Approve %s? [y/N] ", what)
+
+	line, err := in.ReadString('\n')
+	switch answer := strings.ToLower(strings.TrimSpace(line)); {
+	case answer == "y" || answer == "yes":
+		return structures.ApprovalDecision{Approve: true, Approver: approver}
+	case err == io.EOF && answer == "":
+		return structures.ApprovalDecision{Approver: approver, Comment: "no answer on stdin"}
+	default:
+		return structures.ApprovalDecision{Approver: approver, Comment: "rejected on the terminal"}
+	}
+}
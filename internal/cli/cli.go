@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// paramFlags collects repeated --param k=v flags.
+type paramFlags map[string]string
+
+func (p paramFlags) String() string {
+	pairs := make([]string, 0, len(p))
+	for k, v := range p {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (p paramFlags) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("parameter must be key=value, got %q", s)
+	}
+	p[k] = v
+	return nil
+}
+
+// parseArgs parses fs allowing flags before and after positional arguments,
+// so `flume run deploy --param env=prod` works like it reads.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// pipelinePath accepts either a path to a pipeline file or the name of a
+// pipeline under .flume.
+func pipelinePath(ref string) string {
+	if info, err := os.Stat(ref); err == nil && !info.IsDir() {
+		return ref
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(ref, "local://"), ".yaml")
+	return filepath.Join(".", ".flume", name, name+".yaml")
+}
+
+func loadPipeline(ref string) (*structures.Pipeline, string, error) {
+	path := pipelinePath(ref)
+	p, err := structures.Initialize(path)
+	if err != nil {
+		return nil, path, err
+	}
+	return p, path, nil
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// List prints every pipeline under .flume with its trigger.
+func List(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	if _, err := parseArgs(fs, args); err != nil {
+		return 2
+	}
+
+	root := filepath.Join(".", ".flume")
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", root, err)
+		return 1
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, e.Name(), e.Name()+".yaml")); err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PIPELINE\tTRIGGER\tTASKS\tSTATUS")
+	code := 0
+	for _, name := range names {
+		p, err := structures.Initialize(filepath.Join(root, name, name+".yaml"))
+		if err != nil {
+			var verrs structures.ValidationErrors
+			if errors.As(err, &verrs) {
+				err = fmt.Errorf("%d problem(s), see flume validate %s", len(verrs), name)
+			}
+			fmt.Fprintf(w, "%s\t-\t-\tinvalid: %v\n", name, err)
+			code = 1
+			continue
+		}
+		trigger := p.Trigger.Type
+		if trigger == "" {
+			trigger = "api"
+		}
+		if !p.Trigger.IsEnabled() {
+			trigger += " (disabled)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\tok\n", name, trigger, len(p.Tasks))
+	}
+	w.Flush()
+	return code
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/AlexSTJO/flume/internal/history"
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/fatih/color"
+)
+
+// Logs prints the JSONL log of a run, formatted like the live console output.
+func Logs(args []string) int {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	raw := fs.Bool("raw", false, "print the raw JSONL lines")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(pos) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: flume logs <run-id> [--raw]")
+		return 2
+	}
+
+	path, err := findLog(pos[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening log: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for sc.Scan() {
+		if *raw {
+			fmt.Println(sc.Text())
+			continue
+		}
+		var line logging.LogLine
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			fmt.Println(sc.Text())
+			continue
+		}
+		printLogLine(line)
+	}
+	if err := sc.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading log: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// findLog looks the run up in the history store and falls back to scanning
+// the temp directory for runs that were never recorded.
+func findLog(runID string) (string, error) {
+	if store, err := history.Open(); err == nil {
+		if rec, err := store.Get(runID); err == nil && rec.LogPath != "" {
+			if _, err := os.Stat(rec.LogPath); err == nil {
+				return rec.LogPath, nil
+			}
+			return "", fmt.Errorf("log for run %s no longer exists at %s", runID, rec.LogPath)
+		}
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(os.TempDir(), "flume-run-"+runID+"*", "logs", runID+".jsonl"))
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no log found for run %s", runID)
+	}
+	return matches[0], nil
+}
+
+func printLogLine(line logging.LogLine) {
+	text := fmt.Sprintf("%s  %-8s  %s", line.TS, line.Level, line.Msg)
+	if len(text) > 0 && text[len(text)-1] != '\n' {
+		text += "\n"
+	}
+	switch line.Level {
+	case "ERROR":
+		color.New(color.FgRed).Print(text)
+	case "SUCCESS":
+		color.New(color.FgGreen).Print(text)
+	case "SHELL":
+		color.New(color.FgCyan).Print(text)
+	case "WARN":
+		color.New(color.FgYellow).Print(text)
+	default:
+		fmt.Print(text)
+	}
+}
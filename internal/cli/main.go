@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AlexSTJO/flume/internal/server"
+)
+
+const usage = `usage: flume <command> [arguments]
+
+commands:
+  serve                                   start the API server, cron and file watcher (default)
+  run <pipeline> [--param k=v ...]        run a pipeline locally and wait for it to finish
+  plan <pipeline> [--param k=v ...]       print the execution plan without running anything
+  validate <file>                         check a pipeline file for errors
+  graph <file> [--dot]                    print the task dependency graph
+  list                                    list pipelines under .flume
+  logs <run-id> [--raw]                   print the log of a run
+  secrets <keygen|set|rm|list>            manage the encrypted secrets file
+
+<pipeline> is a pipeline name under .flume or a path to a pipeline file.`
+
+// Main dispatches a CLI invocation and returns the process exit code.
+func Main(args []string) int {
+	if len(args) == 0 {
+		return Serve()
+	}
+
+	switch args[0] {
+	case "serve":
+		return Serve()
+	case "run":
+		return Run(args[1:])
+	case "plan":
+		return Plan(args[1:])
+	case "validate":
+		return Validate(args[1:])
+	case "graph":
+		return Graph(args[1:])
+	case "list":
+		return List(args[1:])
+	case "logs":
+		return Logs(args[1:])
+	case "secrets":
+		return Secrets(args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", args[0], usage)
+		return 2
+	}
+}
+
+func Serve() int {
+	if err := server.CreateServer(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting server: %v\n", err)
+		return 1
+	}
+	return 0
+}
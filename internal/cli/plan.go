@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AlexSTJO/flume/internal/engine"
+	"github.com/fatih/color"
+)
+
+// Plan prints the execution plan of a pipeline without running it.
+func Plan(args []string) int {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	params := paramFlags{}
+	fs.Var(params, "param", "runtime parameter as key=value (repeatable)")
+	asJSON := fs.Bool("json", false, "print the plan as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(pos) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: flume plan <pipeline> [--param k=v ...] [--json]")
+		return 2
+	}
+
+	p, _, err := loadPipeline(pos[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Pipeline Initalization Failure: %v\n", err)
+		return 1
+	}
+
+	plan, err := engine.BuildPlan(p, params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Plan Failure: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(plan)
+	} else {
+		printPlan(plan)
+	}
+
+	if len(plan.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printPlan(plan *engine.Plan) {
+	label := color.New(color.FgGreen, color.Bold).SprintFunc()
+	value := color.New(color.FgCyan).SprintFunc()
+	warn := color.New(color.FgYellow).SprintFunc()
+
+	fmt.Printf("%s %s\n", label("Flume:"), value(plan.Pipeline))
+	fmt.Printf("%s %s, max_parallel %d\n", label("Policy:"), value(plan.OnFailure), plan.MaxParallel)
+
+	for _, d := range plan.Infrastructure {
+		fmt.Printf("%s %s (%s %s) %s\n", label("Infra:"), d.Name, d.Service, d.Action, d.Repo)
+		if d.WorkingDir != "" {
+			fmt.Printf("      working_dir: %s\n", d.WorkingDir)
+		}
+		if d.Workspace != "" {
+			fmt.Printf("      workspace: %s\n", d.Workspace)
+		}
+		if d.Stack != "" {
+			fmt.Printf("      stack: %s\n", d.Stack)
+		}
+		if len(d.Targets) > 0 {
+			fmt.Printf("      targets: %s\n", strings.Join(d.Targets, ", "))
+		}
+		if len(d.Dependencies) > 0 {
+			fmt.Printf("      dependencies: %s\n", strings.Join(d.Dependencies, ", "))
+		}
+	}
+
+	for i, level := range plan.Levels {
+		fmt.Printf("%s %d\n", label("Level"), i+1)
+		for _, t := range level {
+			decision := t.Decision
+			if decision != engine.PlanRun {
+				decision = warn(decision)
+			}
+			service := t.Service
+			if t.Deployment {
+				service += " deployment"
+			}
+			fmt.Printf("  %s [%s] %s", value(t.Name), service, decision)
+			if t.Reason != "" {
+				fmt.Printf(" - %s", t.Reason)
+			}
+			fmt.Println()
+			for k, v := range t.Parameters {
+				fmt.Printf("      %s: %v\n", k, v)
+			}
+			if len(t.Unresolved) > 0 {
+				fmt.Printf("      %s %s\n", warn("resolved at runtime:"), strings.Join(t.Unresolved, ", "))
+			}
+		}
+	}
+
+	for _, e := range plan.Errors {
+		fmt.Printf("%s %s\n", color.RedString("Error:"), e)
+	}
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/AlexSTJO/flume/internal/engine"
+	"github.com/AlexSTJO/flume/internal/history"
+	"github.com/AlexSTJO/flume/internal/structures"
+	"github.com/joho/godotenv"
+)
+
+// Run executes a pipeline in-process. The exit code is 0 when the run
+// succeeds, 1 when it fails and 130 when it is interrupted.
+func Run(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	params := paramFlags{}
+	fs.Var(params, "param", "runtime parameter as key=value (repeatable)")
+	dryRun := fs.Bool("dry-run", false, "print the execution plan instead of running")
+	approve := fs.Bool("approve", false, "approve every approval gate without asking")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(pos) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: flume run <pipeline> [--param k=v ...] [--dry-run] [--approve]")
+		return 2
+	}
+
+	if *dryRun {
+		return Plan(append([]string{pos[0]}, params.args()...))
+	}
+
+	_ = godotenv.Load()
+	if err := engine.ConfigureLimitsFromEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Limits Config Failure: %v\n", err)
+		return 1
+	}
+
+	p, path, err := loadPipeline(pos[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Pipeline Initalization Failure: %v\n", err)
+		return 1
+	}
+
+	// Runs are recorded under the file's base name, like pipelines started
+	// through the API by name.
+	r, err := structures.GenerateRunInfo(filepath.Base(path), params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error Generating Run Info: %v\n", err)
+		return 1
+	}
+	r.Trigger = "cli"
+
+	e, err := engine.Build(p, r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Engine Build Failure: %v\n", err)
+		return 1
+	}
+
+	store, err := history.Open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: run history disabled: %v\n", err)
+	}
+
+	c, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var children sync.WaitGroup
+	structures.Launch = launchLocal(c, store, &children)
+	structures.OnApproval = promptApproval(*approve)
+
+	save(store, r)
+	err = e.Start(c)
+	save(store, r)
+
+	// Pipelines started without waiting still finish before the CLI exits.
+	children.Wait()
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return 130
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Run %s failed: %v\n", r.RunID, err)
+		return 1
+	}
+	return 0
+}
+
+func save(store history.Store, r *structures.RunInfo) {
+	if store == nil {
+		return
+	}
+	if err := store.Save(r.Summary()); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: saving run history: %v\n", err)
+	}
+}
+
+// launchLocal runs pipelines started by trigger_pipeline in this process.
+// They are cancelled along with c.
+func launchLocal(c context.Context, store history.Store, children *sync.WaitGroup) structures.Launcher {
+	return func(req structures.LaunchRequest) (*structures.RunInfo, context.CancelFunc, error) {
+		p, path, err := loadPipeline(req.PipelineRef)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain, err := structures.ChildChain(req.Parent, strings.TrimSuffix(filepath.Base(path), ".yaml"))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		r, err := structures.GenerateRunInfo(filepath.Base(path), req.Params)
+		if err != nil {
+			return nil, nil, err
+		}
+		r.Trigger, r.Event, r.Chain = req.Trigger, req.Event, chain
+
+		e, err := engine.Build(p, r)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		run_ctx, cancel := context.WithCancel(c)
+		save(store, r)
+		children.Add(1)
+		go func() {
+			defer children.Done()
+			defer cancel()
+			if err := e.Start(run_ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "Run %s failed: %v\n", r.RunID, err)
+			}
+			save(store, r)
+		}()
+		return r, cancel, nil
+	}
+}
+
+func (p paramFlags) args() []string {
+	out := make([]string, 0, 2*len(p))
+	for k, v := range p {
+		out = append(out, "--param", k+"="+v)
+	}
+	return out
+}
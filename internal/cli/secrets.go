@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/AlexSTJO/flume/internal/secrets"
+	"github.com/joho/godotenv"
+)
+
+const secretsUsage = `usage: flume secrets <command>
+
+commands:
+  keygen               print a new FLUME_MASTER_KEY
+  set <name> [value]   store a secret, reading the value from stdin when omitted
+  rm <name>            delete a secret
+  list                 list secret names`
+
+// Secrets manages the writable secrets store, the encrypted file by default.
+func Secrets(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return 2
+	}
+	_ = godotenv.Load()
+
+	if args[0] == "keygen" {
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating key: %v\n", err)
+			return 1
+		}
+		fmt.Println(key)
+		return 0
+	}
+
+	p, err := secrets.Open("")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	store, ok := p.(secrets.Store)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "secrets provider %q is read-only\n", p.Name())
+		return 1
+	}
+
+	switch {
+	case args[0] == "set" && (len(args) == 2 || len(args) == 3):
+		value := ""
+		if len(args) == 3 {
+			value = args[2]
+		} else {
+			b, err := io.ReadAll(bufio.NewReader(os.Stdin))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading value: %v\n", err)
+				return 1
+			}
+			value = strings.TrimRight(string(b), "\r\n")
+		}
+		err = store.Set(args[1], value)
+	case args[0] == "rm" && len(args) == 2:
+		err = store.Delete(args[1])
+	case args[0] == "list" && len(args) == 1:
+		var names []string
+		names, err = store.List()
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return 2
+	}
+
+	if errors.Is(err, secrets.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "secret %q not found\n", args[1])
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
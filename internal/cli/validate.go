@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// Validate loads a pipeline file and checks that its graph can be scheduled.
+func Validate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(pos) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: flume validate <file>")
+		return 2
+	}
+
+	p, path, err := loadPipeline(pos[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	levels, err := graphLevels(p)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	fmt.Printf("%s: pipeline '%s' is valid (%d tasks, %d levels)\n", path, p.Name, len(p.Tasks), len(levels))
+	return 0
+}
+
+// Graph prints the dependency levels of a pipeline, or Graphviz DOT with --dot.
+func Graph(args []string) int {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	dot := fs.Bool("dot", false, "print the graph in Graphviz DOT format")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(pos) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: flume graph <file> [--dot]")
+		return 2
+	}
+
+	p, path, err := loadPipeline(pos[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	levels, err := graphLevels(p)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	if *dot {
+		fmt.Printf("digraph %q {\n", p.Name)
+		for _, level := range levels {
+			for _, name := range level {
+				fmt.Printf("  %q [label=%q];\n", name, name+"\n"+nodeService(p, name))
+				for _, d := range p.Upstream(name) {
+					fmt.Printf("  %q -> %q;\n", d, name)
+				}
+			}
+		}
+		fmt.Println("}")
+		return 0
+	}
+
+	for i, level := range levels {
+		fmt.Printf("Level %d\n", i+1)
+		for _, name := range level {
+			fmt.Printf("  %s [%s]", name, nodeService(p, name))
+			if deps := p.Upstream(name); len(deps) > 0 {
+				fmt.Printf(" <- %v", deps)
+			}
+			fmt.Println()
+		}
+	}
+	return 0
+}
+
+func graphLevels(p *structures.Pipeline) ([][]string, error) {
+	g, err := structures.BuildGraph(p)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := g.Levels()
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, level := range levels {
+		count += len(level)
+	}
+	if count != g.Size() {
+		return nil, fmt.Errorf("cycle detected: only %d of %d tasks can be scheduled", count, g.Size())
+	}
+	return levels, nil
+}
+
+// nodeService labels a graph node with its service; deployments also show
+// their action.
+func nodeService(p *structures.Pipeline, name string) string {
+	if d, ok := p.Infrastructure[name]; ok {
+		return d.Service + " " + d.Action
+	}
+	return p.Tasks[name].Service
+}
@@ -1,10 +1,10 @@
 package condition
 
 import (
+	"context"
 	"fmt"
-	"regexp"
-	"strings"
 
+	"github.com/AlexSTJO/flume/internal/expr"
 	"github.com/AlexSTJO/flume/internal/resolver"
 	"github.com/AlexSTJO/flume/internal/structures"
 )
@@ -14,71 +14,116 @@ type Result struct {
 	Reason    string
 }
 
-var conditionRE = regexp.MustCompile(`^(.+?)\s*(==|!=)\s*(.+)$`)
+// Evaluate decides whether a task runs. When both run_if and skip_if are set
+// the task runs only if run_if is true and skip_if is false.
+func Evaluate(c context.Context, t structures.Task, ctx *structures.Context, i *map[string]map[string]string, r *structures.RunInfo) (Result, error) {
+	result, _, err := evaluate(t, runtimeEnv{c: c, ctx: ctx, infra: i, r: r})
+	return result, err
+}
+
+// EvaluateStatic evaluates run_if/skip_if with only the values known before a
+// run starts. known is false when the outcome depends on task or infra
+// outputs.
+func EvaluateStatic(t structures.Task, r *structures.RunInfo) (Result, bool, error) {
+	return evaluate(t, staticEnv{r: r})
+}
 
-func Evaluate(t structures.Task, c *structures.Context, i *map[string]map[string]string, r *structures.RunInfo) (Result, error) {
-	var result Result
+func evaluate(t structures.Task, env expr.Env) (Result, bool, error) {
 	if t.RunIf == "" && t.SkipIf == "" {
-		return Result{ShouldRun: true, Reason: ""}, nil
+		return Result{ShouldRun: true, Reason: ""}, true, nil
 	}
+
+	runVal, runKnown := true, true
 	if t.RunIf != "" {
-		boo, err := evaluateCondition(t.RunIf, c, i, r)
+		var err error
+		runVal, runKnown, err = evaluateCondition(t.RunIf, env)
 		if err != nil {
-			return result, err
+			return Result{}, true, fmt.Errorf("run_if: %w", err)
 		}
-		if boo {
-			result.ShouldRun = true
-			result.Reason = "'run_if' condition evaluated to 'true'"
-		} else {
-			result.ShouldRun = false
-			result.Reason = "'run_if' condition evaluated to 'false'"
+		if runKnown && !runVal {
+			return Result{ShouldRun: false, Reason: "'run_if' condition evaluated to 'false'"}, true, nil
 		}
-	} else if t.SkipIf != "" {
-		boo, err := evaluateCondition(t.SkipIf, c, i, r)
+	}
+
+	skipVal, skipKnown := false, true
+	if t.SkipIf != "" {
+		var err error
+		skipVal, skipKnown, err = evaluateCondition(t.SkipIf, env)
 		if err != nil {
-			return result, err
+			return Result{}, true, fmt.Errorf("skip_if: %w", err)
 		}
-		if boo {
-			result.ShouldRun = false
-			result.Reason = "'skip_if' condition evaluated to 'true'"
-		} else {
-			result.ShouldRun = true
-			result.Reason = "'skip_if' condition evaluated to 'false'"
+		if skipKnown && skipVal {
+			return Result{ShouldRun: false, Reason: "'skip_if' condition evaluated to 'true'"}, true, nil
 		}
 	}
-	return result, nil
-}
 
-func evaluateCondition(s string, c *structures.Context, i *map[string]map[string]string, r *structures.RunInfo) (bool, error) {
-	matches := conditionRE.FindStringSubmatch(s)
-	if matches == nil {
-		return false, fmt.Errorf("Invalid format for condition: %s", s)
+	if !runKnown || !skipKnown {
+		return Result{}, false, nil
 	}
 
-	left := strings.TrimSpace(matches[1])
-	resolved_left, err := resolver.ResolveString(left, c, i, r)
-	if err != nil {
-		return false, err
+	if t.RunIf != "" {
+		return Result{ShouldRun: true, Reason: "'run_if' condition evaluated to 'true'"}, true, nil
 	}
+	return Result{ShouldRun: true, Reason: "'skip_if' condition evaluated to 'false'"}, true, nil
+}
 
-	op := strings.TrimSpace(matches[2])
-
-	right := strings.TrimSpace(matches[3])
-	resolved_right, err := resolver.ResolveString(right, c, i, r)
+func evaluateCondition(s string, env expr.Env) (bool, bool, error) {
+	e, err := expr.Parse(s)
 	if err != nil {
-		return false, err
+		return false, true, fmt.Errorf("Invalid condition %q: %w", s, err)
 	}
+	return e.Eval(env)
+}
 
-	if op == "==" {
-		if resolved_left == resolved_right {
-			return true, nil
-		}
-	} else {
-		if resolved_right != resolved_left {
-			return true, nil
-		}
+// runtimeEnv resolves conditions against a run in progress.
+type runtimeEnv struct {
+	c     context.Context
+	ctx   *structures.Context
+	infra *map[string]map[string]string
+	r     *structures.RunInfo
+}
+
+func (e runtimeEnv) Resolve(ref string) (any, bool, error) {
+	v, err := resolver.ResolveValue(e.c, ref, e.ctx, e.infra, e.r)
+	return v, true, err
+}
+
+func (e runtimeEnv) Interpolate(s string) (string, bool, error) {
+	v, err := resolver.ResolveString(e.c, s, e.ctx, e.infra, e.r)
+	return v, true, err
+}
+
+func (e runtimeEnv) Exists(ref string) (bool, bool, error) {
+	found, err := resolver.Exists(e.c, ref, e.ctx, e.infra, e.r)
+	return found, true, err
+}
+
+func (e runtimeEnv) TaskState(task string) (string, bool) {
+	if e.r == nil || e.r.Status == nil {
+		return "", true
 	}
+	state, _ := e.r.Status.TaskState(task)
+	return string(state), true
+}
 
-	return false, nil
+// staticEnv only knows parameters and environment variables.
+type staticEnv struct {
+	r *structures.RunInfo
+}
+
+func (e staticEnv) Resolve(ref string) (any, bool, error) {
+	return e.Interpolate(ref)
+}
+
+func (e staticEnv) Interpolate(s string) (string, bool, error) {
+	v, unresolved, err := resolver.ResolveStaticString(s, e.r)
+	return v, len(unresolved) == 0, err
+}
+
+func (e staticEnv) Exists(ref string) (bool, bool, error) {
+	return resolver.ExistsStatic(ref, e.r)
+}
 
+func (e staticEnv) TaskState(task string) (string, bool) {
+	return "", false
 }
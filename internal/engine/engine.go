@@ -1,8 +1,12 @@
 package engine
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,22 +23,51 @@ type Engine struct {
 	RunInfo        *structures.RunInfo
 	Flume          *structures.Pipeline
 	DisableLogging bool
-	Context        *structures.Context
+	MaxParallel    int
+	limits         *Limits
 }
 
 func Build(p *structures.Pipeline, r *structures.RunInfo) (*Engine, error) {
+	maxParallel := runtime.NumCPU()
+	if p.MaxParallel > 0 {
+		maxParallel = p.MaxParallel
+	}
+
+	limits := currentLimits()
+	for name, t := range p.Tasks {
+		if err := limits.validate(t.Resources); err != nil {
+			return nil, fmt.Errorf("task '%s': %w", name, err)
+		}
+	}
+	for name, d := range p.Infrastructure {
+		if err := limits.validate(d.Resources); err != nil {
+			return nil, fmt.Errorf("deployment '%s': %w", name, err)
+		}
+	}
+
 	e := &Engine{
 		FlumeName:      p.Name,
 		RunInfo:        r,
 		Flume:          p,
 		DisableLogging: p.DisableLogging,
-		Context:        structures.NewContext(),
+		MaxParallel:    maxParallel,
+		limits:         limits,
 	}
 
 	return e, nil
 }
 
-func (e *Engine) Start() error {
+func (e *Engine) Start(c context.Context) (err error) {
+	tasks := make([]string, 0, len(e.Flume.Tasks)+len(e.Flume.Infrastructure))
+	for name := range e.Flume.Tasks {
+		tasks = append(tasks, name)
+	}
+	for name := range e.Flume.Infrastructure {
+		tasks = append(tasks, name)
+	}
+	e.RunInfo.Status.Start(tasks)
+	defer func() { e.RunInfo.Status.Finish(err) }()
+
 	label := color.New(color.FgGreen, color.Bold).SprintFunc()
 	value := color.New(color.FgCyan).SprintFunc()
 	warn := color.New(color.FgYellow).SprintFunc()
@@ -44,44 +77,57 @@ func (e *Engine) Start() error {
 
 	logger := logging.New(e.DisableLogging, e.FlumeName, e.RunInfo.RunID, e.RunInfo.RunDir)
 	defer logger.Close()
+	logger.SetRedactor(e.RunInfo.Secrets)
 	if logger.LogPath != "" {
 		fmt.Printf("%s %s\n", label("Logs:"), value(logger.LogPath))
 	} else {
 		fmt.Printf("%s %s\n", label("Logs:"), warn("No log file specified"))
 	}
 
-	err := godotenv.Load()
+	err = godotenv.Load()
 	if err != nil {
 		logger.ErrorLogger(fmt.Errorf("Error loading .env file"))
 	}
 
-	infra_outputs, err := infra.Deploy(e.Flume.Infrastructure, e.RunInfo, logger)
-	if err != nil {
-		logger.ErrorLogger(err)
-		return err
-	}
+	reporter := newStatusReporter(c, e.Flume.ReportStatus, e.RunInfo, logger)
+	defer func() { reporter.finish(err) }()
+	reporter.running(c)
 
-	ctx := structures.NewContext()
+	if e.RunInfo.Context == nil {
+		e.RunInfo.Context = structures.NewContext()
+	}
+	ctx := e.RunInfo.Context
 
 	logger.InfoLogger("Graphing Runtime")
 	fmt.Println("-------------------")
 	g, err := structures.BuildGraph(e.Flume)
 	if err != nil {
 		logger.ErrorLogger(err)
+		return err
+	}
+
+	if g == nil || g.Size() == 0 {
+		err = fmt.Errorf("Graph is empty")
+		logger.ErrorLogger(err)
+		return err
 	}
 
-	if g == nil || len(g.Nodes) == 0 {
-		logger.ErrorLogger(fmt.Errorf("Graph is empty"))
+	policy := e.Flume.OnFailure
+	if policy == "" {
+		policy = structures.FailFast
 	}
 
-	// Will have to set up maxparallel specification in Config
+	// run_ctx is what tasks see. It is cancelled by the caller or, under the
+	// fail_fast policy, by the first task failure.
+	run_ctx, stop := context.WithCancel(c)
+	defer stop()
 
 	in := make(map[string]int, len(g.InDeg))
 	for n, v := range g.InDeg {
 		in[n] = v
 	}
 
-	ready := make(chan string, len(g.Nodes))
+	ready := make(chan string, g.Size())
 	var wg sync.WaitGroup
 
 	for n, v := range in {
@@ -94,12 +140,32 @@ func (e *Engine) Start() error {
 		mu        sync.Mutex
 		completed int
 		closeOnce sync.Once
+		halted    bool
+		failed    []string
+		blocked   = make(map[string]bool, g.Size())
+
+		// deployed holds the outputs of deployments as they finish. Each
+		// node reads a copy so deployments running meanwhile don't race it.
+		deployed = make(map[string]map[string]string, len(g.Deployments))
 	)
 
-	markDone := func(u string) {
+	infraSnapshot := func() *map[string]map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		snapshot := make(map[string]map[string]string, len(deployed))
+		for k, v := range deployed {
+			snapshot[k] = v
+		}
+		return &snapshot
+	}
+
+	markDone := func(u string, ok bool) {
 		for _, v := range g.Adj[u] {
 			mu.Lock()
 			in[v]--
+			if !ok {
+				blocked[v] = true
+			}
 			if in[v] == 0 {
 				ready <- v
 			}
@@ -107,39 +173,131 @@ func (e *Engine) Start() error {
 		}
 	}
 
+	// finish records the final state of u and releases its dependents. Only
+	// succeeded, skipped and allowed failures let dependents run.
+	finish := func(u string, ok bool) {
+		markDone(u, ok)
+
+		mu.Lock()
+		completed++
+		done := completed == g.Size()
+		mu.Unlock()
+
+		if done {
+			closeOnce.Do(func() { close(ready) })
+		}
+	}
+
+	fail := func(u string) {
+		mu.Lock()
+		failed = append(failed, u)
+		if policy != structures.ContinueOnError {
+			halted = true
+		}
+		mu.Unlock()
+
+		if policy == structures.FailFast {
+			stop()
+		}
+	}
+
 	worker := func() {
 		defer wg.Done()
 		for name := range ready {
 			logger.InfoLogger(fmt.Sprintf("Worker recieved task: %s", name))
 			task := g.Nodes[name]
 
-			result, err := condition.Evaluate(task, ctx, infra_outputs, e.RunInfo)
+			mu.Lock()
+			is_blocked, is_halted := blocked[name], halted
+			mu.Unlock()
+
+			if is_blocked {
+				logger.WarnLogger(fmt.Sprintf("Not running task '%s': an upstream task did not succeed", name))
+				e.RunInfo.Status.TaskFinished(name, structures.TaskUpstreamFailed, nil)
+				ctx.SetEventValues(name, map[string]string{
+					"success": "false",
+					"status":  string(structures.TaskUpstreamFailed),
+				})
+				finish(name, false)
+				continue
+			}
+
+			// Queued tasks still drain through the workers after a cancel or
+			// a halting failure so every task ends up with a final state.
+			if run_ctx.Err() != nil || is_halted {
+				logger.WarnLogger(fmt.Sprintf("Run stopped, not starting task '%s'", name))
+				e.RunInfo.Status.TaskFinished(name, structures.TaskCancelled, nil)
+				finish(name, false)
+				continue
+			}
+
+			if d, ok := g.Deployments[name]; ok {
+				resources := e.limits.deploymentResources(d)
+				if len(resources) > 0 {
+					logger.InfoLogger(fmt.Sprintf("Deployment '%s' waiting for resources: %s", name, strings.Join(resources, ", ")))
+				}
+				release, err := e.limits.acquire(run_ctx, resources)
+				if err != nil {
+					logger.WarnLogger(fmt.Sprintf("Deployment '%s' cancelled while waiting for a slot", name))
+					e.RunInfo.Status.TaskFinished(name, structures.TaskCancelled, nil)
+					finish(name, false)
+					continue
+				}
+				slot := &taskSlot{release: release}
+
+				e.RunInfo.Status.TaskStarted(name)
+				logger.InfoLogger(fmt.Sprintf("Deploying '%s' (%s %s)", name, d.Service, d.Action))
+				outputs, err := infra.Run(structures.WithSlotRelease(run_ctx, slot.Release), name, d, ctx, infraSnapshot(), e.RunInfo, logger)
+				slot.Release()
+				switch {
+				case err != nil && run_ctx.Err() != nil:
+					e.RunInfo.Status.TaskFinished(name, structures.TaskCancelled, nil)
+					logger.WarnLogger(fmt.Sprintf("Deployment '%s' cancelled", name))
+					finish(name, false)
+				case err != nil:
+					e.RunInfo.Status.TaskFinished(name, structures.TaskFailed, err)
+					logger.ErrorLogger(fmt.Errorf("Deployment '%s' failed: %w", name, err))
+					fail(name)
+					finish(name, false)
+				default:
+					mu.Lock()
+					deployed[name] = outputs
+					mu.Unlock()
+					e.RunInfo.Status.TaskFinished(name, structures.TaskSucceeded, nil)
+					finish(name, true)
+				}
+				continue
+			}
+			infra_outputs := infraSnapshot()
+
+			// Conditions are parsed when the pipeline loads, so an error here
+			// comes from the values they refer to and fails the task.
+			result, err := condition.Evaluate(run_ctx, task, ctx, infra_outputs, e.RunInfo)
 			if err != nil {
-				logger.WarnLogger(fmt.Sprintf("Condition evaluation failed for '%s': %v, running anyway", name, err))
+				err = fmt.Errorf("Condition evaluation failed for '%s': %w", name, err)
+				e.RunInfo.Status.TaskFinished(name, structures.TaskFailed, err)
+				if task.AllowFailure {
+					e.RunInfo.Status.TaskAllowedFailure(name)
+					logger.WarnLogger(fmt.Sprintf("%v, task allows failure", err))
+					finish(name, true)
+					continue
+				}
+				logger.ErrorLogger(err)
+				fail(name)
+				finish(name, false)
+				continue
 			}
 			if !result.ShouldRun {
 				logger.InfoLogger(fmt.Sprintf("Skipping task '%s'. Reason: %s", name, result.Reason))
+				e.RunInfo.Status.TaskFinished(name, structures.TaskSkipped, nil)
 				ctx.SetEventValues(name, map[string]string{
 					"success":     "skipped",
 					"skipped":     "true",
 					"skip_reason": result.Reason,
 				})
-				markDone(name)
-
-				mu.Lock()
-				completed++
-				done := completed == len(g.Nodes)
-				mu.Unlock()
-
-				if done {
-					closeOnce.Do(func() { close(ready) })
-				}
+				finish(name, true)
 				continue
 			}
-			svc, ok := structures.Registry[task.Service]
-			if !ok {
-				logger.ErrorLogger(fmt.Errorf("Unrecognized service"))
-			}
 
 			maxAttempts := 1
 			if task.Retry.MaxAttempts > 0 {
@@ -159,30 +317,69 @@ func (e *Engine) Start() error {
 				}
 			}
 
+			if len(task.Resources) > 0 {
+				logger.InfoLogger(fmt.Sprintf("Task '%s' waiting for resources: %s", name, strings.Join(task.Resources, ", ")))
+			}
+			release, err := e.limits.acquire(run_ctx, task.Resources)
+			if err != nil {
+				logger.WarnLogger(fmt.Sprintf("Task '%s' cancelled while waiting for a slot", name))
+				e.RunInfo.Status.TaskFinished(name, structures.TaskCancelled, nil)
+				finish(name, false)
+				continue
+			}
+			slot := &taskSlot{release: release}
+
+			e.RunInfo.Status.TaskStarted(name)
 			var lastErr error
+			svc, ok := structures.Registry[task.Service]
+			if !ok || svc == nil {
+				lastErr = fmt.Errorf("Unrecognized service: %s", task.Service)
+				maxAttempts = 0
+			}
 			for attempt := 1; attempt <= maxAttempts; attempt++ {
+				e.RunInfo.Status.TaskAttempt(name, attempt)
 				if attempt > 1 {
 					logger.WarnLogger(fmt.Sprintf("Retrying task '%s' (attempt %d/%d) after %v", name, attempt, maxAttempts, delay))
-					time.Sleep(delay)
+					select {
+					case <-time.After(delay):
+					case <-run_ctx.Done():
+					}
+					if run_ctx.Err() != nil {
+						break
+					}
+					if !slot.held() {
+						release, err := e.limits.acquire(run_ctx, task.Resources)
+						if err != nil {
+							lastErr = err
+							break
+						}
+						slot.hold(release)
+					}
 				}
 
+				attempt_ctx, cancel := structures.WithSlotRelease(run_ctx, slot.Release), context.CancelFunc(func() {})
 				if timeout > 0 {
-					done := make(chan error, 1)
-					go func() {
-						done <- svc.Run(task, name, ctx, infra_outputs, logger, e.RunInfo)
-					}()
-
-					select {
-					case lastErr = <-done:
-					case <-time.After(timeout):
-						lastErr = fmt.Errorf("task '%s' timed out after %v", name, timeout)
-						logger.WarnLogger(fmt.Sprintf("Task '%s' timed out after %v", name, timeout))
-					}
-				} else {
-					lastErr = svc.Run(task, name, ctx, infra_outputs, logger, e.RunInfo)
+					attempt_ctx, cancel = context.WithTimeout(attempt_ctx, timeout)
+				}
+				// Services that ignore their context would hold the worker
+				// past the timeout or a cancel, so the attempt is abandoned
+				// as soon as attempt_ctx is done.
+				done := make(chan error, 1)
+				go func() {
+					done <- svc.Run(attempt_ctx, task, name, ctx, infra_outputs, logger, e.RunInfo)
+				}()
+				select {
+				case lastErr = <-done:
+				case <-attempt_ctx.Done():
+					lastErr = attempt_ctx.Err()
 				}
+				if run_ctx.Err() == nil && errors.Is(attempt_ctx.Err(), context.DeadlineExceeded) {
+					lastErr = fmt.Errorf("task '%s' timed out after %v", name, timeout)
+					logger.WarnLogger(fmt.Sprintf("Task '%s' timed out after %v", name, timeout))
+				}
+				cancel()
 
-				if lastErr == nil {
+				if lastErr == nil || run_ctx.Err() != nil {
 					break
 				}
 
@@ -190,36 +387,53 @@ func (e *Engine) Start() error {
 					logger.WarnLogger(fmt.Sprintf("Task '%s' failed (attempt %d/%d): %v", name, attempt, maxAttempts, lastErr))
 				}
 			}
-
-			if lastErr != nil {
-				close(ready)
-				logger.ErrorLogger(lastErr)
+			slot.Release()
+
+			switch {
+			case lastErr != nil && run_ctx.Err() != nil:
+				e.RunInfo.Status.TaskFinished(name, structures.TaskCancelled, nil)
+				logger.WarnLogger(fmt.Sprintf("Task '%s' cancelled", name))
+				finish(name, false)
+			case lastErr != nil && task.AllowFailure:
+				e.RunInfo.Status.TaskFinished(name, structures.TaskFailed, lastErr)
+				e.RunInfo.Status.TaskAllowedFailure(name)
+				logger.WarnLogger(fmt.Sprintf("Task '%s' failed but allows failure: %v", name, lastErr))
+				finish(name, true)
+			case lastErr != nil:
+				e.RunInfo.Status.TaskFinished(name, structures.TaskFailed, lastErr)
+				logger.ErrorLogger(fmt.Errorf("Task '%s' failed: %w", name, lastErr))
+				fail(name)
+				finish(name, false)
+			default:
+				e.RunInfo.Status.TaskFinished(name, structures.TaskSucceeded, nil)
+				finish(name, true)
 			}
-			markDone(name)
-
-			mu.Lock()
-			completed++
-			done := completed == len(g.Nodes)
-			mu.Unlock()
-
-			if done {
-				closeOnce.Do(func() { close(ready) })
-			}
-
 		}
 	}
 
-	maxParallel := runtime.NumCPU()
-
-	wg.Add(maxParallel)
-	for i := 0; i < maxParallel; i++ {
+	wg.Add(e.MaxParallel)
+	for i := 0; i < e.MaxParallel; i++ {
 		go worker()
 	}
 
 	wg.Wait()
 
-	if completed != len(g.Nodes) {
-		logger.ErrorLogger(fmt.Errorf("cycle detected: only completed %d of %d tasks", completed, len(g.Nodes)))
+	if completed != g.Size() {
+		err = fmt.Errorf("cycle detected: only completed %d of %d tasks", completed, g.Size())
+		logger.ErrorLogger(err)
+		return err
+	}
+
+	if c.Err() != nil {
+		logger.WarnLogger("Flume Cancelled")
+		return c.Err()
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		err = fmt.Errorf("%d task(s) failed: %s", len(failed), strings.Join(failed, ", "))
+		logger.ErrorLogger(fmt.Errorf("Flume Failed: %w", err))
+		return err
 	}
 
 	logger.SuccessLogger("Flume Completed")
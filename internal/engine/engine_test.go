@@ -0,0 +1,265 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// testService runs tasks whose progress the test controls. It closes the
+// gate named by its started parameter, blocks until the gate named by its
+// wait parameter is closed or the task is cancelled, and then fails with its
+// error parameter when it is set. Its block parameter names a gate it waits
+// on while ignoring cancellation, like a service that never checks c.
+type testService struct{}
+
+func (testService) Name() string {
+	return "test"
+}
+
+func (testService) Parameters() []structures.ParamSpec {
+	return nil
+}
+
+func (testService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+	if name, ok := t.Parameters["started"].(string); ok {
+		close(gate(name))
+	}
+	if name, ok := t.Parameters["wait"].(string); ok {
+		select {
+		case <-gate(name):
+		case <-c.Done():
+			return c.Err()
+		}
+	}
+	if name, ok := t.Parameters["block"].(string); ok {
+		<-gate(name)
+	}
+	if msg, ok := t.Parameters["error"].(string); ok {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+var (
+	gatesMu sync.Mutex
+	gates   = map[string]chan struct{}{}
+)
+
+// gate returns the channel named name, creating it on first use.
+func gate(name string) chan struct{} {
+	gatesMu.Lock()
+	defer gatesMu.Unlock()
+	if gates[name] == nil {
+		gates[name] = make(chan struct{})
+	}
+	return gates[name]
+}
+
+// resetGates forgets every gate, so each test starts with open ones.
+func resetGates() {
+	gatesMu.Lock()
+	defer gatesMu.Unlock()
+	gates = map[string]chan struct{}{}
+}
+
+func init() {
+	structures.Registry["test"] = testService{}
+}
+
+func newTestRun(pipeline string) *structures.RunInfo {
+	secrets := logging.NewRedactor()
+	ctx := structures.NewContext()
+	ctx.SetRedactor(secrets)
+	status := structures.NewRunStatus()
+	status.SetRedactor(secrets)
+	return &structures.RunInfo{
+		RunID:     "test-run",
+		StartedAt: time.Now().UTC(),
+		Pipeline:  pipeline,
+		Params:    map[string]string{},
+		Status:    status,
+		Context:   ctx,
+		Secrets:   secrets,
+	}
+}
+
+func testTask(params map[string]any, deps ...string) structures.Task {
+	return structures.Task{Service: "test", Parameters: params, Dependencies: deps}
+}
+
+func runPipeline(t *testing.T, p *structures.Pipeline, r *structures.RunInfo) error {
+	t.Helper()
+	p.DisableLogging = true
+	if p.MaxParallel == 0 {
+		p.MaxParallel = 4
+	}
+	e, err := Build(p, r)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return e.Start(c)
+}
+
+func TestFailurePolicies(t *testing.T) {
+	// a fails once b is running; c waits on a and d on b. b only finishes
+	// when released, which the test does once a has failed, or when it is
+	// cancelled.
+	tasks := map[string]structures.Task{
+		"a": testTask(map[string]any{"wait": "b_started", "error": "boom"}),
+		"b": testTask(map[string]any{"started": "b_started", "wait": "release_b"}),
+		"c": testTask(nil, "a"),
+		"d": testTask(nil, "b"),
+	}
+	tests := []struct {
+		policy  string
+		release bool
+		want    map[string]structures.TaskState
+	}{
+		{
+			policy: structures.FailFast,
+			want: map[string]structures.TaskState{
+				"a": structures.TaskFailed,
+				"b": structures.TaskCancelled,
+				"c": structures.TaskUpstreamFailed,
+				"d": structures.TaskUpstreamFailed,
+			},
+		},
+		{
+			policy:  structures.FinishRunning,
+			release: true,
+			want: map[string]structures.TaskState{
+				"a": structures.TaskFailed,
+				"b": structures.TaskSucceeded,
+				"c": structures.TaskUpstreamFailed,
+				"d": structures.TaskCancelled,
+			},
+		},
+		{
+			policy:  structures.ContinueOnError,
+			release: true,
+			want: map[string]structures.TaskState{
+				"a": structures.TaskFailed,
+				"b": structures.TaskSucceeded,
+				"c": structures.TaskUpstreamFailed,
+				"d": structures.TaskSucceeded,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			resetGates()
+			r := newTestRun("policies")
+			if tt.release {
+				go func() {
+					waitForTask(r, "a", structures.TaskFailed)
+					close(gate("release_b"))
+				}()
+			}
+			err := runPipeline(t, &structures.Pipeline{Name: "policies", OnFailure: tt.policy, MaxParallel: 2, Tasks: tasks}, r)
+			if err == nil {
+				t.Fatal("expected the run to fail")
+			}
+			summary := r.Summary()
+			if summary.State != structures.RunFailed {
+				t.Errorf("run state = %s, want %s", summary.State, structures.RunFailed)
+			}
+			for name, want := range tt.want {
+				if got := summary.Tasks[name].State; got != want {
+					t.Errorf("task %s = %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// waitForTask returns once the task has reached state.
+func waitForTask(r *structures.RunInfo, task string, state structures.TaskState) {
+	for r.Summary().Tasks[task].State != state {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAllowFailure(t *testing.T) {
+	r := newTestRun("allow")
+	err := runPipeline(t, &structures.Pipeline{
+		Name: "allow",
+		Tasks: map[string]structures.Task{
+			"a":       {Service: "test", Parameters: map[string]any{"error": "boom"}, AllowFailure: true},
+			"cleanup": {Service: "test", Dependencies: []string{"a"}, RunIf: "failed(a)"},
+			"deploy":  {Service: "test", Dependencies: []string{"a"}, RunIf: "success(a)"},
+		},
+	}, r)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	summary := r.Summary()
+	if summary.State != structures.RunSucceeded {
+		t.Errorf("run state = %s, want %s", summary.State, structures.RunSucceeded)
+	}
+	if a := summary.Tasks["a"]; a.State != structures.TaskFailed || !a.AllowedFailure {
+		t.Errorf("task a = %s (allowed %v), want an allowed failure", a.State, a.AllowedFailure)
+	}
+	for name, want := range map[string]structures.TaskState{
+		"cleanup": structures.TaskSucceeded,
+		"deploy":  structures.TaskSkipped,
+	} {
+		if got := summary.Tasks[name].State; got != want {
+			t.Errorf("task %s = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestTimeoutWithServiceIgnoringContext(t *testing.T) {
+	resetGates()
+	t.Cleanup(func() { close(gate("never")) })
+
+	r := newTestRun("timeout")
+	a := testTask(map[string]any{"block": "never"})
+	a.Timeout = "20ms"
+	err := runPipeline(t, &structures.Pipeline{
+		Name: "timeout",
+		Tasks: map[string]structures.Task{
+			"a": a,
+			"b": testTask(nil, "a"),
+		},
+	}, r)
+	if err == nil {
+		t.Fatal("expected the run to fail")
+	}
+
+	tasks := r.Summary().Tasks
+	if got := tasks["a"]; got.State != structures.TaskFailed || got.Error != "task 'a' timed out after 20ms" {
+		t.Errorf("task a = %s (%q), want failed with a timeout", got.State, got.Error)
+	}
+	if got := tasks["b"].State; got != structures.TaskUpstreamFailed {
+		t.Errorf("task b = %s, want %s", got, structures.TaskUpstreamFailed)
+	}
+}
+
+func TestTaskErrorsAreRedacted(t *testing.T) {
+	r := newTestRun("redact")
+	r.Secrets.Add("hunter2-token")
+	err := runPipeline(t, &structures.Pipeline{
+		Name: "redact",
+		Tasks: map[string]structures.Task{
+			"a": testTask(map[string]any{"error": "POST https://hooks.example/hunter2-token: 404"}),
+		},
+	}, r)
+	if err == nil {
+		t.Fatal("expected the run to fail")
+	}
+	got := r.Summary().Tasks["a"].Error
+	if want := fmt.Sprintf("POST https://hooks.example/%s: 404", logging.Mask); got != want {
+		t.Errorf("task error = %q, want %q", got, want)
+	}
+}
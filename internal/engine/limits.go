@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// semaphore is a counting semaphore. A nil semaphore never blocks.
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+func (s semaphore) acquire(c context.Context) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+func (s semaphore) release() {
+	if s == nil {
+		return
+	}
+	<-s
+}
+
+// Limits are shared by every engine in the process so concurrent runs compete
+// for the same task slots and resource pools.
+type Limits struct {
+	global semaphore
+	pools  map[string]semaphore
+}
+
+var (
+	limitsMu sync.RWMutex
+	limits   = &Limits{pools: map[string]semaphore{}}
+)
+
+// ConfigureLimits sets the process-wide cap on concurrently running tasks
+// (0 means unlimited) and the size of each named resource pool.
+func ConfigureLimits(maxWorkers int, pools map[string]int) {
+	l := &Limits{
+		global: newSemaphore(maxWorkers),
+		pools:  make(map[string]semaphore, len(pools)),
+	}
+	for name, size := range pools {
+		l.pools[name] = newSemaphore(size)
+	}
+
+	limitsMu.Lock()
+	limits = l
+	limitsMu.Unlock()
+}
+
+// ConfigureLimitsFromEnv reads FLUME_MAX_WORKERS and FLUME_RESOURCE_POOLS,
+// e.g. FLUME_RESOURCE_POOLS="docker=2,terraform=1".
+func ConfigureLimitsFromEnv() error {
+	maxWorkers := 0
+	if v := strings.TrimSpace(os.Getenv("FLUME_MAX_WORKERS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("FLUME_MAX_WORKERS must be a non-negative integer, got %q", v)
+		}
+		maxWorkers = n
+	}
+
+	pools := map[string]int{}
+	if v := strings.TrimSpace(os.Getenv("FLUME_RESOURCE_POOLS")); v != "" {
+		for _, entry := range strings.Split(v, ",") {
+			name, size, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok {
+				return fmt.Errorf("invalid resource pool %q, expected name=size", entry)
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(size))
+			if err != nil || n <= 0 {
+				return fmt.Errorf("resource pool %q must have a positive size", name)
+			}
+			pools[strings.TrimSpace(name)] = n
+		}
+	}
+
+	ConfigureLimits(maxWorkers, pools)
+	return nil
+}
+
+func currentLimits() *Limits {
+	limitsMu.RLock()
+	defer limitsMu.RUnlock()
+	return limits
+}
+
+// deploymentResources are the pools a deployment holds a slot in: the ones it
+// lists, and the pool named after its service when one is configured, so
+// FLUME_RESOURCE_POOLS="terraform=1" serializes terraform deployments.
+func (l *Limits) deploymentResources(d structures.Deployment) []string {
+	resources := d.Resources
+	if _, ok := l.pools[d.Service]; ok && !slices.Contains(resources, d.Service) {
+		resources = append(slices.Clone(resources), d.Service)
+	}
+	return resources
+}
+
+func (l *Limits) validate(resources []string) error {
+	for _, r := range resources {
+		if _, ok := l.pools[r]; !ok {
+			return fmt.Errorf("unknown resource pool %q", r)
+		}
+	}
+	return nil
+}
+
+// taskSlot is what a running task holds from the limits. A task waiting on
+// something outside the run gives it back early through
+// structures.ReleaseSlot, and takes a new one when it is retried.
+type taskSlot struct {
+	mu      sync.Mutex
+	release func()
+}
+
+func (s *taskSlot) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.release != nil {
+		s.release()
+		s.release = nil
+	}
+}
+
+func (s *taskSlot) held() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.release != nil
+}
+
+func (s *taskSlot) hold(release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.release = release
+}
+
+// acquire takes a slot in every pool the task lists and then a global slot.
+// Pools are always taken in name order so two tasks can't deadlock each other.
+// The returned func releases everything that was acquired.
+func (l *Limits) acquire(c context.Context, resources []string) (func(), error) {
+	names := append([]string(nil), resources...)
+	sort.Strings(names)
+
+	held := []semaphore{}
+	release := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].release()
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		s := l.pools[name]
+		if err := s.acquire(c); err != nil {
+			release()
+			return nil, err
+		}
+		held = append(held, s)
+	}
+
+	if err := l.global.acquire(c); err != nil {
+		release()
+		return nil, err
+	}
+	held = append(held, l.global)
+
+	return release, nil
+}
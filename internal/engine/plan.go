@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+
+	"github.com/AlexSTJO/flume/internal/condition"
+	"github.com/AlexSTJO/flume/internal/resolver"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// Plan is what a run would do, computed without invoking any service or
+// infrastructure provider.
+type Plan struct {
+	Pipeline       string              `json:"pipeline"`
+	OnFailure      string              `json:"on_failure"`
+	MaxParallel    int                 `json:"max_parallel"`
+	Parameters     map[string]string   `json:"parameters,omitempty"`
+	Infrastructure []PlannedDeployment `json:"infrastructure,omitempty"`
+	Levels         [][]PlannedTask     `json:"levels"`
+	Errors         []string            `json:"errors,omitempty"`
+}
+
+type PlannedDeployment struct {
+	Name         string   `json:"name"`
+	Service      string   `json:"service"`
+	Action       string   `json:"action"`
+	Repo         string   `json:"repo"`
+	WorkingDir   string   `json:"working_dir,omitempty"`
+	Workspace    string   `json:"workspace,omitempty"`
+	Stack        string   `json:"stack,omitempty"`
+	Targets      []string `json:"targets,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+type PlannedTask struct {
+	Name         string         `json:"name"`
+	Service      string         `json:"service"`
+	Deployment   bool           `json:"deployment,omitempty"`
+	Dependencies []string       `json:"dependencies,omitempty"`
+	Decision     string         `json:"decision"`
+	Reason       string         `json:"reason,omitempty"`
+	Parameters   map[string]any `json:"parameters,omitempty"`
+	Unresolved   []string       `json:"unresolved,omitempty"`
+	Resources    []string       `json:"resources,omitempty"`
+	Timeout      string         `json:"timeout,omitempty"`
+	AllowFailure bool           `json:"allow_failure,omitempty"`
+}
+
+// Plan decisions. "conditional" means the task's condition depends on outputs
+// that only exist once the run is underway.
+const (
+	PlanRun         = "run"
+	PlanSkip        = "skip"
+	PlanConditional = "conditional"
+)
+
+const secretMask = "********"
+
+func BuildPlan(p *structures.Pipeline, params map[string]string) (*Plan, error) {
+	g, err := structures.BuildGraph(p)
+	if err != nil {
+		return nil, err
+	}
+
+	levels, err := g.Levels()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &structures.RunInfo{Pipeline: p.Name, Params: params}
+	if r.Params == nil {
+		r.Params = map[string]string{}
+	}
+
+	plan := &Plan{
+		Pipeline:    p.Name,
+		OnFailure:   p.OnFailure,
+		MaxParallel: p.MaxParallel,
+		Parameters:  r.Params,
+		Levels:      make([][]PlannedTask, 0, len(levels)),
+	}
+	if plan.OnFailure == "" {
+		plan.OnFailure = structures.FailFast
+	}
+	if plan.MaxParallel <= 0 {
+		plan.MaxParallel = runtime.NumCPU()
+	}
+
+	names := make([]string, 0, len(p.Infrastructure))
+	for name := range p.Infrastructure {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		d := p.Infrastructure[name]
+		if ws, _, err := resolver.MaskStaticString(d.Workspace, r, secretMask); err == nil {
+			d.Workspace = ws
+		}
+		if d.Stack == "" && (d.Service == structures.ServicePulumi || d.Service == structures.ServiceCloudFormation) {
+			d.Stack = name
+		}
+		if stack, _, err := resolver.MaskStaticString(d.Stack, r, secretMask); err == nil {
+			d.Stack = stack
+		}
+		plan.Infrastructure = append(plan.Infrastructure, PlannedDeployment{
+			Name:         name,
+			Service:      d.Service,
+			Action:       d.Action,
+			Repo:         d.Repo,
+			WorkingDir:   d.WorkingDir,
+			Workspace:    d.Workspace,
+			Stack:        d.Stack,
+			Targets:      d.Targets,
+			Dependencies: p.Upstream(name),
+		})
+	}
+
+	planned := 0
+	for _, level := range levels {
+		tasks := make([]PlannedTask, 0, len(level))
+		for _, name := range level {
+			if d, ok := g.Deployments[name]; ok {
+				tasks = append(tasks, PlannedTask{
+					Name:         name,
+					Service:      d.Service,
+					Deployment:   true,
+					Dependencies: p.Upstream(name),
+					Decision:     PlanRun,
+					Resources:    currentLimits().deploymentResources(d),
+				})
+				continue
+			}
+			pt := planTask(name, g.Nodes[name], r, plan)
+			pt.Dependencies = p.Upstream(name)
+			tasks = append(tasks, pt)
+		}
+		planned += len(tasks)
+		plan.Levels = append(plan.Levels, tasks)
+	}
+
+	if planned != g.Size() {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("cycle detected: only planned %d of %d tasks", planned, g.Size()))
+	}
+
+	return plan, nil
+}
+
+func planTask(name string, t structures.Task, r *structures.RunInfo, plan *Plan) PlannedTask {
+	pt := PlannedTask{
+		Name:         name,
+		Service:      t.Service,
+		Dependencies: t.Dependencies,
+		Decision:     PlanRun,
+		Resources:    t.Resources,
+		Timeout:      t.Timeout,
+		AllowFailure: t.AllowFailure,
+	}
+
+	result, known, err := condition.EvaluateStatic(t, r)
+	switch {
+	case err != nil:
+		plan.Errors = append(plan.Errors, fmt.Sprintf("task '%s': condition: %v", name, err))
+		pt.Decision = PlanConditional
+		pt.Reason = err.Error()
+	case !known:
+		pt.Decision = PlanConditional
+		pt.Reason = "condition depends on runtime outputs"
+	case !result.ShouldRun:
+		pt.Decision = PlanSkip
+		pt.Reason = result.Reason
+	default:
+		pt.Reason = result.Reason
+	}
+
+	resolved, unresolved, err := resolver.MaskStaticAny(t.Parameters, r, secretMask)
+	if err != nil {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("task '%s': parameters: %v", name, err))
+		resolved = t.Parameters
+	}
+	if m, ok := resolved.(map[string]any); ok {
+		pt.Parameters = make(map[string]any, len(m))
+		for k, v := range m {
+			pt.Parameters[k] = v
+		}
+	}
+	pt.Unresolved = unresolved
+
+	// Secrets are masked even when they are plain literals in the file.
+	if svc, ok := structures.Registry[t.Service]; ok {
+		for _, spec := range svc.Parameters() {
+			if _, set := pt.Parameters[spec.Name]; set && spec.Secret {
+				pt.Parameters[spec.Name] = secretMask
+			}
+		}
+	}
+
+	return pt
+}
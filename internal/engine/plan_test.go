@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+func TestPlanMasksEnvironment(t *testing.T) {
+	t.Setenv("FLUME_TEST_TOKEN", "hunter2")
+	t.Setenv("FLUME_TEST_STAGE", "prod")
+
+	p := &structures.Pipeline{
+		Name: "web",
+		Tasks: map[string]structures.Task{
+			"deploy": {
+				Service: "test",
+				RunIf:   `${env:FLUME_TEST_STAGE} == "prod"`,
+				Parameters: map[string]any{
+					"auth":    "Bearer ${env:FLUME_TEST_TOKEN}",
+					"version": "${param:version}",
+					"url":     "${context:build.url}",
+				},
+			},
+		},
+	}
+	plan, err := BuildPlan(p, map[string]string{"version": "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Errors) > 0 {
+		t.Fatalf("plan errors: %v", plan.Errors)
+	}
+
+	got := plan.Levels[0][0]
+	if got.Decision != PlanRun {
+		t.Errorf("decision = %q, want %q", got.Decision, PlanRun)
+	}
+	want := map[string]any{
+		"auth":    "Bearer " + secretMask,
+		"version": "v1",
+		"url":     "${context:build.url}",
+	}
+	if !reflect.DeepEqual(got.Parameters, want) {
+		t.Errorf("parameters = %v, want %v", got.Parameters, want)
+	}
+	if !reflect.DeepEqual(got.Unresolved, []string{"${context:build.url}"}) {
+		t.Errorf("unresolved = %v", got.Unresolved)
+	}
+}
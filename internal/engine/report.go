@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	githubapp "github.com/AlexSTJO/flume/internal/github"
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/resolver"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// statusReporter mirrors a run as a GitHub check run on the commit named by
+// the pipeline's report_status block. Reporting problems are logged as
+// warnings and never fail the run.
+type statusReporter struct {
+	owner  string
+	repo   string
+	id     int64
+	logger *logging.Config
+	r      *structures.RunInfo
+}
+
+// newStatusReporter resolves the report_status block and creates the check
+// run as queued. It returns nil when the pipeline does not report status or
+// the check run could not be created.
+func newStatusReporter(c context.Context, spec *structures.StatusReport, r *structures.RunInfo, logger *logging.Config) *statusReporter {
+	if spec == nil {
+		return nil
+	}
+
+	resolve := func(s string) (string, error) {
+		return resolver.ResolveString(c, s, r.Context, nil, r)
+	}
+	full, err := resolve(spec.Repo)
+	if err != nil {
+		logger.WarnLogger(fmt.Sprintf("Not reporting status: repo: %v", err))
+		return nil
+	}
+	sha, err := resolve(spec.SHA)
+	if err != nil {
+		logger.WarnLogger(fmt.Sprintf("Not reporting status: sha: %v", err))
+		return nil
+	}
+	owner, repo, ok := strings.Cut(full, "/")
+	if !ok || owner == "" || repo == "" || sha == "" {
+		logger.WarnLogger(fmt.Sprintf("Not reporting status: expected repo as owner/name and a sha, got '%s' and '%s'", full, sha))
+		return nil
+	}
+
+	name := spec.Name
+	if name == "" {
+		name = "flume/" + r.Pipeline
+	}
+	if name, err = resolve(name); err != nil {
+		logger.WarnLogger(fmt.Sprintf("Not reporting status: name: %v", err))
+		return nil
+	}
+	details, err := resolve(spec.DetailsURL)
+	if err != nil {
+		logger.WarnLogger(fmt.Sprintf("Not reporting status: details_url: %v", err))
+		return nil
+	}
+	if details == "" {
+		if base := strings.TrimSpace(os.Getenv("FLUME_PUBLIC_URL")); base != "" {
+			details = fmt.Sprintf("%s/runs/%s/logs", strings.TrimSuffix(base, "/"), r.RunID)
+		}
+	}
+
+	id, err := githubapp.CreateCheckRun(c, owner, repo, githubapp.CheckRun{
+		Name:       name,
+		HeadSHA:    sha,
+		Status:     "queued",
+		ExternalID: r.RunID,
+		DetailsURL: details,
+	})
+	if err != nil {
+		logger.WarnLogger(fmt.Sprintf("Not reporting status: creating check run: %v", err))
+		return nil
+	}
+	logger.InfoLogger(fmt.Sprintf("Reporting status to %s@%s as '%s'", full, sha, name))
+
+	return &statusReporter{owner: owner, repo: repo, id: id, logger: logger, r: r}
+}
+
+func (s *statusReporter) running(c context.Context) {
+	if s == nil {
+		return
+	}
+	now := time.Now().UTC()
+	s.update(c, githubapp.CheckRun{Status: "in_progress", StartedAt: &now})
+}
+
+// finish completes the check run. It runs before RunStatus.Finish, so the
+// conclusion is worked out from the run error the same way.
+func (s *statusReporter) finish(err error) {
+	if s == nil {
+		return
+	}
+	summary := s.r.Summary()
+
+	conclusion := "success"
+	switch {
+	case errors.Is(err, context.Canceled):
+		conclusion = "cancelled"
+	case err != nil:
+		conclusion = "failure"
+	default:
+		for _, t := range summary.Tasks {
+			if t.State == structures.TaskFailed && !t.AllowedFailure {
+				conclusion = "failure"
+			}
+		}
+	}
+
+	title := fmt.Sprintf("%s %s", s.r.Pipeline, conclusion)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		title = fmt.Sprintf("%s failed: %v", s.r.Pipeline, err)
+	}
+
+	// The run context may already be cancelled, so the final update gets
+	// its own deadline.
+	c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	now := time.Now().UTC()
+	s.update(c, githubapp.CheckRun{
+		Status:      "completed",
+		Conclusion:  conclusion,
+		CompletedAt: &now,
+		Output: &githubapp.CheckOutput{
+			Title:   s.r.Secrets.Redact(title),
+			Summary: s.r.Secrets.Redact(taskTable(summary.Tasks)),
+		},
+	})
+}
+
+func (s *statusReporter) update(c context.Context, run githubapp.CheckRun) {
+	if err := githubapp.UpdateCheckRun(c, s.owner, s.repo, s.id, run); err != nil {
+		s.logger.WarnLogger(fmt.Sprintf("Updating check run to %s failed: %v", run.Status, err))
+	}
+}
+
+// taskTable renders the per-task summary shown on the check run.
+func taskTable(tasks map[string]structures.TaskStatus) string {
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("| Task | State | Duration | Error |\n|------|-------|----------|-------|\n")
+	for _, name := range names {
+		t := tasks[name]
+		state := string(t.State)
+		if t.AllowedFailure {
+			state += " (allowed)"
+		}
+		duration := ""
+		if t.DurationMS > 0 {
+			duration = (time.Duration(t.DurationMS) * time.Millisecond).String()
+		}
+		msg := strings.ReplaceAll(strings.ReplaceAll(t.Error, "\n", " "), "|", "\\|")
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", name, state, duration, msg)
+	}
+	return b.String()
+}
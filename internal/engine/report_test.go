@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	githubapp "github.com/AlexSTJO/flume/internal/github"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// checksServer is a stand-in for the GitHub API that records every check
+// run request.
+type checksServer struct {
+	mu       sync.Mutex
+	requests []checkRequest
+}
+
+type checkRequest struct {
+	Method string
+	Path   string
+	Run    githubapp.CheckRun
+}
+
+func (s *checksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/repos/octo/app/installation":
+		w.Write([]byte(`{"id": 42}`))
+	case r.Method == "POST" && r.URL.Path == "/app/installations/42/access_tokens":
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token": "installation-token"}`))
+	case strings.HasPrefix(r.URL.Path, "/repos/octo/app/check-runs"):
+		if r.Header.Get("Authorization") != "Bearer installation-token" {
+			http.Error(w, "bad token", http.StatusUnauthorized)
+			return
+		}
+		var run githubapp.CheckRun
+		if err := json.NewDecoder(r.Body).Decode(&run); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, checkRequest{Method: r.Method, Path: r.URL.Path, Run: run})
+		s.mu.Unlock()
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusCreated)
+		}
+		w.Write([]byte(`{"id": 7}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// setupGitHubApp points the GitHub App client at a stand-in server with a
+// freshly generated key.
+func setupGitHubApp(t *testing.T, h http.Handler) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "app.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyPath, pemBytes, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	t.Setenv("GITHUB_API_URL", srv.URL)
+	t.Setenv("GITHUB_APP_ID", "1")
+	t.Setenv("GITHUB_APP_PRIVATE_KEY_PATH", keyPath)
+	t.Setenv("FLUME_PUBLIC_URL", "https://flume.example")
+}
+
+func TestStatusReport(t *testing.T) {
+	checks := &checksServer{}
+	setupGitHubApp(t, checks)
+
+	r := newTestRun("web")
+	r.Secrets.Add("hunter2-token")
+	err := runPipeline(t, &structures.Pipeline{
+		Name:         "web",
+		ReportStatus: &structures.StatusReport{Repo: "octo/app", SHA: "abc123"},
+		Tasks: map[string]structures.Task{
+			"build": testTask(nil),
+			"lint": {
+				Service:      "test",
+				Parameters:   map[string]any{"error": "lint failed with hunter2-token"},
+				AllowFailure: true,
+			},
+		},
+	}, r)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	checks.mu.Lock()
+	defer checks.mu.Unlock()
+	if len(checks.requests) != 3 {
+		t.Fatalf("got %d check run requests, want 3: %+v", len(checks.requests), checks.requests)
+	}
+
+	created := checks.requests[0]
+	if created.Method != "POST" || created.Path != "/repos/octo/app/check-runs" {
+		t.Errorf("first request = %s %s, want POST /repos/octo/app/check-runs", created.Method, created.Path)
+	}
+	if created.Run.Status != "queued" || created.Run.Name != "flume/web" || created.Run.HeadSHA != "abc123" || created.Run.ExternalID != r.RunID {
+		t.Errorf("created check run = %+v", created.Run)
+	}
+	if want := "https://flume.example/runs/" + r.RunID + "/logs"; created.Run.DetailsURL != want {
+		t.Errorf("details_url = %q, want %q", created.Run.DetailsURL, want)
+	}
+
+	for i, want := range []string{"in_progress", "completed"} {
+		req := checks.requests[i+1]
+		if req.Method != "PATCH" || req.Path != "/repos/octo/app/check-runs/7" {
+			t.Errorf("update %d = %s %s, want PATCH /repos/octo/app/check-runs/7", i, req.Method, req.Path)
+		}
+		if req.Run.Status != want {
+			t.Errorf("update %d status = %q, want %q", i, req.Run.Status, want)
+		}
+	}
+
+	completed := checks.requests[2].Run
+	if completed.Conclusion != "success" || completed.CompletedAt == nil {
+		t.Errorf("completed check run = %+v, want a success with completed_at", completed)
+	}
+	if completed.Output == nil {
+		t.Fatal("completed check run has no output")
+	}
+	summary := completed.Output.Summary
+	for _, row := range []string{"| build | succeeded |", "| lint | failed (allowed) |"} {
+		if !strings.Contains(summary, row) {
+			t.Errorf("summary is missing %q:\n%s", row, summary)
+		}
+	}
+	if strings.Contains(summary, "hunter2-token") {
+		t.Errorf("summary leaks a secret:\n%s", summary)
+	}
+}
@@ -0,0 +1,294 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Env supplies the values a condition refers to. known is false when a value
+// isn't available yet, e.g. task outputs while planning a run; the result is
+// then unknown unless && or || can short-circuit around it.
+type Env interface {
+	// Resolve returns the value of a single ${...} placeholder.
+	Resolve(ref string) (v any, known bool, err error)
+	// Interpolate resolves every placeholder in s into a string.
+	Interpolate(s string) (v string, known bool, err error)
+	// Exists reports whether a placeholder has a value.
+	Exists(ref string) (found bool, known bool, err error)
+	// TaskState returns the state of a task in the current run.
+	TaskState(task string) (state string, known bool)
+}
+
+// Eval evaluates the condition to a boolean.
+func (e *Expr) Eval(env Env) (bool, bool, error) {
+	v, known, err := eval(e.root, env)
+	if err != nil || !known {
+		return false, known, err
+	}
+	b, err := truthy(v)
+	return b, true, err
+}
+
+func eval(n node, env Env) (any, bool, error) {
+	switch t := n.(type) {
+	case literalNode:
+		return t.value, true, nil
+
+	case placeholderNode:
+		return env.Resolve(t.ref)
+
+	case templateNode:
+		return env.Interpolate(t.text)
+
+	case listNode:
+		out := make([]any, 0, len(t.items))
+		for _, item := range t.items {
+			v, known, err := eval(item, env)
+			if err != nil || !known {
+				return nil, known, err
+			}
+			out = append(out, v)
+		}
+		return out, true, nil
+
+	case notNode:
+		v, known, err := eval(t.operand, env)
+		if err != nil || !known {
+			return nil, known, err
+		}
+		b, err := truthy(v)
+		return !b, true, err
+
+	case logicalNode:
+		return evalLogical(t, env)
+
+	case compareNode:
+		left, lknown, err := eval(t.left, env)
+		if err != nil {
+			return nil, true, err
+		}
+		right, rknown, err := eval(t.right, env)
+		if err != nil {
+			return nil, true, err
+		}
+		if !lknown || !rknown {
+			return nil, false, nil
+		}
+		return compare(t, left, right)
+
+	case callNode:
+		return evalCall(t, env)
+	}
+	return nil, true, fmt.Errorf("unsupported expression %T", n)
+}
+
+func evalLogical(t logicalNode, env Env) (any, bool, error) {
+	left, lknown, err := eval(t.left, env)
+	if err != nil {
+		return nil, true, err
+	}
+	var lb bool
+	if lknown {
+		if lb, err = truthy(left); err != nil {
+			return nil, true, err
+		}
+		if t.op == "&&" && !lb {
+			return false, true, nil
+		}
+		if t.op == "||" && lb {
+			return true, true, nil
+		}
+	}
+
+	right, rknown, err := eval(t.right, env)
+	if err != nil {
+		return nil, true, err
+	}
+	if !rknown {
+		return nil, false, nil
+	}
+	rb, err := truthy(right)
+	if err != nil {
+		return nil, true, err
+	}
+	if !lknown {
+		// The unknown side only matters if the known side doesn't decide it.
+		if (t.op == "&&" && !rb) || (t.op == "||" && rb) {
+			return rb, true, nil
+		}
+		return nil, false, nil
+	}
+	return rb, true, nil
+}
+
+func evalCall(t callNode, env Env) (any, bool, error) {
+	if t.name == "exists" {
+		return env.Exists(t.arg.(placeholderNode).ref)
+	}
+
+	task := fmt.Sprint(t.arg.(literalNode).value)
+	state, known := env.TaskState(task)
+	if !known {
+		return nil, false, nil
+	}
+	switch t.name {
+	case "success":
+		return state == "succeeded", true, nil
+	case "failed":
+		return state == "failed", true, nil
+	case "skipped":
+		return state == "skipped", true, nil
+	}
+	return nil, true, fmt.Errorf("unknown function '%s'", t.name)
+}
+
+func compare(t compareNode, left, right any) (any, bool, error) {
+	switch t.op {
+	case "==":
+		return equal(left, right), true, nil
+	case "!=":
+		return !equal(left, right), true, nil
+
+	case "<", "<=", ">", ">=":
+		l, lok := toNumber(left)
+		r, rok := toNumber(right)
+		if !lok || !rok {
+			return nil, true, fmt.Errorf("'%s' needs numbers, got %q and %q", t.op, format(left), format(right))
+		}
+		switch t.op {
+		case "<":
+			return l < r, true, nil
+		case "<=":
+			return l <= r, true, nil
+		case ">":
+			return l > r, true, nil
+		default:
+			return l >= r, true, nil
+		}
+
+	case "in":
+		return contains(right, left), true, nil
+	case "contains":
+		return contains(left, right), true, nil
+
+	case "matches":
+		re := t.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(format(right)); err != nil {
+				return nil, true, fmt.Errorf("invalid regular expression %q: %v", format(right), err)
+			}
+		}
+		return re.MatchString(format(left)), true, nil
+	}
+	return nil, true, fmt.Errorf("unknown operator '%s'", t.op)
+}
+
+// contains reports whether item is an element of a list, a key of a map, or a
+// substring of a string.
+func contains(collection, item any) bool {
+	switch c := collection.(type) {
+	case []any:
+		for _, v := range c {
+			if equal(v, item) {
+				return true
+			}
+		}
+		return false
+	case []string:
+		for _, v := range c {
+			if equal(v, item) {
+				return true
+			}
+		}
+		return false
+	case map[string]any:
+		_, ok := c[format(item)]
+		return ok
+	case map[string]string:
+		_, ok := c[format(item)]
+		return ok
+	default:
+		return strings.Contains(format(collection), format(item))
+	}
+}
+
+// equal compares loosely, since most values reach a condition as strings:
+// "3" equals 3 and "true" equals true.
+func equal(a, b any) bool {
+	if an, ok := toNumber(a); ok {
+		if bn, ok := toNumber(b); ok {
+			return an == bn
+		}
+	}
+	if ab, ok := a.(bool); ok {
+		if bb, err := truthy(b); err == nil {
+			return ab == bb
+		}
+	}
+	if bb, ok := b.(bool); ok {
+		if ab, err := truthy(a); err == nil {
+			return ab == bb
+		}
+	}
+	return format(a) == format(b)
+}
+
+func truthy(v any) (bool, error) {
+	switch t := v.(type) {
+	case bool:
+		return t, nil
+	case nil:
+		return false, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(t)) {
+		case "true":
+			return true, nil
+		case "false", "":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("expected a boolean, got %q", format(v))
+}
+
+func toNumber(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case json.Number:
+		n, err := t.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func format(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case bool:
+		return strconv.FormatBool(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(t)
+	case []any, []string, map[string]any, map[string]string:
+		b, err := json.Marshal(t)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
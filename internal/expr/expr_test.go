@@ -0,0 +1,191 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testEnv resolves placeholders from values. References missing from values
+// are unknown, as task outputs are while planning.
+type testEnv struct {
+	values map[string]any
+	states map[string]string
+}
+
+func (e testEnv) Resolve(ref string) (any, bool, error) {
+	v, ok := e.values[ref]
+	return v, ok, nil
+}
+
+func (e testEnv) Interpolate(s string) (string, bool, error) {
+	for ref, v := range e.values {
+		s = strings.ReplaceAll(s, ref, fmt.Sprint(v))
+	}
+	return s, !strings.Contains(s, "${"), nil
+}
+
+func (e testEnv) Exists(ref string) (bool, bool, error) {
+	v, ok := e.values[ref]
+	return ok && v != nil, ok, nil
+}
+
+func (e testEnv) TaskState(task string) (string, bool) {
+	state, ok := e.states[task]
+	return state, ok
+}
+
+var env = testEnv{
+	values: map[string]any{
+		"${param:env}":              "production",
+		"${param:count}":            "3",
+		"${param:flag}":             "true",
+		"${param:version}":          nil,
+		"${context:api.json.items}": []any{"a", "b"},
+		"${context:api.json.meta}":  map[string]any{"region": "eu-west-1"},
+		"${context:api.json.total}": json.Number("42"),
+		"${param:region}":           "eu-west-1",
+		"${param:pattern}":          "(",
+	},
+	states: map[string]string{
+		"build": "succeeded",
+		"test":  "failed",
+		"lint":  "skipped",
+	},
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr  string
+		want  bool
+		known bool
+	}{
+		{"${param:env} == production", true, true},
+		{"${param:env} == 'production'", true, true},
+		{`${param:env} != "staging"`, true, true},
+		{"${param:count} == 3", true, true},
+		{"${param:count} == 3.0", true, true},
+		{"${param:count} > 2 && ${param:count} <= 3", true, true},
+		{"${param:count} < 3", false, true},
+		{"${context:api.json.total} == 42", true, true},
+		{"${context:api.json.total} > 40", true, true},
+		{"${param:flag}", true, true},
+		{"${param:flag} == true", true, true},
+		{"!${param:flag}", false, true},
+		{"!(${param:env} == staging)", true, true},
+		{"${param:env} == staging || ${param:count} >= 3", true, true},
+		{"${param:env} == production && (success(build) || ${param:count} >= 5)", true, true},
+		{"${param:region} in [us-west-1, 'eu-west-1']", true, true},
+		{"${param:region} in []", false, true},
+		{"a in ${context:api.json.items}", true, true},
+		{"${context:api.json.items} contains c", false, true},
+		{"region in ${context:api.json.meta}", true, true},
+		{"west in ${param:region}", true, true},
+		{"${param:region} matches '^eu-'", true, true},
+		{"${param:region} matches '^us-'", false, true},
+		{"'${param:env}-${param:region}' == production-eu-west-1", true, true},
+		{"success(build)", true, true},
+		{"failed(test)", true, true},
+		{"skipped(lint)", true, true},
+		{"success(test)", false, true},
+		{"exists(${param:env})", true, true},
+		{"exists(${param:version})", false, true},
+		{"!exists(${param:version})", true, true},
+
+		// Unknown values leave the result unknown unless && or || can
+		// decide without them.
+		{"${context:build.version} == 2", false, false},
+		{"success(deploy)", false, false},
+		{"${param:env} == staging && ${context:build.version} == 2", false, true},
+		{"${param:env} == production || ${context:build.version} == 2", true, true},
+		{"${context:build.version} == 2 && ${param:env} == staging", false, true},
+		{"${context:build.version} == 2 || ${param:env} == production", true, true},
+		{"${context:build.version} == 2 && ${param:env} == production", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got, known, err := e.Eval(env)
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if known != tt.known || (known && got != tt.want) {
+				t.Errorf("Eval = %v (known %v), want %v (known %v)", got, known, tt.want, tt.known)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"${param:env} > 2", "'>' needs numbers"},
+		{"${param:env}", "expected a boolean"},
+		{"${param:env} matches ${param:pattern}", "invalid regular expression"},
+		{"${param:count} && true", "expected a boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if _, _, err := e.Eval(env); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Eval error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "empty condition"},
+		{"   ", "empty condition"},
+		{"a = b", "did you mean '=='"},
+		{"a & b", "did you mean '&&'"},
+		{"(a == b", "expected ')'"},
+		{"a == b)", "unexpected"},
+		{"a ==", "ends unexpectedly"},
+		{"'open", "unterminated string"},
+		{"${param:env == a", "unterminated placeholder"},
+		{"[a, b", "expected ',' or ']'"},
+		{"unknown(build)", "unknown function 'unknown'"},
+		{"success(build, test)", "takes one argument"},
+		{"success(${param:env})", "takes a task name"},
+		{"exists(build)", "takes a single ${...} reference"},
+		{"a == in", "unexpected"},
+		{"a matches '('", "invalid regular expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTasks(t *testing.T) {
+	e, err := Parse("success(build) && !(failed('test') || skipped(lint)) && exists(${param:env})")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"build", "test", "lint"}
+	if got := e.Tasks(); !slices.Equal(got, want) {
+		t.Errorf("Tasks = %v, want %v", got, want)
+	}
+	if got := e.Calls("failed"); !slices.Equal(got, []string{"test"}) {
+		t.Errorf("Calls(failed) = %v, want [test]", got)
+	}
+}
@@ -0,0 +1,107 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+	tokOp
+	tokWord
+	tokString
+	tokPlaceholder
+	tokTemplate
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of condition"
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+// delimiters end a bare word.
+const delimiters = " \t\r\n()[],!=<>&|\"'"
+
+func lex(s string) ([]token, error) {
+	tokens := []token{}
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokLBracket, "[", i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokRBracket, "]", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i+1)
+			}
+			tokens = append(tokens, token{tokString, s[i+1 : i+1+end], i})
+			i += end + 2
+		case strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"),
+			strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="),
+			strings.HasPrefix(s[i:], "<="), strings.HasPrefix(s[i:], ">="):
+			tokens = append(tokens, token{tokOp, s[i : i+2], i})
+			i += 2
+		case c == '!' || c == '<' || c == '>':
+			tokens = append(tokens, token{tokOp, string(c), i})
+			i++
+		case c == '=' || c == '&' || c == '|':
+			return nil, fmt.Errorf("unexpected '%c' at position %d, did you mean '%c%c'?", c, i+1, c, c)
+		default:
+			start := i
+			placeholders := 0
+			for i < len(s) && !strings.ContainsRune(delimiters, rune(s[i])) {
+				if strings.HasPrefix(s[i:], "${") {
+					end := strings.IndexByte(s[i:], '}')
+					if end < 0 {
+						return nil, fmt.Errorf("unterminated placeholder at position %d", i+1)
+					}
+					placeholders++
+					i += end + 1
+					continue
+				}
+				i++
+			}
+			text := s[start:i]
+			kind := tokWord
+			if placeholders == 1 && strings.HasPrefix(text, "${") && strings.HasSuffix(text, "}") && strings.Count(text, "${") == 1 {
+				kind = tokPlaceholder
+			} else if placeholders > 0 {
+				kind = tokTemplate
+			}
+			tokens = append(tokens, token{kind, text, start})
+		}
+	}
+	tokens = append(tokens, token{tokEOF, "", len(s)})
+	return tokens, nil
+}
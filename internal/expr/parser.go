@@ -0,0 +1,332 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expr is a parsed condition.
+type Expr struct {
+	src  string
+	root node
+}
+
+type node interface{}
+
+type (
+	literalNode struct {
+		value any
+	}
+	placeholderNode struct {
+		ref string
+	}
+	templateNode struct {
+		text string
+	}
+	listNode struct {
+		items []node
+	}
+	notNode struct {
+		operand node
+	}
+	logicalNode struct {
+		op          string
+		left, right node
+	}
+	compareNode struct {
+		op          string
+		left, right node
+		re          *regexp.Regexp // precompiled when the pattern is a literal
+	}
+	callNode struct {
+		name string
+		arg  node
+	}
+)
+
+// functions maps the supported function names to whether their argument is a
+// task name (as opposed to a placeholder).
+var functions = map[string]bool{
+	"success": true,
+	"failed":  true,
+	"skipped": true,
+	"exists":  false,
+}
+
+var keywordOps = map[string]bool{
+	"in":       true,
+	"contains": true,
+	"matches":  true,
+}
+
+// Parse parses a condition such as
+//
+//	${param:env} == prod && (success(build) || ${context:api.json.count} >= 3)
+func Parse(s string) (*Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, fmt.Errorf("empty condition")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos+1)
+	}
+	return &Expr{src: s, root: root}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Tasks returns the task names passed to success(), failed() and skipped().
+func (e *Expr) Tasks() []string {
+	return e.Calls("")
+}
+
+// Calls returns the task names passed to the function fn, or to every task
+// function when fn is empty.
+func (e *Expr) Calls(fn string) []string {
+	names := []string{}
+	var walk func(n node)
+	walk = func(n node) {
+		switch t := n.(type) {
+		case notNode:
+			walk(t.operand)
+		case logicalNode:
+			walk(t.left)
+			walk(t.right)
+		case compareNode:
+			walk(t.left)
+			walk(t.right)
+		case listNode:
+			for _, item := range t.items {
+				walk(item)
+			}
+		case callNode:
+			if functions[t.name] && (fn == "" || t.name == fn) {
+				if lit, ok := t.arg.(literalNode); ok {
+					names = append(names, fmt.Sprint(lit.value))
+				}
+			}
+		}
+	}
+	walk(e.root)
+	return names
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp && !(t.kind == tokWord && keywordOps[t.text]) {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isOp("!") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("==", "!=", "<", "<=", ">", ">=", "in", "contains", "matches") {
+		return left, nil
+	}
+	op := p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := compareNode{op: op.text, left: left, right: right}
+	if op.text == "matches" {
+		if lit, ok := right.(literalNode); ok {
+			pattern, isString := lit.value.(string)
+			if !isString {
+				return nil, fmt.Errorf("'matches' needs a regular expression string at position %d", op.pos+1)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q: %v", pattern, err)
+			}
+			cmp.re = re
+		}
+	}
+	if p.isOp("==", "!=", "<", "<=", ">", ">=", "in", "contains", "matches") {
+		t := p.peek()
+		return nil, fmt.Errorf("comparisons can't be chained, use && at position %d", t.pos+1)
+	}
+	return cmp, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' at position %d, got %s", closing.pos+1, closing)
+		}
+		return inner, nil
+
+	case tokLBracket:
+		list := listNode{}
+		if p.peek().kind == tokRBracket {
+			p.next()
+			return list, nil
+		}
+		for {
+			item, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, item)
+			sep := p.next()
+			if sep.kind == tokRBracket {
+				return list, nil
+			}
+			if sep.kind != tokComma {
+				return nil, fmt.Errorf("expected ',' or ']' at position %d, got %s", sep.pos+1, sep)
+			}
+		}
+
+	case tokString:
+		if strings.Contains(t.text, "${") {
+			return templateNode{text: t.text}, nil
+		}
+		return literalNode{value: t.text}, nil
+
+	case tokPlaceholder:
+		return placeholderNode{ref: t.text}, nil
+
+	case tokTemplate:
+		return templateNode{text: t.text}, nil
+
+	case tokWord:
+		if keywordOps[t.text] {
+			return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos+1)
+		}
+		if p.peek().kind == tokLParen {
+			return p.parseCall(t)
+		}
+		switch t.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		}
+		if strings.ContainsAny(t.text[:1], "0123456789-+.") {
+			if n, err := strconv.ParseFloat(t.text, 64); err == nil {
+				return literalNode{value: n}, nil
+			}
+		}
+		return literalNode{value: t.text}, nil
+	}
+
+	if t.kind == tokEOF {
+		return nil, fmt.Errorf("condition ends unexpectedly")
+	}
+	return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos+1)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	takesTask, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function '%s' at position %d", name.text, name.pos+1)
+	}
+	p.next() // (
+
+	arg := p.next()
+	var n node
+	switch {
+	case takesTask && (arg.kind == tokWord || arg.kind == tokString):
+		n = literalNode{value: arg.text}
+	case !takesTask && arg.kind == tokPlaceholder:
+		n = placeholderNode{ref: arg.text}
+	case takesTask:
+		return nil, fmt.Errorf("%s() takes a task name, got %s", name.text, arg)
+	default:
+		return nil, fmt.Errorf("%s() takes a single ${...} reference, got %s", name.text, arg)
+	}
+
+	if closing := p.next(); closing.kind != tokRParen {
+		return nil, fmt.Errorf("%s() takes one argument, expected ')' at position %d", name.text, closing.pos+1)
+	}
+	return callNode{name: name.text, arg: n}, nil
+}
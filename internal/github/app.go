@@ -57,6 +57,15 @@ func Get() (*App, error) {
 	return instance, initErr
 }
 
+// APIBase is the GitHub REST API root, overridable with GITHUB_API_URL for
+// GitHub Enterprise or a local stand-in server.
+func APIBase() string {
+	if base := strings.TrimSpace(os.Getenv("GITHUB_API_URL")); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	return "https://api.github.com"
+}
+
 func appJWT(app_id string, key *rsa.PrivateKey) (string, error) {
 	now := time.Now()
 	claims := jwt.MapClaims{
@@ -82,7 +91,7 @@ func InstallationTokenForRepo(ctx context.Context, owner, repo string) (string,
 	req, _ := http.NewRequestWithContext(
 		ctx,
 		"GET",
-		fmt.Sprintf("https://api.github.com/repos/%s/%s/installation", owner, repo),
+		fmt.Sprintf("%s/repos/%s/%s/installation", APIBase(), owner, repo),
 		nil,
 	)
 	req.Header.Set("Authorization", "Bearer "+j)
@@ -109,7 +118,7 @@ func InstallationTokenForRepo(ctx context.Context, owner, repo string) (string,
 	req, _ = http.NewRequestWithContext(
 		ctx,
 		"POST",
-		fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", inst.ID),
+		fmt.Sprintf("%s/app/installations/%d/access_tokens", APIBase(), inst.ID),
 		nil,
 	)
 	req.Header.Set("Authorization", "Bearer "+j)
@@ -0,0 +1,78 @@
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// CheckRun is the body of the check runs API. Empty fields are left out so
+// an update only changes what it sets.
+type CheckRun struct {
+	Name        string       `json:"name,omitempty"`
+	HeadSHA     string       `json:"head_sha,omitempty"`
+	Status      string       `json:"status,omitempty"`
+	Conclusion  string       `json:"conclusion,omitempty"`
+	ExternalID  string       `json:"external_id,omitempty"`
+	DetailsURL  string       `json:"details_url,omitempty"`
+	StartedAt   *time.Time   `json:"started_at,omitempty"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+	Output      *CheckOutput `json:"output,omitempty"`
+}
+
+type CheckOutput struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+	Text    string `json:"text,omitempty"`
+}
+
+// CreateCheckRun creates a check run on a commit and returns its ID.
+func CreateCheckRun(ctx context.Context, owner, repo string, run CheckRun) (int64, error) {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	err := checksRequest(ctx, owner, repo, "POST", fmt.Sprintf("/repos/%s/%s/check-runs", owner, repo), run, &created)
+	if err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+func UpdateCheckRun(ctx context.Context, owner, repo string, id int64, run CheckRun) error {
+	return checksRequest(ctx, owner, repo, "PATCH", fmt.Sprintf("/repos/%s/%s/check-runs/%d", owner, repo, id), run, nil)
+}
+
+func checksRequest(ctx context.Context, owner, repo, method, path string, body any, out any) error {
+	token, err := InstallationTokenForRepo(ctx, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, _ := http.NewRequestWithContext(ctx, method, APIBase()+path, bytes.NewReader(b))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("check run %s failed (%d): %s", method, resp.StatusCode, body)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
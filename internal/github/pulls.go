@@ -0,0 +1,63 @@
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// PullRequestFiles lists the paths changed by a pull request, authenticated
+// as the app installation on the repository.
+func PullRequestFiles(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	token, err := InstallationTokenForRepo(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	// GitHub caps this listing at 3000 files.
+	for page := 1; page <= 30; page++ {
+		req, _ := http.NewRequestWithContext(
+			ctx,
+			"GET",
+			fmt.Sprintf("%s/repos/%s/%s/pulls/%d/files?per_page=100&page=%d", APIBase(), owner, repo, number, page),
+			nil,
+		)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("pull request files lookup failed (%d): %s", resp.StatusCode, body)
+		}
+
+		var batch []struct {
+			Filename         string `json:"filename"`
+			PreviousFilename string `json:"previous_filename"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&batch)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range batch {
+			files = append(files, f.Filename)
+			if f.PreviousFilename != "" {
+				files = append(files, f.PreviousFilename)
+			}
+		}
+		if len(batch) < 100 {
+			break
+		}
+	}
+	return files, nil
+}
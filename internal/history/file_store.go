@@ -0,0 +1,111 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// FileStore keeps one JSON document per run in a directory. It needs no
+// external database and survives restarts, which is all a single server needs.
+type FileStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating history dir: %w", err)
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (fs *FileStore) Name() string {
+	return "file"
+}
+
+func (fs *FileStore) Save(rec structures.RunSummary) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling run record: %w", err)
+	}
+
+	path := fs.path(rec.RunID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write tmp: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("rename run record: %w", err)
+	}
+	return nil
+}
+
+func (fs *FileStore) Get(runID string) (*structures.RunSummary, error) {
+	if strings.ContainsAny(runID, `/\`) {
+		return nil, ErrNotFound
+	}
+	rec, err := readRecord(fs.path(runID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return rec, err
+}
+
+func (fs *FileStore) List(f Filter) ([]structures.RunSummary, error) {
+	entries, err := os.ReadDir(fs.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading history dir: %w", err)
+	}
+
+	recs := []structures.RunSummary{}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		rec, err := readRecord(filepath.Join(fs.Dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		if Matches(*rec, f) {
+			recs = append(recs, *rec)
+		}
+	}
+	return recs, nil
+}
+
+func (fs *FileStore) path(runID string) string {
+	return filepath.Join(fs.Dir, runID+".json")
+}
+
+func readRecord(path string) (*structures.RunSummary, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec structures.RunSummary
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func init() {
+	registry["file"] = func(dsn string) (Store, error) {
+		s, err := NewFileStore(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
@@ -0,0 +1,139 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+func record(id string, pipeline string, state structures.RunState, started time.Time) structures.RunSummary {
+	return structures.RunSummary{
+		RunID:     id,
+		Pipeline:  pipeline,
+		State:     state,
+		StartedAt: &started,
+		Tasks:     map[string]structures.TaskStatus{},
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	fs, err := NewFileStore(filepath.Join(t.TempDir(), "history"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, rec := range []structures.RunSummary{
+		record("20260501-a", "web", structures.RunSucceeded, day),
+		record("20260502-b", "web", structures.RunFailed, day.Add(24*time.Hour)),
+		record("20260503-c", "api", structures.RunSucceeded, day.Add(48*time.Hour)),
+	} {
+		if err := fs.Save(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := fs.Get("20260502-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Pipeline != "web" || got.State != structures.RunFailed {
+		t.Errorf("Get = %+v", got)
+	}
+	for _, id := range []string{"missing", "../history/20260502-b"} {
+		if _, err := fs.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrNotFound", id, err)
+		}
+	}
+
+	// A half written record is skipped.
+	if err := os.WriteFile(filepath.Join(fs.Dir, "broken.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all", Filter{}, []string{"20260503-c", "20260502-b", "20260501-a"}},
+		{"pipeline", Filter{Pipeline: "web"}, []string{"20260502-b", "20260501-a"}},
+		{"status", Filter{Status: structures.RunSucceeded}, []string{"20260503-c", "20260501-a"}},
+		{"since", Filter{Since: day.Add(24 * time.Hour)}, []string{"20260503-c", "20260502-b"}},
+		{"combined", Filter{Pipeline: "web", Status: structures.RunSucceeded}, []string{"20260501-a"}},
+		{"none", Filter{Pipeline: "docs"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs, err := fs.List(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for _, rec := range Paginate(recs, 10, 0).Runs {
+				ids = append(ids, rec.RunID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("List = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	recs := func() []structures.RunSummary {
+		return []structures.RunSummary{{RunID: "1"}, {RunID: "3"}, {RunID: "2"}, {RunID: "5"}, {RunID: "4"}}
+	}
+	tests := []struct {
+		limit, offset int
+		want          []string
+		next          int // 0 when there is no next page
+	}{
+		{2, 0, []string{"5", "4"}, 2},
+		{2, 2, []string{"3", "2"}, 4},
+		{2, 4, []string{"1"}, 0},
+		{5, 0, []string{"5", "4", "3", "2", "1"}, 0},
+		{2, 5, []string{}, 0},
+	}
+	for _, tt := range tests {
+		p := Paginate(recs(), tt.limit, tt.offset)
+		ids := []string{}
+		for _, rec := range p.Runs {
+			ids = append(ids, rec.RunID)
+		}
+		if !slices.Equal(ids, tt.want) || p.Total != 5 {
+			t.Errorf("Paginate(%d, %d) = %v of %d, want %v of 5", tt.limit, tt.offset, ids, p.Total, tt.want)
+		}
+		next := 0
+		if p.NextOffset != nil {
+			next = *p.NextOffset
+		}
+		if next != tt.next {
+			t.Errorf("Paginate(%d, %d) next offset = %d, want %d", tt.limit, tt.offset, next, tt.next)
+		}
+	}
+}
+
+func TestOpenFailure(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FLUME_HISTORY_BACKEND", "")
+	t.Setenv("FLUME_HISTORY_DSN", filepath.Join(file, "history"))
+	s, err := Open()
+	if err == nil {
+		t.Fatal("expected opening a store under a file to fail")
+	}
+	if s != nil {
+		t.Errorf("Open returned a non-nil store %#v with its error", s)
+	}
+
+	t.Setenv("FLUME_HISTORY_BACKEND", "postgres")
+	if _, err := Open(); err == nil {
+		t.Error("expected an unknown backend to fail")
+	}
+}
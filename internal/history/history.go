@@ -0,0 +1,94 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+type Store interface {
+	Name() string
+	Save(rec structures.RunSummary) error
+	Get(runID string) (*structures.RunSummary, error)
+	List(f Filter) ([]structures.RunSummary, error)
+}
+
+type Filter struct {
+	Pipeline string
+	Status   structures.RunState
+	Since    time.Time
+}
+
+type Page struct {
+	Runs       []structures.RunSummary `json:"runs"`
+	Total      int                     `json:"total"`
+	Limit      int                     `json:"limit"`
+	Offset     int                     `json:"offset"`
+	NextOffset *int                    `json:"next_offset,omitempty"`
+}
+
+var ErrNotFound = fmt.Errorf("run not found")
+
+var registry = map[string]func(dsn string) (Store, error){}
+
+// Open returns the store configured by FLUME_HISTORY_BACKEND and
+// FLUME_HISTORY_DSN, defaulting to the file store under .flume/.history.
+func Open() (Store, error) {
+	backend := strings.TrimSpace(os.Getenv("FLUME_HISTORY_BACKEND"))
+	if backend == "" {
+		backend = "file"
+	}
+	dsn := strings.TrimSpace(os.Getenv("FLUME_HISTORY_DSN"))
+	if dsn == "" {
+		dsn = filepath.Join(".", ".flume", ".history")
+	}
+
+	open, ok := registry[backend]
+	if !ok {
+		return nil, fmt.Errorf("unknown history backend %q", backend)
+	}
+	return open(dsn)
+}
+
+func Matches(rec structures.RunSummary, f Filter) bool {
+	if f.Pipeline != "" && rec.Pipeline != f.Pipeline {
+		return false
+	}
+	if f.Status != "" && rec.State != f.Status {
+		return false
+	}
+	if !f.Since.IsZero() && (rec.StartedAt == nil || rec.StartedAt.Before(f.Since)) {
+		return false
+	}
+	return true
+}
+
+// Paginate orders runs newest first and slices out the requested window.
+func Paginate(recs []structures.RunSummary, limit, offset int) Page {
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].RunID > recs[j].RunID
+	})
+
+	p := Page{
+		Runs:   []structures.RunSummary{},
+		Total:  len(recs),
+		Limit:  limit,
+		Offset: offset,
+	}
+	if offset >= len(recs) {
+		return p
+	}
+	end := offset + limit
+	if end < len(recs) {
+		p.NextOffset = &end
+	} else {
+		end = len(recs)
+	}
+	p.Runs = recs[offset:end]
+	return p
+}
@@ -0,0 +1,449 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/structures"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/smithy-go"
+)
+
+// cfnPollInterval is how often stack and change set progress is checked.
+const cfnPollInterval = 5 * time.Second
+
+// CloudFormation deploys a stack from a template in the deployment's repo
+// through change sets, so every change can be reviewed before it is made.
+type CloudFormation struct{}
+
+func (cf *CloudFormation) Name() string {
+	return structures.ServiceCloudFormation
+}
+
+func (cf *CloudFormation) Call(c context.Context, n string, d structures.Deployment, r *structures.RunInfo, l *logging.Config) (map[string]string, error) {
+	base := filepath.Join(r.RunDir, "cloudformation", n)
+	dir, err := checkout(c, base, d, l)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsLocal(d.Template) {
+		return nil, fmt.Errorf("template must be a relative path inside the repo: %s", d.Template)
+	}
+	template, err := os.ReadFile(filepath.Join(dir, d.Template))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading template: %w", err)
+	}
+
+	opts := []func(*config.LoadOptions) error{}
+	if d.Region != "" {
+		opts = append(opts, config.WithRegion(d.Region))
+	}
+	cfg, err := config.LoadDefaultConfig(c, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading AWS config: %w", err)
+	}
+	cs := &cfnStack{
+		name:      n,
+		stack:     n,
+		artifacts: base,
+		client:    cloudformation.NewFromConfig(cfg),
+		d:         d,
+		r:         r,
+		l:         l,
+	}
+	if d.Stack != "" {
+		cs.stack = d.Stack
+	}
+	l.InfoLogger(fmt.Sprintf("Using CloudFormation Stack: %s", cs.stack))
+
+	switch d.Action {
+	case structures.ActionPlan, structures.ActionApply, structures.ActionSync:
+		set, err := cs.createChangeSet(c, string(template))
+		if err != nil {
+			return nil, fmt.Errorf("CloudFormation Change Set Failed: %w", err)
+		}
+		if set == nil {
+			l.InfoLogger("CloudFormation Stack Up To Date With Template")
+			break
+		}
+		if d.Action == structures.ActionPlan {
+			l.InfoLogger("CloudFormation Change Set Has Changes. Not Applying (action: plan)")
+			if err := cs.discard(c, set); err != nil {
+				return nil, err
+			}
+			break
+		}
+		l.InfoLogger("Executing CloudFormation Change Set")
+		if err := cs.execute(c, set); err != nil {
+			l.ErrorLogger(fmt.Errorf("Error Applying CloudFormation Deployment"))
+			return nil, err
+		}
+		l.SuccessLogger("Successful CloudFormation Deployment")
+	case structures.ActionDestroy:
+		if err := cs.destroy(c); err != nil {
+			l.ErrorLogger(fmt.Errorf("Error Destroying CloudFormation Deployment"))
+			return nil, err
+		}
+		return map[string]string{}, nil
+	case structures.ActionRefresh:
+		if err := cs.detectDrift(c); err != nil {
+			return nil, fmt.Errorf("CloudFormation Drift Detection Failed: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown Action: %s", d.Action)
+	}
+
+	outputs, err := cs.outputs(c)
+	if err != nil {
+		return nil, fmt.Errorf("Error Reading CloudFormation Outputs: %w", err)
+	}
+	return outputs, nil
+}
+
+// cfnStack deploys one deployment's stack. Change sets are saved to
+// artifacts as plan.txt.
+type cfnStack struct {
+	name      string
+	stack     string
+	artifacts string
+	client    *cloudformation.Client
+	d         structures.Deployment
+	r         *structures.RunInfo
+	l         *logging.Config
+}
+
+// changeSet is a change set that has changes and is ready to execute.
+type changeSet struct {
+	id         string
+	changeType types.ChangeSetType
+}
+
+// describe returns the stack, or nil when it does not exist.
+func (cs *cfnStack) describe(c context.Context) (*types.Stack, error) {
+	out, err := cs.client.DescribeStacks(c, &cloudformation.DescribeStacksInput{StackName: aws.String(cs.stack)})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.ErrorMessage(), "does not exist") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Stacks) == 0 {
+		return nil, nil
+	}
+	return &out.Stacks[0], nil
+}
+
+// createChangeSet creates a change set for the template and saves what it
+// changes. It returns nil when the stack already matches the template.
+func (cs *cfnStack) createChangeSet(c context.Context, template string) (*changeSet, error) {
+	stack, err := cs.describe(c)
+	if err != nil {
+		return nil, err
+	}
+	changeType := types.ChangeSetTypeUpdate
+	if stack == nil || stack.StackStatus == types.StackStatusReviewInProgress {
+		changeType = types.ChangeSetTypeCreate
+	}
+
+	params := []types.Parameter{}
+	for _, k := range sortedKeys(cs.d.Vars) {
+		params = append(params, types.Parameter{ParameterKey: aws.String(k), ParameterValue: aws.String(cs.d.Vars[k])})
+	}
+	capabilities := []types.Capability{}
+	for _, capability := range cs.d.Capabilities {
+		capabilities = append(capabilities, types.Capability(capability))
+	}
+	created, err := cs.client.CreateChangeSet(c, &cloudformation.CreateChangeSetInput{
+		StackName:     aws.String(cs.stack),
+		ChangeSetName: aws.String("flume-" + strings.ReplaceAll(cs.r.RunID, "_", "-")),
+		ChangeSetType: changeType,
+		TemplateBody:  aws.String(template),
+		Parameters:    params,
+		Capabilities:  capabilities,
+	})
+	if err != nil {
+		return nil, err
+	}
+	set := &changeSet{id: aws.ToString(created.Id), changeType: changeType}
+
+	var described *cloudformation.DescribeChangeSetOutput
+	for {
+		described, err = cs.client.DescribeChangeSet(c, &cloudformation.DescribeChangeSetInput{ChangeSetName: aws.String(set.id)})
+		if err != nil {
+			return nil, err
+		}
+		if described.Status != types.ChangeSetStatusCreatePending && described.Status != types.ChangeSetStatusCreateInProgress {
+			break
+		}
+		if err := sleep(c, cfnPollInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	if described.Status == types.ChangeSetStatusFailed {
+		reason := aws.ToString(described.StatusReason)
+		if strings.Contains(reason, "didn't contain changes") || strings.Contains(reason, "No updates are to be performed") {
+			return nil, cs.discard(c, set)
+		}
+		return nil, fmt.Errorf("change set failed: %s", reason)
+	}
+
+	var plan strings.Builder
+	changes := described.Changes
+	for token := described.NextToken; token != nil; {
+		page, err := cs.client.DescribeChangeSet(c, &cloudformation.DescribeChangeSetInput{ChangeSetName: aws.String(set.id), NextToken: token})
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, page.Changes...)
+		token = page.NextToken
+	}
+	for _, change := range changes {
+		rc := change.ResourceChange
+		if rc == nil {
+			continue
+		}
+		fmt.Fprintf(&plan, "%-8s %s (%s)", rc.Action, aws.ToString(rc.LogicalResourceId), aws.ToString(rc.ResourceType))
+		if rc.Replacement == types.ReplacementTrue {
+			plan.WriteString(" replacement")
+		}
+		plan.WriteString("\n")
+	}
+	fmt.Fprintf(&plan, "Changes: %d to %s stack %s.\n", len(changes), strings.ToLower(string(changeType)), cs.stack)
+	if err := cs.savePlan(plan.String()); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// savePlan logs a plan and saves it as plan.txt.
+func (cs *cfnStack) savePlan(plan string) error {
+	for _, line := range strings.SplitAfter(plan, "\n") {
+		if line != "" {
+			cs.l.ShellLogger(line)
+		}
+	}
+	if err := os.MkdirAll(cs.artifacts, 0o755); err != nil {
+		return fmt.Errorf("Error creating plan dir: %w", err)
+	}
+	path := filepath.Join(cs.artifacts, "plan.txt")
+	if err := os.WriteFile(path, []byte(plan), 0o644); err != nil {
+		return fmt.Errorf("Error saving plan: %w", err)
+	}
+	cs.l.InfoLogger(fmt.Sprintf("CloudFormation Plan Saved: %s", path))
+	return nil
+}
+
+// discard deletes a change set that won't be executed, along with the empty
+// stack a create change set leaves behind.
+func (cs *cfnStack) discard(c context.Context, set *changeSet) error {
+	if _, err := cs.client.DeleteChangeSet(c, &cloudformation.DeleteChangeSetInput{ChangeSetName: aws.String(set.id)}); err != nil {
+		return fmt.Errorf("Error deleting change set: %w", err)
+	}
+	if set.changeType == types.ChangeSetTypeCreate {
+		if _, err := cs.client.DeleteStack(c, &cloudformation.DeleteStackInput{StackName: aws.String(cs.stack)}); err != nil {
+			return fmt.Errorf("Error deleting empty stack: %w", err)
+		}
+	}
+	return nil
+}
+
+func (cs *cfnStack) execute(c context.Context, set *changeSet) error {
+	if cs.d.RequireApproval {
+		if err := approvePlan(c, cs.name, cs.artifacts, cs.d, cs.r, cs.l); err != nil {
+			cs.discard(context.Background(), set)
+			return err
+		}
+	}
+	since := time.Now()
+	if _, err := cs.client.ExecuteChangeSet(c, &cloudformation.ExecuteChangeSetInput{ChangeSetName: aws.String(set.id)}); err != nil {
+		return fmt.Errorf("Error executing change set: %w", err)
+	}
+	return cs.wait(c, since)
+}
+
+func (cs *cfnStack) destroy(c context.Context) error {
+	stack, err := cs.describe(c)
+	if err != nil {
+		return err
+	}
+	if stack == nil {
+		cs.l.InfoLogger("Nothing To Destroy")
+		return nil
+	}
+
+	var plan strings.Builder
+	paginator := cloudformation.NewListStackResourcesPaginator(cs.client, &cloudformation.ListStackResourcesInput{StackName: aws.String(cs.stack)})
+	count := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(c)
+		if err != nil {
+			return err
+		}
+		for _, res := range page.StackResourceSummaries {
+			fmt.Fprintf(&plan, "%-8s %s (%s)\n", "Remove", aws.ToString(res.LogicalResourceId), aws.ToString(res.ResourceType))
+			count++
+		}
+	}
+	fmt.Fprintf(&plan, "Changes: %d to delete with stack %s.\n", count, cs.stack)
+	if err := cs.savePlan(plan.String()); err != nil {
+		return err
+	}
+	if cs.d.RequireApproval {
+		if err := approvePlan(c, cs.name, cs.artifacts, cs.d, cs.r, cs.l); err != nil {
+			return err
+		}
+	}
+
+	cs.l.InfoLogger("Deleting CloudFormation Stack")
+	since := time.Now()
+	if _, err := cs.client.DeleteStack(c, &cloudformation.DeleteStackInput{StackName: stack.StackId}); err != nil {
+		return fmt.Errorf("Error deleting stack: %w", err)
+	}
+	if err := cs.wait(c, since); err != nil {
+		return err
+	}
+	cs.l.SuccessLogger("Successful CloudFormation Destroy")
+	return nil
+}
+
+// wait logs the stack's events until it stops changing. A cancelled run
+// cancels an update in progress, which rolls it back.
+func (cs *cfnStack) wait(c context.Context, since time.Time) error {
+	seen := map[string]bool{}
+	for {
+		if err := cs.logEvents(c, since, seen); err != nil && c.Err() == nil {
+			return err
+		}
+		stack, err := cs.describe(c)
+		if c.Err() != nil {
+			if _, err := cs.client.CancelUpdateStack(context.Background(), &cloudformation.CancelUpdateStackInput{StackName: aws.String(cs.stack)}); err == nil {
+				cs.l.WarnLogger(fmt.Sprintf("Cancelled update of stack %s", cs.stack))
+			}
+			return c.Err()
+		}
+		if err != nil {
+			return err
+		}
+		if stack == nil {
+			return nil
+		}
+		status := string(stack.StackStatus)
+		if !strings.HasSuffix(status, "_IN_PROGRESS") {
+			if !slices.Contains([]string{"CREATE_COMPLETE", "UPDATE_COMPLETE", "DELETE_COMPLETE", "IMPORT_COMPLETE"}, status) {
+				return fmt.Errorf("stack %s ended in %s: %s", cs.stack, status, aws.ToString(stack.StackStatusReason))
+			}
+			return nil
+		}
+		if err := sleep(c, cfnPollInterval); err != nil {
+			continue
+		}
+	}
+}
+
+// logEvents logs the stack events since the change started, oldest first.
+func (cs *cfnStack) logEvents(c context.Context, since time.Time, seen map[string]bool) error {
+	out, err := cs.client.DescribeStackEvents(c, &cloudformation.DescribeStackEventsInput{StackName: aws.String(cs.stack)})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.ErrorMessage(), "does not exist") {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range slices.Backward(out.StackEvents) {
+		id := aws.ToString(e.EventId)
+		if seen[id] || aws.ToTime(e.Timestamp).Before(since) {
+			continue
+		}
+		seen[id] = true
+		line := fmt.Sprintf("%s %s %s", aws.ToString(e.LogicalResourceId), e.ResourceStatus, aws.ToString(e.ResourceStatusReason))
+		cs.l.ShellLogger(strings.TrimSpace(line) + "\n")
+	}
+	return nil
+}
+
+// detectDrift reports resources whose live configuration no longer matches
+// the stack. CloudFormation has no state to refresh, so nothing is changed.
+func (cs *cfnStack) detectDrift(c context.Context) error {
+	started, err := cs.client.DetectStackDrift(c, &cloudformation.DetectStackDriftInput{StackName: aws.String(cs.stack)})
+	if err != nil {
+		return err
+	}
+	var status *cloudformation.DescribeStackDriftDetectionStatusOutput
+	for {
+		status, err = cs.client.DescribeStackDriftDetectionStatus(c, &cloudformation.DescribeStackDriftDetectionStatusInput{StackDriftDetectionId: started.StackDriftDetectionId})
+		if err != nil {
+			return err
+		}
+		if status.DetectionStatus != types.StackDriftDetectionStatusDetectionInProgress {
+			break
+		}
+		if err := sleep(c, cfnPollInterval); err != nil {
+			return err
+		}
+	}
+	if status.DetectionStatus == types.StackDriftDetectionStatusDetectionFailed {
+		return fmt.Errorf("%s", aws.ToString(status.DetectionStatusReason))
+	}
+	if status.StackDriftStatus != types.StackDriftStatusDrifted {
+		cs.l.InfoLogger("CloudFormation Stack Matches Its Resources")
+		return nil
+	}
+
+	cs.l.WarnLogger(fmt.Sprintf("CloudFormation Stack %s Drifted", cs.stack))
+	drifts, err := cs.client.DescribeStackResourceDrifts(c, &cloudformation.DescribeStackResourceDriftsInput{
+		StackName: aws.String(cs.stack),
+		StackResourceDriftStatusFilters: []types.StackResourceDriftStatus{
+			types.StackResourceDriftStatusModified,
+			types.StackResourceDriftStatusDeleted,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, drift := range drifts.StackResourceDrifts {
+		cs.l.ShellLogger(fmt.Sprintf("%-8s %s (%s)\n", drift.StackResourceDriftStatus, aws.ToString(drift.LogicalResourceId), aws.ToString(drift.ResourceType)))
+	}
+	return nil
+}
+
+func (cs *cfnStack) outputs(c context.Context) (map[string]string, error) {
+	stack, err := cs.describe(c)
+	if err != nil {
+		return nil, err
+	}
+	outputs := map[string]string{}
+	if stack == nil {
+		return outputs, nil
+	}
+	for _, o := range stack.Outputs {
+		outputs[aws.ToString(o.OutputKey)] = aws.ToString(o.OutputValue)
+	}
+	return outputs, nil
+}
+
+// sleep waits for d, returning early with the context's error.
+func sleep(c context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+func init() {
+	registry[structures.ServiceCloudFormation] = &CloudFormation{}
+}
@@ -0,0 +1,218 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+const cfnNamespace = "http://cloudformation.amazonaws.com/doc/2010-05-15/"
+
+// cfnServer is a stand-in for the CloudFormation query API holding a single
+// stack. Change sets finish at once and executing one completes the stack,
+// so nothing waits out cfnPollInterval.
+type cfnServer struct {
+	mu      sync.Mutex
+	status  string // "" while the stack does not exist
+	changes bool
+	actions []string
+	params  map[string]string
+}
+
+func (s *cfnServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	action := r.PostForm.Get("Action")
+	s.actions = append(s.actions, action)
+
+	w.Header().Set("Content-Type", "text/xml")
+	ok := func(body string) {
+		fmt.Fprintf(w, `<%[1]sResponse xmlns="%[2]s"><%[1]sResult>%[3]s</%[1]sResult><ResponseMetadata><RequestId>r</RequestId></ResponseMetadata></%[1]sResponse>`, action, cfnNamespace, body)
+	}
+	fail := func(msg string) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `<ErrorResponse xmlns="%s"><Error><Type>Sender</Type><Code>ValidationError</Code><Message>%s</Message></Error><RequestId>r</RequestId></ErrorResponse>`, cfnNamespace, msg)
+	}
+
+	switch action {
+	case "DescribeStacks":
+		if s.status == "" {
+			fail("Stack with id app does not exist")
+			return
+		}
+		ok(`<Stacks><member><StackName>app</StackName><StackId>arn:stack/app</StackId><StackStatus>` + s.status + `</StackStatus><CreationTime>2026-01-01T00:00:00Z</CreationTime>` +
+			`<Outputs><member><OutputKey>Url</OutputKey><OutputValue>https://app.example</OutputValue></member></Outputs></member></Stacks>`)
+	case "CreateChangeSet":
+		s.params = map[string]string{}
+		for i := 1; r.PostForm.Has(fmt.Sprintf("Parameters.member.%d.ParameterKey", i)); i++ {
+			s.params[r.PostForm.Get(fmt.Sprintf("Parameters.member.%d.ParameterKey", i))] = r.PostForm.Get(fmt.Sprintf("Parameters.member.%d.ParameterValue", i))
+		}
+		if s.status == "" {
+			s.status = "REVIEW_IN_PROGRESS"
+		}
+		ok(`<Id>arn:changeSet/flume-run-1</Id><StackId>arn:stack/app</StackId>`)
+	case "DescribeChangeSet":
+		if !s.changes {
+			ok(`<Status>FAILED</Status><StatusReason>The submitted information didn't contain changes.</StatusReason><Changes/>`)
+			return
+		}
+		ok(`<Status>CREATE_COMPLETE</Status><Changes><member><Type>Resource</Type><ResourceChange><Action>Add</Action>` +
+			`<LogicalResourceId>Bucket</LogicalResourceId><ResourceType>AWS::S3::Bucket</ResourceType></ResourceChange></member></Changes>`)
+	case "ExecuteChangeSet":
+		s.status = "CREATE_COMPLETE"
+		s.changes = false
+		ok("")
+	case "DescribeStackEvents":
+		ok(`<StackEvents><member><EventId>e1</EventId><StackName>app</StackName><StackId>arn:stack/app</StackId><LogicalResourceId>Bucket</LogicalResourceId>` +
+			`<ResourceStatus>CREATE_COMPLETE</ResourceStatus><Timestamp>2030-01-01T00:00:00Z</Timestamp></member></StackEvents>`)
+	case "DeleteChangeSet":
+		ok("")
+	case "DeleteStack":
+		s.status = ""
+		ok("")
+	case "ListStackResources":
+		ok(`<StackResourceSummaries><member><LogicalResourceId>Bucket</LogicalResourceId><ResourceType>AWS::S3::Bucket</ResourceType>` +
+			`<ResourceStatus>CREATE_COMPLETE</ResourceStatus><LastUpdatedTimestamp>2026-01-01T00:00:00Z</LastUpdatedTimestamp></member></StackResourceSummaries>`)
+	default:
+		fail("unexpected action " + action)
+	}
+}
+
+// calls returns the actions called so far and forgets them.
+func (s *cfnServer) calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	actions := s.actions
+	s.actions = nil
+	return actions
+}
+
+func setupCloudFormation(t *testing.T, s *cfnServer) {
+	t.Helper()
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	t.Setenv("AWS_ENDPOINT_URL_CLOUDFORMATION", srv.URL)
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+}
+
+func TestCloudFormation(t *testing.T) {
+	cfn := &cfnServer{changes: true}
+	setupCloudFormation(t, cfn)
+	d := structures.Deployment{
+		Service:  structures.ServiceCloudFormation,
+		Action:   structures.ActionSync,
+		Repo:     "octo/infra",
+		Template: "stack.yaml",
+		Vars:     map[string]string{"Env": "prod"},
+	}
+
+	r := newTestRun(t)
+	outputs, err := registry[structures.ServiceCloudFormation].Call(context.Background(), "app", d, r, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"Url": "https://app.example"}; !reflect.DeepEqual(outputs, want) {
+		t.Errorf("outputs = %v, want %v", outputs, want)
+	}
+	if want := map[string]string{"Env": "prod"}; !reflect.DeepEqual(cfn.params, want) {
+		t.Errorf("change set parameters = %v, want %v", cfn.params, want)
+	}
+	wantCalls := []string{"DescribeStacks", "CreateChangeSet", "DescribeChangeSet", "ExecuteChangeSet", "DescribeStackEvents", "DescribeStacks", "DescribeStacks"}
+	if got := cfn.calls(); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("actions = %q, want %q", got, wantCalls)
+	}
+	plan, err := os.ReadFile(filepath.Join(r.RunDir, "cloudformation", "app", "plan.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Add      Bucket (AWS::S3::Bucket)\nChanges: 1 to create stack app.\n"; string(plan) != want {
+		t.Errorf("plan.txt = %q, want %q", plan, want)
+	}
+
+	// The stack now matches the template, so the empty change set is
+	// deleted and the stack kept.
+	r = newTestRun(t)
+	if _, err := registry[structures.ServiceCloudFormation].Call(context.Background(), "app", d, r, testLogger()); err != nil {
+		t.Fatal(err)
+	}
+	wantCalls = []string{"DescribeStacks", "CreateChangeSet", "DescribeChangeSet", "DeleteChangeSet", "DescribeStacks"}
+	if got := cfn.calls(); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("actions = %q, want %q", got, wantCalls)
+	}
+}
+
+func TestCloudFormationPlanDeletesNewStack(t *testing.T) {
+	cfn := &cfnServer{changes: true}
+	setupCloudFormation(t, cfn)
+	r := newTestRun(t)
+	outputs, err := registry[structures.ServiceCloudFormation].Call(context.Background(), "app", structures.Deployment{
+		Service:  structures.ServiceCloudFormation,
+		Action:   structures.ActionPlan,
+		Repo:     "octo/infra",
+		Template: "stack.yaml",
+	}, r, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 0 {
+		t.Errorf("outputs = %v, want none", outputs)
+	}
+	wantCalls := []string{"DescribeStacks", "CreateChangeSet", "DescribeChangeSet", "DeleteChangeSet", "DeleteStack", "DescribeStacks"}
+	if got := cfn.calls(); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("actions = %q, want %q", got, wantCalls)
+	}
+}
+
+func TestCloudFormationDestroy(t *testing.T) {
+	cfn := &cfnServer{status: "CREATE_COMPLETE"}
+	setupCloudFormation(t, cfn)
+	r := newTestRun(t)
+	_, err := registry[structures.ServiceCloudFormation].Call(context.Background(), "app", structures.Deployment{
+		Service:  structures.ServiceCloudFormation,
+		Action:   structures.ActionDestroy,
+		Repo:     "octo/infra",
+		Template: "stack.yaml",
+	}, r, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCalls := []string{"DescribeStacks", "ListStackResources", "DeleteStack", "DescribeStackEvents", "DescribeStacks"}
+	if got := cfn.calls(); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("actions = %q, want %q", got, wantCalls)
+	}
+	plan, err := os.ReadFile(filepath.Join(r.RunDir, "cloudformation", "app", "plan.txt"))
+	if err != nil || !strings.Contains(string(plan), "Changes: 1 to delete with stack app.") {
+		t.Errorf("plan.txt = %q (%v), want the resources to delete", plan, err)
+	}
+}
+
+func TestCloudFormationTemplateOutsideRepo(t *testing.T) {
+	setupCloudFormation(t, &cfnServer{})
+	r := newTestRun(t)
+	_, err := registry[structures.ServiceCloudFormation].Call(context.Background(), "app", structures.Deployment{
+		Service:  structures.ServiceCloudFormation,
+		Action:   structures.ActionSync,
+		Repo:     "octo/infra",
+		Template: "../stack.yaml",
+	}, r, testLogger())
+	if err == nil || !strings.Contains(err.Error(), "template must be a relative path inside the repo") {
+		t.Errorf("Call error = %v, want the template rejected", err)
+	}
+}
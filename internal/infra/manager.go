@@ -1,7 +1,15 @@
 package infra
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
 	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/resolver"
 	"github.com/AlexSTJO/flume/internal/structures"
 
 	"fmt"
@@ -9,23 +17,122 @@ import (
 
 type Service interface {
 	Name() string
-	Call(d structures.Deployment, r *structures.RunInfo, l *logging.Config) (map[string]string, error)
+	Call(c context.Context, n string, d structures.Deployment, r *structures.RunInfo, l *logging.Config) (map[string]string, error)
 }
 
 var registry = map[string]Service{}
 
-func Deploy(i map[string]structures.Deployment, r *structures.RunInfo, l *logging.Config) (*map[string]map[string]string, error) {
-	svc_outputs := make(map[string]map[string]string)
-	for _, deployment := range i {
-		svc, ok := registry[deployment.Service]
-		if !ok {
-			return nil, fmt.Errorf("unknown service %q", deployment.Service)
-		}
-		outputs, err := svc.Call(deployment, r, l)
+// Run resolves the placeholders of the deployment named n and deploys it.
+// Deployments are graph nodes, so ctx and infra_outputs hold whatever ran
+// upstream of it.
+func Run(c context.Context, n string, d structures.Deployment, ctx *structures.Context, infra_outputs *map[string]map[string]string, r *structures.RunInfo, l *logging.Config) (map[string]string, error) {
+	svc, ok := registry[d.Service]
+	if !ok {
+		return nil, fmt.Errorf("unknown service %q", d.Service)
+	}
+	d, err := resolveDeployment(c, d, ctx, infra_outputs, r)
+	if err != nil {
+		return nil, fmt.Errorf("Error resolving deployment %s: %w", n, err)
+	}
+	return svc.Call(c, n, d, r, l)
+}
+
+// resolveDeployment resolves placeholders in the deployment's settings.
+// Pipeline.Upstream must scan the same settings for ${infra:...} references.
+func resolveDeployment(c context.Context, d structures.Deployment, ctx *structures.Context, infra_outputs *map[string]map[string]string, r *structures.RunInfo) (structures.Deployment, error) {
+	var err error
+	resolve := func(s string) string {
 		if err != nil {
-			return nil, err
+			return s
+		}
+		var v string
+		v, err = resolver.ResolveString(c, s, ctx, infra_outputs, r)
+		return v
+	}
+	resolveMap := func(m map[string]string) map[string]string {
+		out := make(map[string]string, len(m))
+		for k, v := range m {
+			out[k] = resolve(v)
 		}
-		svc_outputs[svc.Name()] = outputs
+		return out
+	}
+
+	d.Repo = resolve(d.Repo)
+	d.VarFile = resolve(d.VarFile)
+	d.WorkingDir = resolve(d.WorkingDir)
+	d.Workspace = resolve(d.Workspace)
+	d.Binary = resolve(d.Binary)
+	d.Stack = resolve(d.Stack)
+	d.Template = resolve(d.Template)
+	d.Region = resolve(d.Region)
+	d.BackendConfig = resolveMap(d.BackendConfig)
+	d.Vars = resolveMap(d.Vars)
+	targets := make([]string, len(d.Targets))
+	for i, t := range d.Targets {
+		targets[i] = resolve(t)
+	}
+	d.Targets = targets
+	return d, err
+}
+
+// checkout clones the deployment's repo into base/repo and returns the
+// directory inside it the deployment runs in.
+func checkout(c context.Context, base string, d structures.Deployment, l *logging.Config) (string, error) {
+	l.InfoLogger(fmt.Sprintf("Cloning Remote Repo: %s", d.Repo))
+	dir, err := TerraformPull(c, d.Repo, filepath.Join(base, "repo"), l)
+	if err != nil {
+		return "", fmt.Errorf("Error pulling repo: %w", err)
+	}
+	if d.WorkingDir != "" {
+		if !filepath.IsLocal(d.WorkingDir) {
+			return "", fmt.Errorf("working_dir must be a relative path inside the repo: %s", d.WorkingDir)
+		}
+		dir = filepath.Join(dir, d.WorkingDir)
+	}
+	return dir, nil
+}
+
+// approvePlan waits for someone to approve the plan saved in base, which is
+// shown with the run while it waits.
+func approvePlan(c context.Context, n string, base string, d structures.Deployment, r *structures.RunInfo, l *logging.Config) error {
+	plan, err := os.ReadFile(filepath.Join(base, "plan.txt"))
+	if err != nil {
+		return fmt.Errorf("Error reading plan for approval: %w", err)
+	}
+	var timeout time.Duration
+	if d.ApprovalTimeout != "" {
+		if timeout, err = time.ParseDuration(d.ApprovalTimeout); err != nil {
+			return fmt.Errorf("Invalid approval_timeout: %w", err)
+		}
+	}
+
+	l.InfoLogger(fmt.Sprintf("Waiting for approval of deployment '%s' (POST /runs/%s/approvals/%s)", n, r.RunID, n))
+	a, err := r.AwaitApproval(c, n, structures.ApprovalRequest{
+		Summary:   fmt.Sprintf("%s %s of deployment '%s'", d.Service, d.Action, n),
+		Plan:      r.Secrets.Redact(string(plan)),
+		Approvers: d.Approvers,
+		Timeout:   timeout,
+	})
+	if err != nil {
+		return err
+	}
+	if err := a.Err(n); err != nil {
+		return err
+	}
+	l.SuccessLogger(fmt.Sprintf("Deployment '%s' approved by %s", n, a.Approver))
+	return nil
+}
+
+// outputString keeps a string output as it is and JSON encodes anything
+// else, so ${infra:deployment.output.key} can reach inside it.
+func outputString(raw json.RawMessage) (string, error) {
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str, nil
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return "", err
 	}
-	return &svc_outputs, nil
+	return compact.String(), nil
 }
@@ -0,0 +1,157 @@
+package infra
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// fakeGit clones by creating the target directory with a CloudFormation
+// template in it.
+const fakeGit = `#!/bin/sh
+if [ "$1" = clone ]; then
+	mkdir -p "$3" && echo "Resources: {}" > "$3/stack.yaml"
+	exit 0
+fi
+echo "unexpected git $*" >&2
+exit 1
+`
+
+// TestMain puts a fake git on PATH and points the GitHub App client, which
+// is set up once per process, at a stand-in that hands out tokens.
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "flume-infra-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	keyPath := filepath.Join(dir, "app.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyPath, pemBytes, 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.WriteFile(filepath.Join(dir, "git"), []byte(fakeGit), 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/installation"):
+			w.Write([]byte(`{"id": 42}`))
+		case r.Method == "POST" && r.URL.Path == "/app/installations/42/access_tokens":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"token": "installation-token"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	os.Setenv("GITHUB_API_URL", srv.URL)
+	os.Setenv("GITHUB_APP_ID", "1")
+	os.Setenv("GITHUB_APP_PRIVATE_KEY_PATH", keyPath)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return m.Run()
+}
+
+// fakeCLI puts an executable script named name on PATH. Each call is
+// appended to the returned file, one line of arguments per call.
+func fakeCLI(t *testing.T, name string, script string) string {
+	t.Helper()
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	body := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %q\n%s", calls, script)
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+// readCalls returns the arguments of each call a fake CLI recorded.
+func readCalls(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func newTestRun(t *testing.T) *structures.RunInfo {
+	return &structures.RunInfo{
+		RunID:     "run_1",
+		RunDir:    t.TempDir(),
+		StartedAt: time.Now().UTC(),
+		Params:    map[string]string{},
+		Status:    structures.NewRunStatus(),
+		Context:   structures.NewContext(),
+		Secrets:   logging.NewRedactor(),
+	}
+}
+
+func testLogger() *logging.Config {
+	return logging.New(true, "infra", "run_1", "")
+}
+
+func TestRunResolvesDeployment(t *testing.T) {
+	calls := fakeCLI(t, "tofu", `
+case "$1" in
+	output) echo '{}' ;;
+esac
+`)
+	r := newTestRun(t)
+	r.Params["env"] = "prod"
+	infra_outputs := map[string]map[string]string{"network": {"vpc_id": "vpc-123"}}
+	_, err := Run(context.Background(), "app", structures.Deployment{
+		Service:   structures.ServiceOpenTofu,
+		Action:    structures.ActionSync,
+		Repo:      "octo/infra",
+		Workspace: "${param:env}",
+		Vars:      map[string]string{"vpc": "${infra:network.vpc_id}"},
+	}, r.Context, &infra_outputs, r, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := readCalls(t, calls)
+	for _, want := range []string{"workspace select -or-create prod", "-var vpc=vpc-123"} {
+		if !strings.Contains(strings.Join(got, "\n"), want) {
+			t.Errorf("tofu calls are missing %q:\n%s", want, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestRunUnknownService(t *testing.T) {
+	r := newTestRun(t)
+	_, err := Run(context.Background(), "app", structures.Deployment{Service: "ansible"}, r.Context, nil, r, testLogger())
+	if err == nil || !strings.Contains(err.Error(), `unknown service "ansible"`) {
+		t.Errorf("Run error = %v, want an unknown service", err)
+	}
+}
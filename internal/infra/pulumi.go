@@ -0,0 +1,301 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/structures"
+	"github.com/AlexSTJO/flume/internal/utils"
+)
+
+// Pulumi deploys a stack with the pulumi CLI. The CLI must already be logged
+// in to a backend, e.g. through PULUMI_ACCESS_TOKEN or PULUMI_BACKEND_URL.
+type Pulumi struct{}
+
+func (p *Pulumi) Name() string {
+	return structures.ServicePulumi
+}
+
+func (p *Pulumi) Call(c context.Context, n string, d structures.Deployment, r *structures.RunInfo, l *logging.Config) (map[string]string, error) {
+	base := filepath.Join(r.RunDir, "pulumi", n)
+	dir, err := checkout(c, base, d, l)
+	if err != nil {
+		return nil, err
+	}
+	ps := &pulumiStack{name: n, bin: "pulumi", stack: n, dir: dir, artifacts: base, d: d, r: r, l: l}
+	if d.Binary != "" {
+		ps.bin = d.Binary
+	}
+	if d.Stack != "" {
+		ps.stack = d.Stack
+	}
+
+	if _, err := ps.output(c, "stack", "select", "--create", "--non-interactive", ps.stack); err != nil {
+		return nil, fmt.Errorf("Pulumi Stack Select Failed: %w", err)
+	}
+	l.InfoLogger(fmt.Sprintf("Using Pulumi Stack: %s", ps.stack))
+	if err := ps.configure(c); err != nil {
+		return nil, fmt.Errorf("Pulumi Config Failed: %w", err)
+	}
+
+	targets := []string{}
+	for _, t := range d.Targets {
+		targets = append(targets, "--target", t)
+	}
+	switch d.Action {
+	case structures.ActionPlan:
+		changes, err := ps.preview(c, targets)
+		if err != nil {
+			return nil, fmt.Errorf("Pulumi Preview Failed: %w", err)
+		}
+		if changes {
+			l.InfoLogger("Pulumi Preview Has Changes. Not Applying (action: plan)")
+		} else {
+			l.InfoLogger("Pulumi Stack Up To Date With Infrastructure")
+		}
+	case structures.ActionApply, structures.ActionSync:
+		changes, err := ps.preview(c, targets)
+		if err != nil {
+			return nil, fmt.Errorf("Pulumi Preview Failed: %w", err)
+		}
+		if changes || d.Action == structures.ActionApply {
+			l.InfoLogger("Running Pulumi Up")
+			if err := ps.apply(c, "up", targets); err != nil {
+				l.ErrorLogger(fmt.Errorf("Error Applying Pulumi Deployment"))
+				return nil, err
+			}
+			l.SuccessLogger("Successful Pulumi Up")
+		} else {
+			l.InfoLogger("Pulumi Stack Up To Date With Infrastructure")
+		}
+	case structures.ActionDestroy, structures.ActionRefresh:
+		if err := ps.previewOnly(c, d.Action, targets); err != nil {
+			return nil, fmt.Errorf("Pulumi %s Preview Failed: %w", d.Action, err)
+		}
+		l.InfoLogger(fmt.Sprintf("Running Pulumi %s", d.Action))
+		if err := ps.apply(c, d.Action, targets); err != nil {
+			l.ErrorLogger(fmt.Errorf("Error Running Pulumi %s", d.Action))
+			return nil, err
+		}
+		l.SuccessLogger(fmt.Sprintf("Successful Pulumi %s", d.Action))
+		if d.Action == structures.ActionDestroy {
+			return map[string]string{}, nil
+		}
+	default:
+		return nil, fmt.Errorf("Unknown Action: %s", d.Action)
+	}
+
+	outputs, err := ps.outputs(c)
+	if err != nil {
+		return nil, fmt.Errorf("Error Reading Pulumi Outputs: %w", err)
+	}
+	return outputs, nil
+}
+
+// pulumiStack runs pulumi in one deployment's project directory. Previews
+// are saved to artifacts as plan.txt, with the JSON preview in plan.json.
+type pulumiStack struct {
+	name      string
+	bin       string
+	stack     string
+	dir       string
+	artifacts string
+	d         structures.Deployment
+	r         *structures.RunInfo
+	l         *logging.Config
+}
+
+func (ps *pulumiStack) command(c context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(c, ps.bin, args...)
+	cmd.Dir = ps.dir
+	cmd.Env = append(os.Environ(), "PULUMI_SKIP_UPDATE_CHECK=true")
+	utils.KillProcessGroup(cmd)
+	return cmd
+}
+
+// output runs the command quietly and returns its stdout. Errors carry
+// stderr, with secrets masked.
+func (ps *pulumiStack) output(c context.Context, args ...string) ([]byte, error) {
+	return ps.outputStdin(c, nil, args...)
+}
+
+// outputStdin is output with stdin read from r.
+func (ps *pulumiStack) outputStdin(c context.Context, r io.Reader, args ...string) ([]byte, error) {
+	cmd := ps.command(c, args...)
+	cmd.Stdin = r
+	out, err := cmd.Output()
+	if err != nil {
+		if c.Err() != nil {
+			return out, c.Err()
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return out, fmt.Errorf("pulumi %s failed: %w: %s", args[0], err, ps.r.Secrets.Redact(strings.TrimSpace(string(exitErr.Stderr))))
+		}
+		return out, fmt.Errorf("pulumi %s failed: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// configure sets the deployment's vars as stack config. Values holding a
+// secret are stored as pulumi secrets and passed on stdin, which pulumi
+// reads when the value is left off, so they never show up in ps output.
+func (ps *pulumiStack) configure(c context.Context) error {
+	for _, k := range sortedKeys(ps.d.Vars) {
+		v := ps.d.Vars[k]
+		var err error
+		if ps.r.Secrets.Redact(v) != v {
+			_, err = ps.outputStdin(c, strings.NewReader(v), "config", "set", "--non-interactive", "--secret", "--", k)
+		} else {
+			_, err = ps.output(c, "config", "set", "--non-interactive", "--", k, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type pulumiPreview struct {
+	Steps []struct {
+		Op  string `json:"op"`
+		URN string `json:"urn"`
+	} `json:"steps"`
+	ChangeSummary map[string]int `json:"changeSummary"`
+	Diagnostics   []struct {
+		Message  string `json:"message"`
+		Severity string `json:"severity"`
+	} `json:"diagnostics"`
+}
+
+// preview saves a preview and reports whether it has changes.
+func (ps *pulumiStack) preview(c context.Context, targets []string) (bool, error) {
+	if err := os.MkdirAll(ps.artifacts, 0o755); err != nil {
+		return false, fmt.Errorf("Error creating plan dir: %w", err)
+	}
+	out, err := ps.output(c, append([]string{"preview", "--json", "--non-interactive"}, targets...)...)
+	var preview pulumiPreview
+	if jsonErr := json.Unmarshal(out, &preview); jsonErr != nil {
+		if err != nil {
+			return false, err
+		}
+		return false, fmt.Errorf("Unparsable pulumi preview: %w", jsonErr)
+	}
+	if err != nil {
+		for _, diag := range preview.Diagnostics {
+			if diag.Severity == "error" {
+				err = fmt.Errorf("%w: %s", err, strings.TrimSpace(diag.Message))
+			}
+		}
+		return false, err
+	}
+	if err := os.WriteFile(filepath.Join(ps.artifacts, "plan.json"), out, 0o600); err != nil {
+		return false, fmt.Errorf("Error saving preview: %w", err)
+	}
+
+	var plan strings.Builder
+	for _, step := range preview.Steps {
+		if step.Op != "same" {
+			fmt.Fprintf(&plan, "%-8s %s\n", step.Op, step.URN)
+		}
+	}
+	ops := []string{}
+	for _, op := range slices.Sorted(maps.Keys(preview.ChangeSummary)) {
+		if count := preview.ChangeSummary[op]; op != "same" && count > 0 {
+			ops = append(ops, fmt.Sprintf("%d to %s", count, op))
+		}
+	}
+	if len(ops) == 0 {
+		plan.WriteString("No changes.\n")
+	} else {
+		fmt.Fprintf(&plan, "Changes: %s.\n", strings.Join(ops, ", "))
+	}
+	for _, line := range strings.SplitAfter(plan.String(), "\n") {
+		if line != "" {
+			ps.l.ShellLogger(line)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(ps.artifacts, "plan.txt"), []byte(plan.String()), 0o644); err != nil {
+		return false, fmt.Errorf("Error saving preview: %w", err)
+	}
+	ps.l.InfoLogger(fmt.Sprintf("Pulumi Preview Saved: %s", filepath.Join(ps.artifacts, "plan.txt")))
+	return len(ops) > 0, nil
+}
+
+// previewOnly saves the preview of a destroy or refresh as plan.txt.
+func (ps *pulumiStack) previewOnly(c context.Context, action string, targets []string) error {
+	if err := os.MkdirAll(ps.artifacts, 0o755); err != nil {
+		return fmt.Errorf("Error creating plan dir: %w", err)
+	}
+	f, err := os.Create(filepath.Join(ps.artifacts, "plan.txt"))
+	if err != nil {
+		return fmt.Errorf("Error creating plan file: %w", err)
+	}
+	defer f.Close()
+	args := append([]string{action, "--preview-only", "--non-interactive"}, targets...)
+	return stream(c, ps.command(c, args...), ps.l, f)
+}
+
+// apply runs up, destroy or refresh. Pulumi runs the program again, so what
+// it changes can differ from the saved preview if the program, its config or
+// the cloud changed in between. --skip-preview only avoids a second preview
+// in the log.
+func (ps *pulumiStack) apply(c context.Context, action string, targets []string) error {
+	if ps.d.RequireApproval {
+		if err := approvePlan(c, ps.name, ps.artifacts, ps.d, ps.r, ps.l); err != nil {
+			return err
+		}
+	}
+	args := append([]string{action, "--yes", "--skip-preview", "--non-interactive"}, targets...)
+	if err := stream(c, ps.command(c, args...), ps.l, nil); err != nil {
+		return fmt.Errorf("pulumi %s failed: %w", action, err)
+	}
+	return nil
+}
+
+// outputs reads the stack's outputs. Secret outputs are masked in the run's
+// logs and outputs.
+func (ps *pulumiStack) outputs(c context.Context) (map[string]string, error) {
+	masked, err := ps.output(c, "stack", "output", "--json")
+	if err != nil {
+		return nil, err
+	}
+	shown, err := ps.output(c, "stack", "output", "--json", "--show-secrets")
+	if err != nil {
+		return nil, err
+	}
+	var plain, values map[string]json.RawMessage
+	if err := json.Unmarshal(masked, &plain); err != nil {
+		return nil, fmt.Errorf("Unparsable pulumi output: %w", err)
+	}
+	if err := json.Unmarshal(shown, &values); err != nil {
+		return nil, fmt.Errorf("Unparsable pulumi output: %w", err)
+	}
+
+	outputs := make(map[string]string, len(values))
+	for name, raw := range values {
+		value, err := outputString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Unparsable value of pulumi output %s: %w", name, err)
+		}
+		if string(plain[name]) == `"[secret]"` {
+			addSecrets(ps.r, value)
+		}
+		outputs[name] = value
+	}
+	return outputs, nil
+}
+
+func init() {
+	registry[structures.ServicePulumi] = &Pulumi{}
+}
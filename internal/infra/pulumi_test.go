@@ -0,0 +1,124 @@
+package infra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// fakePulumi previews one new bucket and has a secret stack output. Secret
+// config values read from stdin are kept next to the calls.
+const fakePulumi = `
+case "$1 $2" in
+	"config set")
+		case "$*" in
+			*--secret*) cat >> "$(dirname "$0")/secrets" ;;
+		esac ;;
+	"stack output")
+		case "$*" in
+			*--show-secrets*) echo '{"url":"https://app.example","ids":["a","b"],"db_password":"hunter2-pw"}' ;;
+			*) echo '{"url":"https://app.example","ids":["a","b"],"db_password":"[secret]"}' ;;
+		esac ;;
+	preview*)
+		echo '{"steps":[{"op":"same","urn":"urn:pulumi:dev::site::pulumi:pulumi:Stack::site-dev"},{"op":"create","urn":"urn:pulumi:dev::site::aws:s3/bucket:Bucket::site"}],"changeSummary":{"create":1,"same":1}}' ;;
+	up*)
+		echo "Resources: + 1 created" ;;
+esac
+`
+
+func TestPulumi(t *testing.T) {
+	calls := fakeCLI(t, "pulumi", fakePulumi)
+	r := newTestRun(t)
+	r.Secrets.Add("s3cret-token")
+	outputs, err := registry[structures.ServicePulumi].Call(context.Background(), "site", structures.Deployment{
+		Service: structures.ServicePulumi,
+		Action:  structures.ActionSync,
+		Repo:    "octo/infra",
+		Stack:   "dev",
+		Vars:    map[string]string{"aws:region": "eu-west-1", "token": "s3cret-token"},
+		Targets: []string{"urn:bucket"},
+	}, r, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"url": "https://app.example", "ids": `["a","b"]`, "db_password": "hunter2-pw"}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("outputs = %v, want %v", outputs, want)
+	}
+	if got := r.Secrets.Redact("password hunter2-pw"); got != "password "+logging.Mask {
+		t.Errorf("secret output is not redacted: %q", got)
+	}
+
+	wantCalls := []string{
+		"stack select --create --non-interactive dev",
+		"config set --non-interactive -- aws:region eu-west-1",
+		"config set --non-interactive --secret -- token",
+		"preview --json --non-interactive --target urn:bucket",
+		"up --yes --skip-preview --non-interactive --target urn:bucket",
+		"stack output --json",
+		"stack output --json --show-secrets",
+	}
+	if got := readCalls(t, calls); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("pulumi calls = %q, want %q", got, wantCalls)
+	}
+	secrets, err := os.ReadFile(filepath.Join(filepath.Dir(calls), "secrets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secrets) != "s3cret-token" {
+		t.Errorf("secret config read from stdin = %q, want %q", secrets, "s3cret-token")
+	}
+
+	plan, err := os.ReadFile(filepath.Join(r.RunDir, "pulumi", "site", "plan.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPlan := "create   urn:pulumi:dev::site::aws:s3/bucket:Bucket::site\nChanges: 1 to create.\n"
+	if string(plan) != wantPlan {
+		t.Errorf("plan.txt = %q, want %q", plan, wantPlan)
+	}
+}
+
+func TestPulumiPlanDoesNotApply(t *testing.T) {
+	calls := fakeCLI(t, "pulumi", fakePulumi)
+	r := newTestRun(t)
+	_, err := registry[structures.ServicePulumi].Call(context.Background(), "site", structures.Deployment{
+		Service: structures.ServicePulumi,
+		Action:  structures.ActionPlan,
+		Repo:    "octo/infra",
+	}, r, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range readCalls(t, calls) {
+		if strings.HasPrefix(call, "up ") {
+			t.Errorf("plan ran %q", call)
+		}
+	}
+}
+
+func TestPulumiPreviewErrors(t *testing.T) {
+	fakeCLI(t, "pulumi", `
+case "$1" in
+	preview)
+		echo '{"diagnostics":[{"message":"missing required config aws:region","severity":"error"}]}'
+		exit 255 ;;
+esac
+`)
+	r := newTestRun(t)
+	_, err := registry[structures.ServicePulumi].Call(context.Background(), "site", structures.Deployment{
+		Service: structures.ServicePulumi,
+		Action:  structures.ActionSync,
+		Repo:    "octo/infra",
+	}, r, testLogger())
+	if err == nil || !strings.Contains(err.Error(), "missing required config aws:region") {
+		t.Errorf("Call error = %v, want the preview's diagnostics", err)
+	}
+}
@@ -1,13 +1,17 @@
 package infra
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/AlexSTJO/flume/internal/github"
 	"github.com/AlexSTJO/flume/internal/logging"
@@ -20,145 +24,269 @@ type State struct {
 }
 
 type Resource struct {
+	Module    string     `json:"module,omitempty"`
+	Mode      string     `json:"mode"`
 	Type      string     `json:"type"`
 	Name      string     `json:"name"`
 	Instances []Instance `json:"instances"`
 }
 
 type Instance struct {
-	Attributes Attributes `json:"attributes"`
-}
-
-type Attributes struct {
-	Id    string            `json:"id"`
-	Tags  map[string]string `json:"tags"`
-	State string            `json:"instance_state"`
+	IndexKey            any             `json:"index_key,omitempty"`
+	Attributes          map[string]any  `json:"attributes"`
+	SensitiveAttributes json.RawMessage `json:"sensitive_attributes,omitempty"`
 }
 
 type tfOutputValue struct {
 	Sensitive bool            `json:"sensitive"`
 	Type      json.RawMessage `json:"type"`
-	Value     string          `json:"value"`
+	Value     json.RawMessage `json:"value"`
 }
 
+// Terraform deploys with the terraform CLI, or a CLI compatible with it
+// such as OpenTofu's tofu.
 type Terraform struct {
-	RunDir string
+	Service string
+	Binary  string
 }
 
 func (t *Terraform) Name() string {
-	return "terraform"
+	return t.Service
 }
 
-func (t *Terraform) Call(d structures.Deployment, r *structures.RunInfo, l *logging.Config) (map[string]string, error) {
-	l.InfoLogger(fmt.Sprintf("Cloning Terraform Remote Repo: %s", d.Repo))
-	key, err := TerraformPull(d.Repo, r, l)
+func (t *Terraform) Call(c context.Context, n string, d structures.Deployment, r *structures.RunInfo, l *logging.Config) (map[string]string, error) {
+	// Each deployment gets its own clone, and keeps its plan next to it.
+	base := filepath.Join(r.RunDir, "terraform", n)
+	key, err := checkout(c, base, d, l)
 	if err != nil {
-		return nil, fmt.Errorf("Error pulling terraform repo: %w", err)
+		return nil, err
+	}
+	bin := t.Binary
+	if d.Binary != "" {
+		bin = d.Binary
+	}
+	tf := &tfWorkspace{name: n, bin: bin, dir: key, artifacts: base, d: d, r: r, l: l}
+
+	if err := tf.init(c, d.BackendConfig); err != nil {
+		return nil, fmt.Errorf("Terraform Init Failed: %w", err)
 	}
+	l.InfoLogger("Terraform Initialization Succesful")
 
+	if d.Workspace != "" {
+		if err := tf.selectWorkspace(c, d.Workspace); err != nil {
+			return nil, fmt.Errorf("Terraform Workspace Failed: %w", err)
+		}
+		l.InfoLogger(fmt.Sprintf("Using Terraform Workspace: %s", d.Workspace))
+	}
+
+	args := planArgs(d)
 	switch d.Action {
-	case "sync":
-		{
-			if err := TerraformInit(key); err != nil {
-				return nil, fmt.Errorf("Terraform Init Failed: %w", err)
+	case structures.ActionPlan:
+		changes, err := tf.plan(c, args)
+		if err != nil {
+			return nil, fmt.Errorf("Terraform Plan Failed: %w", err)
+		}
+		if changes {
+			l.InfoLogger("Terraform Plan Has Changes. Not Applying (action: plan)")
+		} else {
+			l.InfoLogger("Terraform Modules Up To Date With Infrastructure")
+		}
+	case structures.ActionApply, structures.ActionSync:
+		changes, err := tf.plan(c, args)
+		if err != nil {
+			return nil, fmt.Errorf("Terraform Plan Failed: %w", err)
+		}
+		if changes || d.Action == structures.ActionApply {
+			l.InfoLogger("Running Terraform Apply")
+			if err := tf.apply(c); err != nil {
+				l.ErrorLogger(fmt.Errorf("Error Applying Terraform Deployment"))
+				return nil, err
 			}
-			l.InfoLogger("Terraform Initialization Succesful")
-
-			changes, err := TerraformPlan(key, d.VarFile)
-			if err != nil {
-				return nil, fmt.Errorf("Terraform Plan Failed: %w", err)
+			l.SuccessLogger("Successful Terraform Apply")
+		} else {
+			l.InfoLogger("Terraform Modules Up To Date With Infrastructure")
+		}
+	case structures.ActionDestroy:
+		changes, err := tf.plan(c, append(args, "-destroy"))
+		if err != nil {
+			return nil, fmt.Errorf("Terraform Destroy Plan Failed: %w", err)
+		}
+		if changes {
+			l.InfoLogger("Running Terraform Destroy")
+			if err := tf.apply(c); err != nil {
+				l.ErrorLogger(fmt.Errorf("Error Destroying Terraform Deployment"))
+				return nil, err
 			}
-
-			if changes {
-				l.InfoLogger("Changes can be made. Running Apply")
-				err := TerraformApply(key, d.VarFile)
-				if err != nil {
-					l.ErrorLogger(fmt.Errorf("Error Applying Terraform Deployment"))
-					return nil, err
-				}
-				l.SuccessLogger("Successful Terraform Apply")
-			} else {
-				l.InfoLogger("Terraform Modules Up To Date With Infrastructure")
+			l.SuccessLogger("Successful Terraform Destroy")
+		} else {
+			l.InfoLogger("Nothing To Destroy")
+		}
+		return map[string]string{}, nil
+	case structures.ActionRefresh:
+		changes, err := tf.plan(c, append(args, "-refresh-only"))
+		if err != nil {
+			return nil, fmt.Errorf("Terraform Refresh Plan Failed: %w", err)
+		}
+		if changes {
+			l.InfoLogger("Infrastructure Drifted. Refreshing Terraform State")
+			if err := tf.apply(c); err != nil {
+				l.ErrorLogger(fmt.Errorf("Error Refreshing Terraform State"))
+				return nil, err
 			}
-
+			l.SuccessLogger("Successful Terraform Refresh")
+		} else {
+			l.InfoLogger("Terraform State Up To Date With Infrastructure")
 		}
 	default:
 		return nil, fmt.Errorf("Unknown Action: %s", d.Action)
 	}
-	tf_outputs, err := TerraformOutputs(key)
+
+	if err := tf.saveState(c); err != nil {
+		return nil, fmt.Errorf("Error Reading Terraform State: %w", err)
+	}
+	tf_outputs, sensitive, err := TerraformOutputs(c, bin, key)
 	if err != nil {
-		l.ErrorLogger(fmt.Errorf("Error Parsing Terraform Outputs"))
+		return nil, fmt.Errorf("Error Reading Terraform Outputs: %w", err)
+	}
+	for _, name := range sensitive {
+		addSecrets(r, tf_outputs[name])
 	}
 	return tf_outputs, nil
 }
 
-func TerraformState(key string) (*State, error) {
-	cmd := exec.Command("terraform", "state", "pull")
-	dir := filepath.Join(".", "terraform", key)
+// planArgs turns the deployment's var file, vars and targets into plan flags.
+func planArgs(d structures.Deployment) []string {
+	args := []string{}
+	if d.VarFile != "" {
+		args = append(args, "-var-file="+d.VarFile)
+	}
+	for _, k := range sortedKeys(d.Vars) {
+		args = append(args, "-var", k+"="+d.Vars[k])
+	}
+	for _, t := range d.Targets {
+		args = append(args, "-target="+t)
+	}
+	return args
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TerraformState pulls the state of the configuration in dir with the
+// terraform CLI bin. A workspace without state returns an empty State.
+func TerraformState(c context.Context, bin string, dir string) (*State, error) {
+	cmd := exec.CommandContext(c, bin, "state", "pull")
 	cmd.Dir = dir
 
 	out, err := cmd.Output()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("terraform state pull failed: %w", err)
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return &State{}, nil
 	}
 	return ParseState(out)
 }
 
-func TerraformPull(repo string, r *structures.RunInfo, l *logging.Config) (string, error) {
-	targetDir := filepath.Join(r.RunDir, "terraform", "repo")
+func TerraformPull(c context.Context, repo string, targetDir string, l *logging.Config) (string, error) {
 	owner, repo, err := utils.ParseGitHubRepo(repo)
 	if err != nil {
 		return "", err
 	}
 
-	token, err := githubapp.InstallationTokenForRepo(context.Background(), owner, repo)
+	token, err := githubapp.InstallationTokenForRepo(c, owner, repo)
 	if err != nil {
 		return "", err
 	}
 
-	repoURL := fmt.Sprintf("https://x-access-token:%s@github.com/AlexSTJO/%s", token, repo)
-	cmd := exec.Command("git", "clone", repoURL, targetDir)
-	_, err = cmd.CombinedOutput()
+	repoURL := fmt.Sprintf("https://x-access-token:%s@github.com/%s/%s", token, owner, repo)
+	cmd := exec.CommandContext(c, "git", "clone", repoURL, targetDir)
+	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("git clone failed: %w: %s", err, strings.ReplaceAll(strings.TrimSpace(string(out)), token, "***"))
 	}
-	l.InfoLogger("Terraform Repo Cloned Successfully")
+	l.InfoLogger("Repo Cloned Successfully")
 
 	return targetDir, nil
 
 }
 
-func TerraformInit(key string) error {
-	cmd := exec.Command("terraform", "init", "-input=false", "-no-color")
+// tfWorkspace runs terraform in one deployment's working directory. Plans
+// are saved to artifacts as tfplan, with their output as plan.txt.
+type tfWorkspace struct {
+	name      string
+	bin       string
+	dir       string
+	artifacts string
+	d         structures.Deployment
+	r         *structures.RunInfo
+	l         *logging.Config
+}
+
+func (tf *tfWorkspace) command(c context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(c, tf.bin, args...)
+	cmd.Dir = tf.dir
+	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1", "TF_INPUT=0")
+	utils.KillProcessGroup(cmd)
+	return cmd
+}
 
-	cmd.Dir = key
-	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1")
+// run streams the command's output to the run log.
+func (tf *tfWorkspace) run(c context.Context, extra io.Writer, args ...string) error {
+	return stream(c, tf.command(c, args...), tf.l, extra)
+}
 
-	_, err := cmd.CombinedOutput()
+func (tf *tfWorkspace) init(c context.Context, backend map[string]string) error {
+	args := []string{"init", "-input=false", "-no-color"}
+	for _, k := range sortedKeys(backend) {
+		args = append(args, "-backend-config="+k+"="+backend[k])
+	}
 
+	cmd := tf.command(c, args...)
+	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("terraform_init failed: %w", err)
+		return fmt.Errorf("terraform_init failed: %w: %s", err, strings.TrimSpace(string(out)))
 	}
-
 	return nil
 }
 
-func TerraformPlan(key string, var_file string) (bool, error) {
-	cmd := exec.Command("terraform", "plan", "-detailed-exitcode", "-input=false", "-var-file="+var_file, "-no-color")
-	cmd.Dir = key
-	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1")
+func (tf *tfWorkspace) selectWorkspace(c context.Context, name string) error {
+	cmd := tf.command(c, "workspace", "select", "-or-create", name)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("terraform workspace select failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
 
-	_, err := cmd.CombinedOutput()
+// plan saves a plan and reports whether it has changes.
+func (tf *tfWorkspace) plan(c context.Context, extra []string) (bool, error) {
+	if err := os.MkdirAll(tf.artifacts, 0o755); err != nil {
+		return false, fmt.Errorf("Error creating plan dir: %w", err)
+	}
+	f, err := os.Create(filepath.Join(tf.artifacts, "plan.txt"))
+	if err != nil {
+		return false, fmt.Errorf("Error creating plan file: %w", err)
+	}
+	defer f.Close()
 
+	args := append([]string{"plan", "-detailed-exitcode", "-input=false", "-no-color", "-out=" + tf.planFile()}, extra...)
+	err = tf.run(c, f, args...)
 	if err == nil {
+		tf.l.InfoLogger(fmt.Sprintf("Terraform Plan Saved: %s", tf.planFile()))
 		return false, nil
 	}
 	var exitErr *exec.ExitError
 	if errors.As(err, &exitErr) {
 		switch exitErr.ExitCode() {
-		case 0:
-			return false, nil
 		case 2:
+			tf.l.InfoLogger(fmt.Sprintf("Terraform Plan Saved: %s", tf.planFile()))
 			return true, nil
 		default:
 			return false, fmt.Errorf("Terraform Plan failed with exit code %d: %w", exitErr.ExitCode(), err)
@@ -167,47 +295,137 @@ func TerraformPlan(key string, var_file string) (bool, error) {
 	return false, fmt.Errorf("running terraform plan: %w", err)
 }
 
-func ParseState(data []byte) (*State, error) {
-	var s State
-	if err := json.Unmarshal(data, &s); err != nil {
-		return nil, err
+// apply applies the saved plan, so exactly what was planned is changed.
+func (tf *tfWorkspace) apply(c context.Context) error {
+	if tf.d.RequireApproval {
+		if err := tf.approve(c); err != nil {
+			return err
+		}
 	}
-	return &s, nil
+	if err := tf.run(c, nil, "apply", "-input=false", "-no-color", tf.planFile()); err != nil {
+		return fmt.Errorf(
+			"terraform apply failed status: %w", err)
+	}
+	return nil
 }
 
-func TerraformApply(key string, var_file string) error {
-	cmd := exec.Command("terraform", "apply", "-auto-approve", "-input=false", "-var-file="+var_file)
-	cmd.Dir = key
+// approve waits for someone to approve the saved plan.
+func (tf *tfWorkspace) approve(c context.Context) error {
+	return approvePlan(c, tf.name, tf.artifacts, tf.d, tf.r, tf.l)
+}
 
-	_, err := cmd.CombinedOutput()
+// saveState keeps the workspace's state with the run, where ${tfstate:...}
+// references read it.
+func (tf *tfWorkspace) saveState(c context.Context) error {
+	state, err := TerraformState(c, tf.bin, tf.dir)
 	if err != nil {
-		return fmt.Errorf(
-			"terraform apply failed status: %w", err)
+		return err
 	}
-	return nil
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tf.artifacts, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(tf.artifacts, stateFile), data, 0o600)
 }
 
-func TerraformOutputs(key string) (map[string]string, error) {
-	cmd := exec.Command("terraform", "output", "-json")
-	cmd.Dir = key
+func (tf *tfWorkspace) planFile() string {
+	abs, err := filepath.Abs(filepath.Join(tf.artifacts, "tfplan"))
+	if err != nil {
+		return filepath.Join(tf.artifacts, "tfplan")
+	}
+	return abs
+}
 
-	out, err := cmd.CombinedOutput()
+// stream runs cmd with its output written to the run log, and to extra when
+// it is set.
+func stream(c context.Context, cmd *exec.Cmd, l *logging.Config, extra io.Writer) error {
+	w := &lineLogger{l: l}
+	var out io.Writer = w
+	if extra != nil {
+		out = io.MultiWriter(w, extra)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	w.Flush()
+	if c.Err() != nil {
+		return c.Err()
+	}
+	return err
+}
+
+// lineLogger writes each complete line it is given to the run log.
+type lineLogger struct {
+	l   *logging.Config
+	buf []byte
+}
+
+func (w *lineLogger) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.l.ShellLogger(string(w.buf[:i+1]))
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush logs whatever is left after the last newline.
+func (w *lineLogger) Flush() {
+	if len(w.buf) > 0 {
+		w.l.ShellLogger(string(w.buf) + "\n")
+		w.buf = nil
+	}
+}
+
+func ParseState(data []byte) (*State, error) {
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// TerraformOutputs reads the outputs of the configuration in dir with the
+// terraform CLI bin, along with the names of the sensitive ones. String
+// outputs are kept as they are; lists, maps, numbers and bools are JSON
+// encoded, so ${infra:deployment.output.key} can reach inside them.
+func TerraformOutputs(c context.Context, bin string, dir string) (map[string]string, []string, error) {
+	cmd := exec.CommandContext(c, bin, "output", "-json")
+	cmd.Dir = dir
+
+	out, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("decode terraform outputs: %w", err)
+		return nil, nil, fmt.Errorf("terraform output failed: %w", err)
 	}
 	var parsed map[string]tfOutputValue
 	if err := json.Unmarshal(out, &parsed); err != nil {
-		return nil, fmt.Errorf("Unparsable terraform output: %w", err)
+		return nil, nil, fmt.Errorf("Unparsable terraform output: %w", err)
 	}
 
 	outputs := make(map[string]string, len(parsed))
+	sensitive := []string{}
 	for name, v := range parsed {
-		outputs[name] = v.Value
+		value, err := outputString(v.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unparsable value of terraform output %s: %w", name, err)
+		}
+		outputs[name] = value
+		if v.Sensitive {
+			sensitive = append(sensitive, name)
+		}
 	}
+	sort.Strings(sensitive)
 
-	return outputs, nil
+	return outputs, sensitive, nil
 }
 
 func init() {
-	registry["terraform"] = &Terraform{}
+	registry[structures.ServiceTerraform] = &Terraform{Service: structures.ServiceTerraform, Binary: "terraform"}
+	registry[structures.ServiceOpenTofu] = &Terraform{Service: structures.ServiceOpenTofu, Binary: "tofu"}
 }
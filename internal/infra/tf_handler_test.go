@@ -0,0 +1,126 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// fakeTofu plans one change, saving the plan file it is given, and reports
+// a state and outputs with sensitive values in them.
+const fakeTofu = `
+case "$1" in
+	plan)
+		echo "Plan: 1 to add, 0 to change, 0 to destroy."
+		for a in "$@"; do
+			case "$a" in -out=*) echo plan > "${a#-out=}" ;; esac
+		done
+		exit 2 ;;
+	apply)
+		echo "Apply complete! Resources: 1 added." ;;
+	state)
+		echo '{"version":4,"resources":[{"mode":"managed","type":"aws_db_instance","name":"db","instances":[{"attributes":{"id":"db-1","password":"s3cret-db"},"sensitive_attributes":[[{"type":"get_attr","value":"password"}]]}]}]}' ;;
+	output)
+		echo '{"bucket":{"sensitive":false,"type":"string","value":"b-1"},"subnets":{"sensitive":false,"type":["list","string"],"value":["s-a","s-b"]},"port":{"sensitive":false,"type":"number","value":8080},"db_password":{"sensitive":true,"type":"string","value":"hunter2-pw"}}' ;;
+esac
+`
+
+func TestOpenTofu(t *testing.T) {
+	calls := fakeCLI(t, "tofu", fakeTofu)
+	r := newTestRun(t)
+	outputs, err := registry[structures.ServiceOpenTofu].Call(context.Background(), "app", structures.Deployment{
+		Service:       structures.ServiceOpenTofu,
+		Action:        structures.ActionSync,
+		Repo:          "octo/infra",
+		BackendConfig: map[string]string{"key": "app.tfstate", "bucket": "state"},
+		Vars:          map[string]string{"region": "eu-west-1"},
+		Targets:       []string{"aws_s3_bucket.site"},
+	}, r, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"bucket": "b-1", "subnets": `["s-a","s-b"]`, "port": "8080", "db_password": "hunter2-pw"}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("outputs = %v, want %v", outputs, want)
+	}
+	if got := r.Secrets.Redact("password hunter2-pw"); got != "password "+logging.Mask {
+		t.Errorf("sensitive output is not redacted: %q", got)
+	}
+
+	base := filepath.Join(r.RunDir, "terraform", "app")
+	planFile := filepath.Join(base, "tfplan")
+	wantCalls := []string{
+		"init -input=false -no-color -backend-config=bucket=state -backend-config=key=app.tfstate",
+		"plan -detailed-exitcode -input=false -no-color -out=" + planFile + " -var region=eu-west-1 -target=aws_s3_bucket.site",
+		"apply -input=false -no-color " + planFile,
+		"state pull",
+		"output -json",
+	}
+	if got := readCalls(t, calls); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("tofu calls = %q, want %q", got, wantCalls)
+	}
+
+	plan, err := os.ReadFile(filepath.Join(base, "plan.txt"))
+	if err != nil || !strings.Contains(string(plan), "Plan: 1 to add") {
+		t.Errorf("plan.txt = %q (%v), want the plan output", plan, err)
+	}
+	data, err := os.ReadFile(filepath.Join(base, stateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Resources) != 1 || state.Resources[0].Type != "aws_db_instance" {
+		t.Errorf("saved state = %+v, want the pulled state", state)
+	}
+}
+
+func TestOpenTofuActions(t *testing.T) {
+	tests := []struct {
+		action  string
+		calls   []string
+		outputs bool
+	}{
+		{structures.ActionPlan, []string{"init", "plan", "state", "output"}, true},
+		{structures.ActionApply, []string{"init", "plan", "apply", "state", "output"}, true},
+		{structures.ActionDestroy, []string{"init", "plan -destroy", "apply"}, false},
+		{structures.ActionRefresh, []string{"init", "plan -refresh-only", "apply", "state", "output"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			calls := fakeCLI(t, "tofu", fakeTofu)
+			r := newTestRun(t)
+			outputs, err := registry[structures.ServiceOpenTofu].Call(context.Background(), "app", structures.Deployment{
+				Service: structures.ServiceOpenTofu,
+				Action:  tt.action,
+				Repo:    "octo/infra",
+			}, r, testLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := readCalls(t, calls)
+			if len(got) != len(tt.calls) {
+				t.Fatalf("tofu calls = %q, want %d calls", got, len(tt.calls))
+			}
+			for i, call := range tt.calls {
+				command, flag, _ := strings.Cut(call, " ")
+				if !strings.HasPrefix(got[i], command+" ") || !strings.Contains(got[i], flag) {
+					t.Errorf("call %d = %q, want %q", i, got[i], call)
+				}
+			}
+			if (len(outputs) > 0) != tt.outputs {
+				t.Errorf("outputs = %v, want outputs %v", outputs, tt.outputs)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package infra
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// stateFile is where each deployment's state is kept in its run directory.
+const stateFile = "state.json"
+
+// LookupState resolves a ${tfstate:...} reference against the state of
+// every terraform deployment that ran so far. Attributes Terraform marks as
+// sensitive are masked in the run's logs.
+func LookupState(r *structures.RunInfo, addr structures.StateAddress) (any, bool, error) {
+	if r == nil || r.RunDir == "" {
+		return nil, false, nil
+	}
+	files, err := filepath.Glob(filepath.Join(r.RunDir, "terraform", "*", stateFile))
+	if err != nil {
+		return nil, false, err
+	}
+	sort.Strings(files)
+
+	var (
+		value   any
+		secrets []any
+		found   string
+	)
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, false, fmt.Errorf("Error reading terraform state: %w", err)
+		}
+		state, err := ParseState(data)
+		if err != nil {
+			return nil, false, fmt.Errorf("Unparsable terraform state %s: %w", f, err)
+		}
+		v, sensitive, ok := state.lookup(addr)
+		if !ok {
+			continue
+		}
+		deployment := filepath.Base(filepath.Dir(f))
+		if found != "" {
+			return nil, false, fmt.Errorf("Resource %s.%s is in the state of both '%s' and '%s'", addr.Type, addr.Name, found, deployment)
+		}
+		value, secrets, found = v, sensitive, deployment
+	}
+	for _, v := range secrets {
+		addSecrets(r, v)
+	}
+	return value, found != "", nil
+}
+
+// lookup finds the resource at addr, picks its instance and walks the
+// attribute path. sensitive holds the sensitive attributes the value
+// contains.
+func (s *State) lookup(addr structures.StateAddress) (v any, sensitive []any, found bool) {
+	for _, res := range s.Resources {
+		mode := res.Mode
+		if mode == "" {
+			mode = "managed"
+		}
+		if res.Module != addr.Module || mode != addr.Mode || res.Type != addr.Type || res.Name != addr.Name {
+			continue
+		}
+		inst, path, ok := res.instance(addr.Path)
+		if !ok {
+			return nil, nil, false
+		}
+		v, ok := structures.LookupPath(inst.Attributes, path)
+		if !ok {
+			return nil, nil, false
+		}
+		if len(path) > 0 {
+			if inst.sensitive(path[0].Key) {
+				sensitive = append(sensitive, v)
+			}
+			return v, sensitive, true
+		}
+		for k, attr := range inst.Attributes {
+			if inst.sensitive(k) {
+				sensitive = append(sensitive, attr)
+			}
+		}
+		return v, sensitive, true
+	}
+	return nil, nil, false
+}
+
+// instance picks the instance path starts with: [n] for count, the key for
+// for_each, and otherwise the only instance.
+func (res Resource) instance(path []structures.PathSegment) (Instance, []structures.PathSegment, bool) {
+	if len(path) > 0 {
+		for _, inst := range res.Instances {
+			switch k := inst.IndexKey.(type) {
+			case float64:
+				if path[0].IsIndex && int(k) == path[0].Index {
+					return inst, path[1:], true
+				}
+			case string:
+				if !path[0].IsIndex && k == path[0].Key {
+					return inst, path[1:], true
+				}
+			}
+		}
+	}
+	if len(res.Instances) == 1 && res.Instances[0].IndexKey == nil {
+		return res.Instances[0], path, true
+	}
+	return Instance{}, nil, false
+}
+
+// sensitive reports whether Terraform marked the attribute as sensitive.
+// When sensitive_attributes is in a shape this doesn't know, every attribute
+// is treated as sensitive.
+func (inst Instance) sensitive(attr string) bool {
+	if len(inst.SensitiveAttributes) == 0 {
+		return false
+	}
+	var paths [][]struct {
+		Type  string `json:"type"`
+		Value any    `json:"value"`
+	}
+	if err := json.Unmarshal(inst.SensitiveAttributes, &paths); err != nil {
+		return true
+	}
+	for _, p := range paths {
+		if len(p) > 0 && p[0].Type == "get_attr" && p[0].Value == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// addSecrets masks v, and every value inside it, in the run's logs and
+// outputs.
+func addSecrets(r *structures.RunInfo, v any) {
+	if r == nil {
+		return
+	}
+	switch t := v.(type) {
+	case string:
+		var decoded any
+		if json.Unmarshal([]byte(t), &decoded) == nil {
+			if _, ok := decoded.(string); !ok {
+				addSecrets(r, decoded)
+			}
+		}
+	case map[string]any:
+		for _, e := range t {
+			addSecrets(r, e)
+		}
+	case []any:
+		for _, e := range t {
+			addSecrets(r, e)
+		}
+	}
+	r.Secrets.Add(structures.FormatValue(v))
+}
+
+func init() {
+	structures.StateLookup = LookupState
+}
@@ -15,6 +15,7 @@ type Config struct {
 	DisableLogging bool
 	LogPath        string
 	logFile        *os.File
+	redactor       *Redactor
 }
 
 type LogLine struct {
@@ -60,25 +61,33 @@ func New(disable_logging bool, name string, run_id string, run_dir string) *Conf
 	return c
 }
 
+// SetRedactor masks the redactor's values in everything logged from now on.
+func (c *Config) SetRedactor(r *Redactor) {
+	c.redactor = r
+}
+
 func (c *Config) ErrorLogger(e error) {
+	msg := c.redactor.Redact(e.Error())
 	if c.NoColor {
-		fmt.Printf(timeStamp().Format(time.TimeOnly)+"  ERROR    "+" %v\n", e)
+		fmt.Printf(timeStamp().Format(time.TimeOnly)+"  ERROR    "+" %v\n", msg)
 	} else {
-		red.Printf(timeStamp().Format(time.TimeOnly)+"  ERROR    "+" %v\n", e)
+		red.Printf(timeStamp().Format(time.TimeOnly)+"  ERROR    "+" %v\n", msg)
 	}
 
 	if !c.DisableLogging {
-		c.PipeLogsToFile("ERROR", e.Error())
+		c.PipeLogsToFile("ERROR", msg)
 	}
 }
 
 func (c *Config) InfoLogger(s string) {
+	s = c.redactor.Redact(s)
 	fmt.Printf(timeStamp().Format(time.TimeOnly)+"  INFO     "+" %v\n", s)
 	if !c.DisableLogging {
 		c.PipeLogsToFile("INFO", s)
 	}
 }
 func (c *Config) SuccessLogger(s string) {
+	s = c.redactor.Redact(s)
 	if c.NoColor {
 		fmt.Printf(timeStamp().Format(time.TimeOnly)+"  SUCCESS  "+" %v\n", s)
 	} else {
@@ -92,6 +101,7 @@ func (c *Config) SuccessLogger(s string) {
 }
 
 func (c *Config) ShellLogger(s string) {
+	s = c.redactor.Redact(s)
 	if c.NoColor {
 		fmt.Printf(timeStamp().Format(time.TimeOnly)+"  SHELL    "+" %v", s)
 	} else {
@@ -105,6 +115,7 @@ func (c *Config) ShellLogger(s string) {
 }
 
 func (c *Config) WarnLogger(s string) {
+	s = c.redactor.Redact(s)
 	if c.NoColor {
 		fmt.Printf(timeStamp().Format(time.TimeOnly)+"  WARN     "+" %v\n", s)
 	} else {
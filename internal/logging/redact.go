@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const Mask = "********"
+
+// minSecretLen keeps very short values, which would mask ordinary text all
+// over the logs, out of the redactor.
+const minSecretLen = 4
+
+// Redactor replaces known secret values with Mask. A nil Redactor leaves
+// text unchanged.
+type Redactor struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{values: map[string]bool{}}
+}
+
+// Add registers a value to mask.
+func (r *Redactor) Add(v string) {
+	if r == nil || len(v) < minSecretLen {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values[v] {
+		return
+	}
+	r.values[v] = true
+
+	// Longest first, so a secret containing another is masked whole.
+	values := make([]string, 0, len(r.values))
+	for s := range r.values {
+		values = append(values, s)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, s := range values {
+		pairs = append(pairs, s, Mask)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
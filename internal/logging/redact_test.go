@@ -0,0 +1,36 @@
+package logging
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	r := NewRedactor()
+	for _, v := range []string{"hunter2", "hunter2-extended", "abc", "", "s3cr3t"} {
+		r.Add(v)
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"nothing to hide", "nothing to hide"},
+		{"password=hunter2", "password=" + Mask},
+		{"token hunter2-extended", "token " + Mask},
+		{"hunter2 and s3cr3t, hunter2 again", Mask + " and " + Mask + ", " + Mask + " again"},
+		{"abc is too short to mask", "abc is too short to mask"},
+	}
+	for _, tt := range tests {
+		if got := r.Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNilRedactor(t *testing.T) {
+	var r *Redactor
+	r.Add("hunter2")
+	if got := r.Redact("hunter2"); got != "hunter2" {
+		t.Errorf("nil Redact = %q, want the text unchanged", got)
+	}
+	if got := NewRedactor().Redact("hunter2"); got != "hunter2" {
+		t.Errorf("empty Redact = %q, want the text unchanged", got)
+	}
+}
@@ -0,0 +1,219 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// DecodeParams resolves the placeholders in a task's parameters and decodes
+// them into out, a pointer to a struct whose fields are tagged with
+// `param:"name"`. Each parameter is converted to the type its spec declares
+// before it is assigned, so "5" works for an int and "30s" for a duration.
+func DecodeParams(c context.Context, t structures.Task, specs []structures.ParamSpec, out any, ctx *structures.Context, infra_outputs *map[string]map[string]string, r *structures.RunInfo) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("DecodeParams needs a pointer to a struct, got %T", out)
+	}
+	rv = rv.Elem()
+
+	fields := make(map[string]reflect.Value, rv.NumField())
+	for i := 0; i < rv.NumField(); i++ {
+		if name := rv.Type().Field(i).Tag.Get("param"); name != "" {
+			fields[name] = rv.Field(i)
+		}
+	}
+
+	for _, spec := range specs {
+		field, ok := fields[spec.Name]
+		if !ok {
+			continue
+		}
+
+		raw, ok := t.Parameters[spec.Name]
+		if !ok || raw == nil {
+			raw = spec.Default
+		}
+		if raw == nil {
+			if spec.Required {
+				return fmt.Errorf("missing parameter %q", spec.Name)
+			}
+			continue
+		}
+
+		resolved, err := ResolveAny(c, raw, ctx, infra_outputs, r)
+		if err != nil {
+			return fmt.Errorf("resolving %s: %w", spec.Name, err)
+		}
+
+		v, err := convertParam(spec.Type, resolved)
+		if err != nil {
+			return fmt.Errorf("parameter %q: %w", spec.Name, err)
+		}
+		if str, ok := v.(string); ok && !spec.Allows(str) {
+			return fmt.Errorf("parameter %q must be one of %s, got %q", spec.Name, strings.Join(spec.Allowed, ", "), str)
+		}
+
+		if err := assign(field, v); err != nil {
+			return fmt.Errorf("parameter %q: %w", spec.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// convertParam turns a resolved YAML value into the Go value for type p.
+func convertParam(p structures.ParamType, v any) (any, error) {
+	switch p {
+	case structures.ParamString:
+		switch v.(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("must be a string, got %T", v)
+		}
+		return structures.FormatValue(v), nil
+
+	case structures.ParamInt:
+		switch n := v.(type) {
+		case int:
+			return n, nil
+		case float64:
+			if n == float64(int(n)) {
+				return int(n), nil
+			}
+			return nil, fmt.Errorf("must be an int, got %v", n)
+		case json.Number:
+			i, err := strconv.Atoi(n.String())
+			if err != nil {
+				return nil, fmt.Errorf("must be an int, got %s", n)
+			}
+			return i, nil
+		case string:
+			i, err := strconv.Atoi(n)
+			if err != nil {
+				return nil, fmt.Errorf("must be an int, got %q", n)
+			}
+			return i, nil
+		}
+		return nil, fmt.Errorf("must be an int, got %T", v)
+
+	case structures.ParamBool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			if err != nil {
+				return nil, fmt.Errorf("must be a bool, got %q", b)
+			}
+			return parsed, nil
+		}
+		return nil, fmt.Errorf("must be a bool, got %T", v)
+
+	case structures.ParamDuration:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a duration like 30s or 5m, got %T", v)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q (use format like 5s, 1m, 500ms)", s)
+		}
+		return d, nil
+
+	case structures.ParamList:
+		switch l := v.(type) {
+		case []any:
+			return l, nil
+		case []string:
+			out := make([]any, len(l))
+			for i, s := range l {
+				out[i] = s
+			}
+			return out, nil
+		}
+		return nil, fmt.Errorf("must be a list, got %T", v)
+
+	case structures.ParamMap:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("must be a map, got %T", v)
+		}
+		return m, nil
+	}
+
+	return v, nil
+}
+
+// assign stores v in field, narrowing lists and maps to []string and
+// map[string]string when that is what the field holds.
+func assign(field reflect.Value, v any) error {
+	if field.Type() == durationType {
+		d, ok := v.(time.Duration)
+		if !ok {
+			return fmt.Errorf("field is a duration but the spec type is not")
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Interface:
+		field.Set(reflect.ValueOf(v))
+		return nil
+
+	case reflect.Slice:
+		l, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("cannot assign %T to %s", v, field.Type())
+		}
+		if field.Type().Elem().Kind() == reflect.String {
+			out := make([]string, len(l))
+			for i, item := range l {
+				s, ok := item.(string)
+				if !ok {
+					return fmt.Errorf("item %d must be a string, got %T", i, item)
+				}
+				out[i] = s
+			}
+			field.Set(reflect.ValueOf(out))
+			return nil
+		}
+		field.Set(reflect.ValueOf(l))
+		return nil
+
+	case reflect.Map:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("cannot assign %T to %s", v, field.Type())
+		}
+		if field.Type().Elem().Kind() == reflect.String {
+			out := make(map[string]string, len(m))
+			for k, item := range m {
+				switch item.(type) {
+				case map[string]any, []any:
+					return fmt.Errorf("value of %q must be a scalar, got %T", k, item)
+				}
+				out[k] = structures.FormatValue(item)
+			}
+			field.Set(reflect.ValueOf(out))
+			return nil
+		}
+		field.Set(reflect.ValueOf(m))
+		return nil
+	}
+
+	val := reflect.ValueOf(v)
+	if !val.Type().AssignableTo(field.Type()) {
+		return fmt.Errorf("cannot assign %T to %s", v, field.Type())
+	}
+	field.Set(val)
+	return nil
+}
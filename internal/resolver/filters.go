@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// applyFilters runs v through the placeholder's filters from left to right.
+// Names and argument counts were checked by structures.ParsePlaceholder.
+func applyFilters(ph structures.Placeholder, v any) (any, error) {
+	for _, f := range ph.Filters {
+		var err error
+		v, err = applyFilter(f, v)
+		if err != nil {
+			return nil, fmt.Errorf("Filter '%s' in %s: %w", f.Name, ph.Raw, err)
+		}
+	}
+	return v, nil
+}
+
+func applyFilter(f structures.Filter, v any) (any, error) {
+	switch f.Name {
+	case "default":
+		if v == nil || structures.FormatValue(v) == "" {
+			return f.Args[0], nil
+		}
+		return v, nil
+	case "format":
+		t, err := toTime(v)
+		if err != nil {
+			return nil, err
+		}
+		return t.Format(f.Args[0]), nil
+	case "upper":
+		return strings.ToUpper(structures.FormatValue(v)), nil
+	case "lower":
+		return strings.ToLower(structures.FormatValue(v)), nil
+	case "trim":
+		return strings.TrimSpace(structures.FormatValue(v)), nil
+	case "replace":
+		return strings.ReplaceAll(structures.FormatValue(v), f.Args[0], f.Args[1]), nil
+	case "sha256":
+		sum := sha256.Sum256([]byte(structures.FormatValue(v)))
+		return hex.EncodeToString(sum[:]), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString([]byte(structures.FormatValue(v))), nil
+	case "json":
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case "join":
+		sep := ","
+		if len(f.Args) == 1 {
+			sep = f.Args[0]
+		}
+		switch t := v.(type) {
+		case []string:
+			return strings.Join(t, sep), nil
+		case []any:
+			parts := make([]string, len(t))
+			for i, item := range t {
+				parts[i] = structures.FormatValue(item)
+			}
+			return strings.Join(parts, sep), nil
+		}
+		return nil, fmt.Errorf("expected a list, got %T", v)
+	}
+	return nil, fmt.Errorf("unknown filter")
+}
+
+// toTime accepts timestamps and RFC 3339 strings so format works on values
+// read back from task outputs.
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("'%s' is not an RFC 3339 timestamp", t)
+		}
+		return parsed, nil
+	}
+	return time.Time{}, fmt.Errorf("expected a timestamp, got %T", v)
+}
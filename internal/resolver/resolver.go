@@ -1,50 +1,32 @@
 package resolver
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/AlexSTJO/flume/internal/secrets"
 	"github.com/AlexSTJO/flume/internal/structures"
 )
 
 var placeholderRE = regexp.MustCompile(`\$\{([^}]+)\}`)
 
-func ResolveString(s string, ctx *structures.Context, infra_outputs *map[string]map[string]string, r *structures.RunInfo) (string, error) {
+func ResolveString(c context.Context, s string, ctx *structures.Context, infra_outputs *map[string]map[string]string, r *structures.RunInfo) (string, error) {
 	var e error
 	result := placeholderRE.ReplaceAllStringFunc(s, func(m string) string {
-		key := strings.TrimSpace(m[2 : len(m)-1])
-
-		parts := strings.SplitN(key, ":", 2)
-		switch parts[0] {
-		case "context":
-			{
-				keys := strings.SplitN(parts[1], ".", 2)
-				values := ctx.GetEventValues(keys[0])
-				result := values[keys[1]]
-
-				return result
-			}
-		case "infra":
-			keys := strings.SplitN(parts[1], ".", 2)
-			return ((*infra_outputs)[keys[0]][keys[1]])
-		case "env":
-			{
-				return os.Getenv(parts[1])
-			}
-		case "param":
-			if r != nil && r.Params != nil {
-				if val, ok := r.Params[parts[1]]; ok {
-					return val
-				}
+		v, err := resolveRef(c, m, ctx, infra_outputs, r)
+		if err != nil {
+			if e == nil {
+				e = err
 			}
-			e = fmt.Errorf("Unknown parameter: %s", parts[1])
 			return "ERROR"
 		}
-
-		e = fmt.Errorf("Invalid Reference: %s", s)
-		return "ERROR"
+		return structures.FormatValue(v)
 	})
 
 	if e != nil {
@@ -54,20 +36,205 @@ func ResolveString(s string, ctx *structures.Context, infra_outputs *map[string]
 	return result, nil
 }
 
-func ResolveStringParam(v string, ctx *structures.Context, infra *map[string]map[string]string, r *structures.RunInfo) (string, error) {
-	v, err := ResolveString(v, ctx, infra, r)
+// ResolveValue resolves s keeping the type of the referenced value when s is
+// exactly one placeholder, so a list output stays a list. Anything else is
+// interpolated into a string.
+func ResolveValue(c context.Context, s string, ctx *structures.Context, infra_outputs *map[string]map[string]string, r *structures.RunInfo) (any, error) {
+	if loc := placeholderRE.FindStringIndex(s); loc != nil && loc[0] == 0 && loc[1] == len(s) {
+		return resolveRef(c, s, ctx, infra_outputs, r)
+	}
+	return ResolveString(c, s, ctx, infra_outputs, r)
+}
+
+// Exists reports whether the single placeholder ref points at a value: a task
+// output that was recorded, an infra output, a set environment variable, a
+// parameter passed to the run or a run built-in. Filters are ignored.
+func Exists(c context.Context, ref string, ctx *structures.Context, infra_outputs *map[string]map[string]string, r *structures.RunInfo) (bool, error) {
+	ph, err := structures.ParsePlaceholder(strings.TrimSpace(ref))
+	if err != nil {
+		return false, fmt.Errorf("Invalid Reference: %w", err)
+	}
+	ph.Optional = true
+	_, found, err := lookup(c, ph, ctx, infra_outputs, r)
+	return found, err
+}
+
+// resolveRef resolves a single ${namespace:key | filter ...} placeholder.
+func resolveRef(c context.Context, m string, ctx *structures.Context, infra_outputs *map[string]map[string]string, r *structures.RunInfo) (any, error) {
+	ph, err := structures.ParsePlaceholder(m)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Reference: %w", err)
+	}
+
+	v, found, err := lookup(c, ph, ctx, infra_outputs, r)
+	if err != nil {
+		return nil, err
+	}
+	if !found && !ph.Optional && !ph.HasFilter("default") {
+		if err := missingError(ph, ctx, infra_outputs); err != nil {
+			return nil, err
+		}
+	}
+
+	v, err = applyFilters(ph, v)
+	if ph.Namespace == "secret" && r != nil {
+		// Filters can derive new secrets, such as a base64 encoded token.
+		r.Secrets.Add(structures.FormatValue(v))
+	}
+	if t, ok := v.(time.Time); ok {
+		return structures.FormatValue(t), err
+	}
+	return v, err
+}
+
+// missingError explains why a required reference has no value. Environment
+// variables and run built-ins may legitimately be empty and return nil.
+func missingError(ph structures.Placeholder, ctx *structures.Context, infra_outputs *map[string]map[string]string) error {
+	switch ph.Namespace {
+	case "param":
+		return fmt.Errorf("Unknown parameter: %s", ph.Key)
+	case "trigger":
+		return fmt.Errorf("Unresolved reference %s: the run's trigger has no value '%s'", ph.Raw, ph.Key)
+	case "context":
+		task, path, _ := strings.Cut(ph.Key, ".")
+		if ctx == nil || ctx.GetOutputs(task) == nil {
+			return fmt.Errorf("Unresolved reference %s: task '%s' has no outputs (did it run?)", ph.Raw, task)
+		}
+		return fmt.Errorf("Unresolved reference %s: task '%s' has no output '%s'", ph.Raw, task, path)
+	case "infra":
+		deployment, output, _ := strings.Cut(ph.Key, ".")
+		if infra_outputs == nil || (*infra_outputs)[deployment] == nil {
+			return fmt.Errorf("Unresolved reference %s: deployment '%s' has no outputs", ph.Raw, deployment)
+		}
+		return fmt.Errorf("Unresolved reference %s: deployment '%s' has no output '%s'", ph.Raw, deployment, output)
+	case "tfstate":
+		return fmt.Errorf("Unresolved reference %s: no deployment's terraform state has it", ph.Raw)
+	}
+	return nil
+}
+
+// lookup returns the raw value a placeholder points at, before any filters.
+func lookup(c context.Context, ph structures.Placeholder, ctx *structures.Context, infra_outputs *map[string]map[string]string, r *structures.RunInfo) (any, bool, error) {
+	switch ph.Namespace {
+	case "context":
+		task, path, ok := strings.Cut(ph.Key, ".")
+		if !ok || task == "" || path == "" {
+			return nil, false, fmt.Errorf("Invalid Reference %s: expected ${context:task.key}", ph.Raw)
+		}
+		if ctx == nil {
+			return nil, false, nil
+		}
+		v, found, err := ctx.Lookup(task, path)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid Reference %s: %w", ph.Raw, err)
+		}
+		return v, found, nil
+	case "infra":
+		deployment, output, ok := strings.Cut(ph.Key, ".")
+		if !ok || deployment == "" || output == "" {
+			return nil, false, fmt.Errorf("Invalid Reference %s: expected ${infra:deployment.output}", ph.Raw)
+		}
+		segments, err := structures.ParseOutputPath(output)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid Reference %s: %w", ph.Raw, err)
+		}
+		if infra_outputs == nil || segments[0].IsIndex {
+			return nil, false, nil
+		}
+		v, found := (*infra_outputs)[deployment][segments[0].Key]
+		if !found || len(segments) == 1 {
+			return v, found, nil
+		}
+		// Lists and maps are stored as JSON.
+		var decoded any
+		if err := json.Unmarshal([]byte(v), &decoded); err != nil {
+			return nil, false, nil
+		}
+		nested, found := structures.LookupPath(decoded, segments[1:])
+		return nested, found, nil
+	case "tfstate":
+		addr, err := structures.ParseStateAddress(ph.Key)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid Reference %s: %w", ph.Raw, err)
+		}
+		if structures.StateLookup == nil {
+			return nil, false, nil
+		}
+		v, found, err := structures.StateLookup(r, addr)
+		if err != nil {
+			return nil, false, fmt.Errorf("Unresolved reference %s: %w", ph.Raw, err)
+		}
+		return v, found, nil
+	case "env":
+		v, found := os.LookupEnv(ph.Key)
+		return v, found, nil
+	case "param":
+		if r == nil {
+			return nil, false, nil
+		}
+		v, found := r.Params[ph.Key]
+		return v, found, nil
+	case "secret":
+		v, err := secrets.Lookup(c, ph.Key)
+		if errors.Is(err, secrets.ErrNotFound) && (ph.Optional || ph.HasFilter("default")) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("Unresolved reference %s: %w", ph.Raw, err)
+		}
+		if r != nil {
+			r.Secrets.Add(v)
+		}
+		return v, true, nil
+	case "trigger":
+		if r == nil {
+			return nil, false, nil
+		}
+		v, found := r.Event[ph.Key]
+		return v, found, nil
+	case "run":
+		if r == nil {
+			return nil, false, nil
+		}
+		var v string
+		switch ph.Key {
+		case "id":
+			v = r.RunID
+		case "dir":
+			v = r.RunDir
+		case "trigger":
+			v = r.Trigger
+		}
+		return v, v != "", nil
+	case "pipeline":
+		if r == nil || r.Pipeline == "" {
+			return nil, false, nil
+		}
+		return r.Pipeline, true, nil
+	case "timestamp":
+		if r != nil && !r.StartedAt.IsZero() {
+			return r.StartedAt, true, nil
+		}
+		return time.Now().UTC(), true, nil
+	}
+
+	return nil, false, fmt.Errorf("Invalid Reference: %s", ph.Raw)
+}
+
+func ResolveStringParam(c context.Context, v string, ctx *structures.Context, infra *map[string]map[string]string, r *structures.RunInfo) (string, error) {
+	v, err := ResolveString(c, v, ctx, infra, r)
 	return v, err
 }
 
-func ResolveAny(v any, ctx *structures.Context, infra *map[string]map[string]string, r *structures.RunInfo) (any, error) {
+func ResolveAny(c context.Context, v any, ctx *structures.Context, infra *map[string]map[string]string, r *structures.RunInfo) (any, error) {
 	switch typed := v.(type) {
 	case string:
-		return ResolveString(typed, ctx, infra, r)
+		return ResolveValue(c, typed, ctx, infra, r)
 
 	case map[string]any:
 		out := make(map[string]any, len(typed))
 		for k, val := range typed {
-			rv, err := ResolveAny(val, ctx, infra, r)
+			rv, err := ResolveAny(c, val, ctx, infra, r)
 			if err != nil {
 				return nil, err
 			}
@@ -77,7 +244,7 @@ func ResolveAny(v any, ctx *structures.Context, infra *map[string]map[string]str
 	case []any:
 		out := make([]any, len(typed))
 		for i, val := range typed {
-			rv, err := ResolveAny(val, ctx, infra, r)
+			rv, err := ResolveAny(c, val, ctx, infra, r)
 			if err != nil {
 				return nil, err
 			}
@@ -0,0 +1,189 @@
+package resolver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+func testRun(t *testing.T) (*structures.Context, *map[string]map[string]string, *structures.RunInfo) {
+	t.Helper()
+	secretsFile := filepath.Join(t.TempDir(), "secrets.env")
+	if err := os.WriteFile(secretsFile, []byte("API_TOKEN=hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FLUME_SECRETS_PROVIDER", "env")
+	t.Setenv("FLUME_SECRETS_DSN", secretsFile)
+	t.Setenv("FLUME_TEST_REGION", "eu-west-1")
+
+	ctx := structures.NewContext()
+	ctx.SetOutputs("api", map[string]any{
+		"status": 200,
+		"json": map[string]any{
+			"items": []any{map[string]any{"id": "a1"}, map[string]any{"id": "b2"}},
+			"tags":  []any{"x", "y"},
+		},
+	})
+	infra_outputs := map[string]map[string]string{
+		"network": {"vpc_id": "vpc-123", "subnets": `["s-1","s-2"]`},
+	}
+	r := &structures.RunInfo{
+		RunID:     "run-1",
+		RunDir:    "/tmp/run-1",
+		Pipeline:  "web",
+		Trigger:   "manual",
+		StartedAt: time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC),
+		Params:    map[string]string{"version": "v1.2", "branch": "feature/login", "empty": ""},
+		Event:     map[string]string{"ref": "refs/heads/main"},
+		Secrets:   logging.NewRedactor(),
+	}
+	return ctx, &infra_outputs, r
+}
+
+func TestResolveString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"app:${param:version}", "app:v1.2"},
+		{"${param:version | upper}", "V1.2"},
+		{"${param:branch | replace '/' -}", "feature-login"},
+		{"${param:missing? | default latest}", "latest"},
+		{"${param:missing | default latest}", "latest"},
+		{"${param:empty | default latest}", "latest"},
+		{"[${param:missing?}]", "[]"},
+		{"[${context:deploy.url?}]", "[]"},
+		{"[${infra:cluster.arn?}]", "[]"},
+		{"[${context:api.missing?}]", "[]"},
+		{"[${infra:network.missing?}]", "[]"},
+		{"${param:version | sha256}", "0e4f5bced9416bf31c463566c29768c6ca9dc6cdf89333f2b2cf33103188a1d5"},
+		{"${param:version | base64}", "djEuMg=="},
+		{"${context:api.status}", "200"},
+		{"${context:api.json.items[1].id}", "b2"},
+		{"${context:api.json.tags}", `["x","y"]`},
+		{"${context:api.json.tags | join}", "x,y"},
+		{`${context:api.json.tags | join " + "}`, "x + y"},
+		{"${context:api.json.tags | json}", `["x","y"]`},
+		{"${infra:network.vpc_id}", "vpc-123"},
+		{"${infra:network.subnets[1]}", "s-2"},
+		{"${env:FLUME_TEST_REGION}", "eu-west-1"},
+		{"${trigger:ref}", "refs/heads/main"},
+		{"${run:id}/${run:trigger}/${pipeline:name}", "run-1/manual/web"},
+		{"${timestamp}", "2026-03-04T05:06:07Z"},
+		{`${timestamp | format "2006-01-02"}`, "2026-03-04"},
+		{"${secret:API_TOKEN}", "hunter2"},
+		{"${secret:API_TOKEN | upper}", "HUNTER2"},
+		{"${secret:MISSING? | default none}", "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			ctx, infra_outputs, r := testRun(t)
+			got, err := ResolveString(context.Background(), tt.in, ctx, infra_outputs, r)
+			if err != nil {
+				t.Fatalf("ResolveString: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveString = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveStringErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"${param:missing}", "Unknown parameter: missing"},
+		{"${context:api.missing}", "task 'api' has no output 'missing'"},
+		{"${context:deploy.url}", "task 'deploy' has no outputs"},
+		{"${context:api}", "expected ${context:task.key}"},
+		{"${infra:network.missing}", "deployment 'network' has no output 'missing'"},
+		{"${infra:cluster.arn}", "deployment 'cluster' has no outputs"},
+		{"${trigger:sha}", "the run's trigger has no value 'sha'"},
+		{"${secret:MISSING}", "secret not found"},
+		{"${param:version | format '2006'}", "not an RFC 3339 timestamp"},
+		{"${param:version | join}", "expected a list"},
+		{"${param:version | shout}", "unknown filter"},
+		{"${nowhere:thing}", "Invalid Reference"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			ctx, infra_outputs, r := testRun(t)
+			_, err := ResolveString(context.Background(), tt.in, ctx, infra_outputs, r)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ResolveString error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestResolveValueKeepsTypes(t *testing.T) {
+	ctx, infra_outputs, r := testRun(t)
+	got, err := ResolveAny(context.Background(), map[string]any{
+		"tags":  "${context:api.json.tags}",
+		"first": "${context:api.json.items[0]}",
+		"label": "tags: ${context:api.json.tags}",
+		"count": 3,
+	}, ctx, infra_outputs, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"tags":  []any{"x", "y"},
+		"first": map[string]any{"id": "a1"},
+		"label": `tags: ["x","y"]`,
+		"count": 3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveAny = %#v, want %#v", got, want)
+	}
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	ctx, infra_outputs, r := testRun(t)
+	if _, err := ResolveString(context.Background(), "${secret:API_TOKEN | base64}", ctx, infra_outputs, r); err != nil {
+		t.Fatal(err)
+	}
+	got := r.Secrets.Redact("token hunter2 encoded aHVudGVyMg==")
+	if want := "token " + logging.Mask + " encoded " + logging.Mask; got != want {
+		t.Errorf("Redact = %q, want %q", got, want)
+	}
+}
+
+func TestExists(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"${param:version}", true},
+		{"${param:missing}", false},
+		{"${context:api.json.items[1].id}", true},
+		{"${context:api.json.items[5].id}", false},
+		{"${infra:network.vpc_id}", true},
+		{"${env:FLUME_TEST_REGION}", true},
+		{"${env:FLUME_TEST_UNSET}", false},
+		{"${secret:API_TOKEN}", true},
+		{"${secret:MISSING}", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			ctx, infra_outputs, r := testRun(t)
+			got, err := Exists(context.Background(), tt.ref, ctx, infra_outputs, r)
+			if err != nil {
+				t.Fatalf("Exists: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Exists = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// ResolveStaticString resolves the placeholders that are known before a run
+// starts (env, param and pipeline) and leaves the rest in place. It returns
+// the placeholders it could not resolve.
+func ResolveStaticString(s string, r *structures.RunInfo) (string, []string, error) {
+	return resolveStaticString(s, r, "")
+}
+
+// MaskStaticString is ResolveStaticString for values shown to someone who
+// must not see the environment, such as a plan served by the API: every env
+// placeholder becomes mask instead of its value.
+func MaskStaticString(s string, r *structures.RunInfo, mask string) (string, []string, error) {
+	return resolveStaticString(s, r, mask)
+}
+
+func resolveStaticString(s string, r *structures.RunInfo, mask string) (string, []string, error) {
+	var e error
+	unresolved := []string{}
+	result := placeholderRE.ReplaceAllStringFunc(s, func(m string) string {
+		ph, err := structures.ParsePlaceholder(m)
+		if err != nil {
+			e = fmt.Errorf("Invalid Reference: %w", err)
+			return m
+		}
+		if !staticNamespaces[ph.Namespace] {
+			unresolved = append(unresolved, m)
+			return m
+		}
+
+		v, found, err := lookup(context.Background(), ph, nil, nil, r)
+		if err == nil && !found && !ph.Optional && !ph.HasFilter("default") {
+			err = missingError(ph, nil, nil)
+		}
+		if err == nil {
+			v, err = applyFilters(ph, v)
+		}
+		if err != nil {
+			e = err
+			return m
+		}
+		if mask != "" && ph.Namespace == "env" {
+			return mask
+		}
+		return structures.FormatValue(v)
+	})
+
+	if e != nil {
+		return "", unresolved, e
+	}
+	return result, unresolved, nil
+}
+
+func ResolveStaticAny(v any, r *structures.RunInfo) (any, []string, error) {
+	return resolveStaticAny(v, r, "")
+}
+
+// MaskStaticAny is ResolveStaticAny with env placeholders masked, see
+// MaskStaticString.
+func MaskStaticAny(v any, r *structures.RunInfo, mask string) (any, []string, error) {
+	return resolveStaticAny(v, r, mask)
+}
+
+func resolveStaticAny(v any, r *structures.RunInfo, mask string) (any, []string, error) {
+	switch typed := v.(type) {
+	case string:
+		return resolveStaticString(typed, r, mask)
+	case map[string]any:
+		out := make(map[string]any, len(typed))
+		unresolved := []string{}
+		for k, val := range typed {
+			rv, u, err := resolveStaticAny(val, r, mask)
+			if err != nil {
+				return nil, nil, err
+			}
+			out[k] = rv
+			unresolved = append(unresolved, u...)
+		}
+		return out, unresolved, nil
+	case []any:
+		out := make([]any, len(typed))
+		unresolved := []string{}
+		for i, val := range typed {
+			rv, u, err := resolveStaticAny(val, r, mask)
+			if err != nil {
+				return nil, nil, err
+			}
+			out[i] = rv
+			unresolved = append(unresolved, u...)
+		}
+		return out, unresolved, nil
+	default:
+		return v, nil, nil
+	}
+}
+
+// staticNamespaces are the namespaces whose values are known before a run
+// starts.
+var staticNamespaces = map[string]bool{
+	"env":      true,
+	"param":    true,
+	"pipeline": true,
+}
+
+// ExistsStatic is Exists for the values known before a run starts. known is
+// false for task and infra outputs and for run built-ins.
+func ExistsStatic(ref string, r *structures.RunInfo) (bool, bool, error) {
+	ph, err := structures.ParsePlaceholder(strings.TrimSpace(ref))
+	if err != nil {
+		return false, true, fmt.Errorf("Invalid Reference: %w", err)
+	}
+	if !staticNamespaces[ph.Namespace] {
+		return false, false, nil
+	}
+	_, found, err := lookup(context.Background(), ph, nil, nil, r)
+	return found, true, err
+}
@@ -0,0 +1,46 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+)
+
+// EnvFile reads secrets from a dotenv style file, kept apart from .env so it
+// is never loaded into the process environment.
+type EnvFile struct {
+	path string
+}
+
+func init() {
+	registry["env"] = func(dsn string) (Provider, error) {
+		if dsn == "" {
+			dsn = filepath.Join(".", ".flume", ".secrets.env")
+		}
+		return &EnvFile{path: dsn}, nil
+	}
+}
+
+func (e *EnvFile) Name() string {
+	return "env"
+}
+
+// Get rereads the file on every call so edits apply without a restart. A
+// missing file holds no secrets.
+func (e *EnvFile) Get(c context.Context, name string) (string, error) {
+	values, err := godotenv.Read(e.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	v, ok := values[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
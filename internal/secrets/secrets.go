@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Provider looks up secret values by name.
+type Provider interface {
+	Name() string
+	Get(c context.Context, name string) (string, error)
+}
+
+// Store is a provider flume can also write to, managed with `flume secrets`.
+type Store interface {
+	Provider
+	Set(name, value string) error
+	Delete(name string) error
+	List() ([]string, error)
+}
+
+var ErrNotFound = errors.New("secret not found")
+
+var registry = map[string]func(dsn string) (Provider, error){}
+
+var (
+	mu     sync.Mutex
+	opened = map[openKey]Provider{}
+)
+
+// openKey identifies an opened provider. The same provider opened with a
+// different DSN, e.g. another SSM prefix, is a separate instance.
+type openKey struct {
+	name string
+	dsn  string
+}
+
+// Open returns the named provider, or the one configured by
+// FLUME_SECRETS_PROVIDER when name is empty. FLUME_SECRETS_DSN configures the
+// default provider; the others use their own defaults.
+func Open(name string) (Provider, error) {
+	dsn := ""
+	if name == "" {
+		name = strings.TrimSpace(os.Getenv("FLUME_SECRETS_PROVIDER"))
+		if name == "" {
+			name = "file"
+		}
+		dsn = strings.TrimSpace(os.Getenv("FLUME_SECRETS_DSN"))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	key := openKey{name: name, dsn: dsn}
+	if p, ok := opened[key]; ok {
+		return p, nil
+	}
+
+	open, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown secrets provider %q", name)
+	}
+	p, err := open(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening secrets provider %q: %w", name, err)
+	}
+	opened[key] = p
+	return p, nil
+}
+
+// Lookup resolves a ${secret:...} key. A key of the form provider:name reads
+// from that provider instead of the default one.
+func Lookup(c context.Context, key string) (string, error) {
+	provider, name := "", key
+	if p, rest, ok := strings.Cut(key, ":"); ok {
+		if _, known := registry[p]; known {
+			provider, name = p, rest
+		}
+	}
+
+	p, err := Open(provider)
+	if err != nil {
+		return "", err
+	}
+	v, err := p.Get(c, name)
+	if err != nil {
+		return "", fmt.Errorf("secret '%s' (%s): %w", name, p.Name(), err)
+	}
+	return v, nil
+}
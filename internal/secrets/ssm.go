@@ -0,0 +1,54 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// SSM reads SecureString parameters from AWS Systems Manager Parameter
+// Store. Secrets Manager secrets are read through Parameter Store's
+// /aws/reference/secretsmanager/<secret> paths.
+type SSM struct {
+	client *ssm.Client
+	prefix string
+}
+
+func init() {
+	registry["ssm"] = func(dsn string) (Provider, error) {
+		cfg, err := config.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return &SSM{client: ssm.NewFromConfig(cfg), prefix: dsn}, nil
+	}
+}
+
+func (s *SSM) Name() string {
+	return "ssm"
+}
+
+// Get prefixes name with the configured DSN unless it is already an absolute
+// parameter path.
+func (s *SSM) Get(c context.Context, name string) (string, error) {
+	if !strings.HasPrefix(name, "/") {
+		name = s.prefix + name
+	}
+	out, err := s.client.GetParameter(c, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	var missing *types.ParameterNotFound
+	if errors.As(err, &missing) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// launchRun is the server's structures.Launcher, used by trigger_pipeline
+// and after_pipeline triggers.
+func launchRun(req structures.LaunchRequest) (*structures.RunInfo, context.CancelFunc, error) {
+	name, _, _, err := structures.ParsePipelineRef(req.PipelineRef)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, err := structures.ChildChain(req.Parent, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	run_info, err := startRun(runRequest{
+		PipelineRef: req.PipelineRef,
+		Parameters:  req.Params,
+		event:       req.Event,
+		chain:       chain,
+	}, req.Trigger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return run_info, func() { runs.Cancel(run_info.RunID) }, nil
+}
+
+// triggerDownstream starts the after_pipeline pipelines waiting on the run
+// that just finished. They get its parameters, and its pipeline, run ID and
+// final state as ${trigger:...} values.
+func triggerDownstream(r *structures.RunInfo) {
+	metas, err := pipelineMetas()
+	if err != nil {
+		fmt.Printf("Error reading pipelines for downstream triggers: %v\n", err)
+		return
+	}
+
+	state := r.Status.State()
+	for _, pm := range metas {
+		t := pm.Trigger
+		if t.Type != structures.TriggerAfterPipeline || !pm.Enabled || !slices.Contains(t.Pipelines, r.Pipeline) || !whenMatches(t.When, state) {
+			continue
+		}
+		name := filepath.Base(filepath.Dir(pm.YamlPath))
+
+		child, _, err := launchRun(structures.LaunchRequest{
+			PipelineRef: name,
+			Params:      maps.Clone(r.Params),
+			Trigger:     structures.TriggerAfterPipeline,
+			Event: map[string]string{
+				"pipeline": r.Pipeline,
+				"run_id":   r.RunID,
+				"state":    string(state),
+			},
+			Parent: r,
+		})
+		if err != nil {
+			fmt.Printf("Pipeline %s not started after %s: %v\n", name, r.RunID, err)
+			continue
+		}
+		fmt.Printf("Started %s run %s after %s run %s (%s)\n", name, child.RunID, r.Pipeline, r.RunID, state)
+	}
+}
+
+func whenMatches(when string, state structures.RunState) bool {
+	switch when {
+	case structures.WhenAny:
+		return true
+	case structures.WhenFailure:
+		return state == structures.RunFailed
+	default:
+		return state == structures.RunSucceeded
+	}
+}
@@ -1,136 +1,199 @@
 package server
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
-	"io/fs"
-	"net/http"
-	"os"
+	"maps"
+	"math/rand/v2"
 	"path/filepath"
-	"strings"
+	"reflect"
+	"sync"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/AlexSTJO/flume/internal/structures"
 	"github.com/robfig/cron/v3"
 )
 
-type CronManager struct {
-	CronIDs map[string]cron.EntryID
-	Manager *cron.Cron
+// cronEntry is one pipeline's cron trigger. It remembers the last run it
+// started so the overlap policy can look at it.
+type cronEntry struct {
+	pipeline   string
+	spec       structures.TriggerSpec
+	expression string
+	id         cron.EntryID
+	jitter     time.Duration
+	overlap    string
+	stop       chan struct{}
+	start      func(runRequest, string) (*structures.RunInfo, error)
+
+	mu     sync.Mutex
+	last   *structures.RunInfo
+	queued bool
 }
 
-func CronInit() (*CronManager, error) {
-	_ = godotenv.Load()
-	port := os.Getenv("PORT")
-	url := os.Getenv("URL")
-
-	requestUrl := fmt.Sprintf("http://%s:%s/run", url, port)
-	fmt.Println(requestUrl)
-
-	c := cron.New()
-
-	root := filepath.Join(".", ".flume")
-	cronIDs := make(map[string]cron.EntryID)
-	root = filepath.Clean(root)
-	rootDepth := strings.Count(root, string(os.PathSeparator))
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if d.IsDir() {
-			depth := strings.Count(path, string(os.PathSeparator))
-			if depth > rootDepth+1 {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		if filepath.Base(path) == "meta.json" {
-			b, err := os.ReadFile(path)
-			if err != nil {
-				return err
-			}
-
-			pm := &PipelineMeta{}
-			if err = json.Unmarshal(b, pm); err != nil {
-				return err
-			}
-
-			_, err, pm = SyncMeta(pm.YamlPath)
-			if err != nil {
-				return err
-			}
-
-			if pm.Trigger.Type == "cron" {
-				if err = validateCron(pm.Trigger.Cron); err != nil {
-					return err
-				}
-				fmt.Printf("Adding Flume: %s with expression: %s\n", pm.Name, pm.Trigger.Cron)
-				id, err := c.AddFunc(pm.Trigger.Cron, addEntry(pm, requestUrl))
-				if err != nil {
-					return err
-				}
-
-				cronIDs[pm.Name] = id
-			}
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-	fmt.Println("Started")
-	c.Start()
+// CronManager schedules every pipeline with a cron trigger.
+type CronManager struct {
+	mu      sync.Mutex
+	cron    *cron.Cron
+	entries map[string]*cronEntry
+	start   func(runRequest, string) (*structures.RunInfo, error)
+}
 
+func NewCronManager() *CronManager {
 	cm := &CronManager{
-		CronIDs: cronIDs,
-		Manager: c,
+		cron:    cron.New(),
+		entries: map[string]*cronEntry{},
+		start:   startRun,
 	}
-	return cm, nil
+	cm.cron.Start()
+	return cm
 }
 
-//fw detects meta change, check trigger if croncheck pm name -> c[name] id -> c.remove(id) -> c.addfunc -> update the map after
+// Sync schedules, reschedules or unschedules a pipeline after its metadata
+// changed. A pipeline whose cron trigger is unchanged keeps its entry, so
+// edits elsewhere in the file don't reset the overlap policy or drop a
+// queued run.
+func (cm *CronManager) Sync(pm *PipelineMeta) error {
+	name := filepath.Base(filepath.Dir(pm.YamlPath))
+	spec := pm.Trigger.spec()
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	old := cm.entries[name]
+	if old != nil && pm.Trigger.Type == structures.TriggerCron && pm.Enabled && reflect.DeepEqual(old.spec, spec) {
+		return nil
+	}
+	cm.remove(name)
+	if pm.Trigger.Type != structures.TriggerCron || !pm.Enabled {
+		return nil
+	}
 
-func (cm *CronManager) ResyncCron(p *PipelineMeta) error {
-	port := os.Getenv("PORT")
-	url := os.Getenv("URL")
+	schedule, err := structures.ParseCron(spec)
+	if err != nil {
+		return fmt.Errorf("Error scheduling %s: %w", name, err)
+	}
+	jitter, err := structures.CronJitter(spec)
+	if err != nil {
+		return fmt.Errorf("Error scheduling %s: %w", name, err)
+	}
 
-	requestUrl := fmt.Sprintf("http://%s:%s/run", url, port)
-	if err := validateCron(p.Trigger.Cron); err != nil {
-		return err
+	e := &cronEntry{
+		pipeline:   name,
+		spec:       spec,
+		expression: spec.CronExpression,
+		jitter:     jitter,
+		overlap:    spec.Overlap,
+		stop:       make(chan struct{}),
+		start:      cm.start,
 	}
-	id, ok := cm.CronIDs[p.Name]
-	if ok {
-		newID, err := cm.Manager.AddFunc(p.Trigger.Cron, addEntry(p, requestUrl))
-		if err != nil {
-			return err
-		}
-		cm.CronIDs[p.Name] = newID
-		cm.Manager.Remove(id)
-		fmt.Printf("Resynced %s's Cron to %s\n", p.Name, p.Trigger.Cron)
-		cm.Manager.Stop()
-		cm.Manager.Start()
+	// The new schedule still has to respect the run the old one started.
+	if old != nil {
+		old.mu.Lock()
+		e.last = old.last
+		old.mu.Unlock()
 	}
+	e.id = cm.cron.Schedule(schedule, cron.FuncJob(e.tick))
+	cm.entries[name] = e
+	fmt.Printf("Scheduled pipeline %s: %s (next run %s)\n", name, spec.CronExpression, schedule.Next(time.Now()).Format(time.RFC3339))
 	return nil
 }
 
-func validateCron(expression string) error {
-	_, err := cron.ParseStandard(expression)
-	return err
+// Remove unschedules a pipeline, e.g. after its yaml was deleted.
+func (cm *CronManager) Remove(name string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if _, ok := cm.entries[name]; ok {
+		cm.remove(name)
+		fmt.Printf("Unscheduled pipeline %s\n", name)
+	}
 }
 
-func addEntry(pm *PipelineMeta, requestUrl string) func() {
-	return func() {
-		jsonBody := []byte(fmt.Sprintf(`{"pipeline": "%s"}`, pm.Name))
+func (cm *CronManager) remove(name string) {
+	e, ok := cm.entries[name]
+	if !ok {
+		return
+	}
+	cm.cron.Remove(e.id)
+	close(e.stop)
+	delete(cm.entries, name)
+}
 
-		req, err := http.NewRequest(http.MethodPost, requestUrl, bytes.NewBuffer(jsonBody))
-		if err != nil {
+// tick runs on every scheduled time, in its own goroutine.
+func (e *cronEntry) tick() {
+	scheduled := time.Now()
+	if e.jitter > 0 {
+		select {
+		case <-time.After(rand.N(e.jitter)):
+		case <-e.stop:
 			return
 		}
+	}
 
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
+	e.mu.Lock()
+	if e.last != nil && !finished(e.last) {
+		switch e.overlap {
+		case structures.OverlapSkip:
+			fmt.Printf("Skipping scheduled run of %s: run %s is still going\n", e.pipeline, e.last.RunID)
+			e.mu.Unlock()
 			return
+		case structures.OverlapQueue:
+			if e.queued {
+				fmt.Printf("Skipping scheduled run of %s: a run is already queued behind %s\n", e.pipeline, e.last.RunID)
+				e.mu.Unlock()
+				return
+			}
+			e.queued = true
+			prev := e.last
+			e.mu.Unlock()
+			fmt.Printf("Queued scheduled run of %s behind run %s\n", e.pipeline, prev.RunID)
+			select {
+			case <-prev.Status.Done():
+			case <-e.stop:
+			}
+			e.mu.Lock()
+			e.queued = false
+			select {
+			case <-e.stop:
+				e.mu.Unlock()
+				return
+			default:
+			}
 		}
-		defer resp.Body.Close()
-		b, _ := io.ReadAll(resp.Body)
-		fmt.Println(string(b))
+	}
+	defer e.mu.Unlock()
+
+	values := map[string]string{
+		"scheduled":  scheduled.UTC().Format(time.RFC3339),
+		"expression": e.expression,
+	}
+	run_info, err := e.start(runRequest{
+		PipelineRef: e.pipeline,
+		Parameters:  maps.Clone(values),
+		event:       values,
+	}, structures.TriggerCron)
+	if err != nil {
+		fmt.Printf("Cron trigger for %s failed to start a run: %v\n", e.pipeline, err)
+		return
+	}
+	e.last = run_info
+	fmt.Printf("Cron trigger started %s run %s\n", e.pipeline, run_info.RunID)
+}
+
+func finished(r *structures.RunInfo) bool {
+	select {
+	case <-r.Status.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// spec rebuilds the cron part of the pipeline's trigger from its metadata.
+func (t Trigger) spec() structures.TriggerSpec {
+	return structures.TriggerSpec{
+		Type:           t.Type,
+		CronExpression: t.Cron,
+		Timezone:       t.Timezone,
+		Jitter:         t.Jitter,
+		Overlap:        t.Overlap,
 	}
 }
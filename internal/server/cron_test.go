@@ -0,0 +1,228 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// fakeStarts records the runs a cron entry starts. Each run stays running
+// until the test finishes it.
+type fakeStarts struct {
+	mu   sync.Mutex
+	runs []*structures.RunInfo
+	reqs []runRequest
+}
+
+func (f *fakeStarts) start(req runRequest, trigger string) (*structures.RunInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := &structures.RunInfo{RunID: fmt.Sprintf("%s-%d", req.PipelineRef, len(f.runs)), Trigger: trigger, Status: structures.NewRunStatus()}
+	r.Status.Start(nil)
+	f.runs = append(f.runs, r)
+	f.reqs = append(f.reqs, req)
+	return r, nil
+}
+
+func (f *fakeStarts) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.runs)
+}
+
+func running() *structures.RunInfo {
+	r := &structures.RunInfo{RunID: "previous", Status: structures.NewRunStatus()}
+	r.Status.Start(nil)
+	return r
+}
+
+func finishedRun() *structures.RunInfo {
+	r := running()
+	r.Status.Finish(nil)
+	return r
+}
+
+func newEntry(f *fakeStarts, overlap string, last *structures.RunInfo) *cronEntry {
+	return &cronEntry{
+		pipeline:   "nightly",
+		expression: "0 2 * * *",
+		overlap:    overlap,
+		stop:       make(chan struct{}),
+		start:      f.start,
+		last:       last,
+	}
+}
+
+func TestCronTick(t *testing.T) {
+	f := &fakeStarts{}
+	e := newEntry(f, structures.OverlapAllow, nil)
+	e.tick()
+
+	if f.count() != 1 {
+		t.Fatalf("started %d runs, want 1", f.count())
+	}
+	req := f.reqs[0]
+	if req.PipelineRef != "nightly" || req.event["expression"] != "0 2 * * *" || req.event["scheduled"] == "" {
+		t.Errorf("run request = %+v", req)
+	}
+	if f.runs[0].Trigger != structures.TriggerCron || e.last != f.runs[0] {
+		t.Errorf("run %+v was not recorded as the entry's last cron run", f.runs[0])
+	}
+}
+
+func TestCronOverlap(t *testing.T) {
+	tests := []struct {
+		overlap  string
+		previous *structures.RunInfo
+		want     int
+	}{
+		{structures.OverlapAllow, running(), 1},
+		{"", running(), 1},
+		{structures.OverlapSkip, running(), 0},
+		{structures.OverlapSkip, finishedRun(), 1},
+		{structures.OverlapQueue, finishedRun(), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overlap, func(t *testing.T) {
+			f := &fakeStarts{}
+			e := newEntry(f, tt.overlap, tt.previous)
+			e.tick()
+			if f.count() != tt.want {
+				t.Errorf("started %d runs, want %d", f.count(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCronQueue(t *testing.T) {
+	f := &fakeStarts{}
+	previous := running()
+	e := newEntry(f, structures.OverlapQueue, previous)
+
+	queued := make(chan struct{})
+	go func() {
+		e.tick()
+		close(queued)
+	}()
+	for {
+		e.mu.Lock()
+		q := e.queued
+		e.mu.Unlock()
+		if q {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A second tick while one is queued is dropped.
+	e.tick()
+	if f.count() != 0 {
+		t.Fatalf("started %d runs while the previous one was going", f.count())
+	}
+
+	previous.Status.Finish(nil)
+	<-queued
+	if f.count() != 1 || e.last != f.runs[0] {
+		t.Fatalf("queued tick started %d runs, want 1", f.count())
+	}
+}
+
+func TestCronQueueStopped(t *testing.T) {
+	f := &fakeStarts{}
+	e := newEntry(f, structures.OverlapQueue, running())
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		close(e.stop)
+	}()
+	e.tick()
+	if f.count() != 0 {
+		t.Errorf("a removed entry started %d runs", f.count())
+	}
+}
+
+func TestCronJitter(t *testing.T) {
+	f := &fakeStarts{}
+	e := newEntry(f, structures.OverlapAllow, nil)
+	e.jitter = 20 * time.Millisecond
+	begin := time.Now()
+	e.tick()
+	if f.count() != 1 {
+		t.Fatalf("started %d runs, want 1", f.count())
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("tick took %v with a 20ms jitter", elapsed)
+	}
+
+	// A pipeline unscheduled during its jitter never starts.
+	e = newEntry(f, structures.OverlapAllow, nil)
+	e.jitter = time.Hour
+	close(e.stop)
+	e.tick()
+	if f.count() != 1 {
+		t.Errorf("an entry stopped during its jitter started a run")
+	}
+}
+
+func TestCronSync(t *testing.T) {
+	cm := NewCronManager()
+	defer cm.cron.Stop()
+	f := &fakeStarts{}
+	cm.start = f.start
+
+	pm := &PipelineMeta{
+		Name:     "nightly",
+		YamlPath: "/srv/.flume/nightly/nightly.yaml",
+		Trigger:  Trigger{Type: structures.TriggerCron, Cron: "0 2 * * *", Overlap: structures.OverlapSkip},
+		Enabled:  true,
+	}
+	if err := cm.Sync(pm); err != nil {
+		t.Fatal(err)
+	}
+	e := cm.entries["nightly"]
+	if e == nil {
+		t.Fatal("pipeline was not scheduled")
+	}
+	previous := running()
+	e.last = previous
+
+	// Another edit to the file leaves the trigger alone.
+	pm.YamlSha256 = "changed"
+	if err := cm.Sync(pm); err != nil {
+		t.Fatal(err)
+	}
+	if cm.entries["nightly"] != e {
+		t.Error("an unchanged trigger was rescheduled")
+	}
+
+	// A new schedule still knows about the run in progress.
+	pm.Trigger.Cron = "0 3 * * *"
+	if err := cm.Sync(pm); err != nil {
+		t.Fatal(err)
+	}
+	next := cm.entries["nightly"]
+	if next == e || next.expression != "0 3 * * *" || next.last != previous {
+		t.Errorf("rescheduled entry = %+v, want 0 3 * * * with the previous run", next)
+	}
+	select {
+	case <-e.stop:
+	default:
+		t.Error("the old entry was not stopped")
+	}
+
+	pm.Enabled = false
+	if err := cm.Sync(pm); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cm.entries["nightly"]; ok {
+		t.Error("a disabled trigger is still scheduled")
+	}
+
+	pm.Enabled = true
+	pm.Trigger.Cron = "not a schedule"
+	if err := cm.Sync(pm); err == nil {
+		t.Error("expected an error for an invalid expression")
+	}
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+	"github.com/fsnotify/fsnotify"
+)
+
+const defaultDebounce = 2 * time.Second
+
+// fileTrigger is one pipeline's file trigger. Changes are collected until
+// the debounce period passes without another one, then a single run starts.
+type fileTrigger struct {
+	pipeline  string
+	path      string
+	match     *regexp.Regexp
+	root      string
+	recursive bool
+	events    map[string]bool
+	debounce  time.Duration
+	dirs      []string
+	start     func(runRequest, string) (*structures.RunInfo, error)
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	changes map[string][]string
+	last    string
+}
+
+// FileTriggers watches the paths of every pipeline with a file trigger.
+type FileTriggers struct {
+	mu       sync.Mutex
+	w        *fsnotify.Watcher
+	triggers map[string]*fileTrigger
+	watched  map[string]int
+}
+
+func NewFileTriggers() (*FileTriggers, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating file trigger watcher: %w", err)
+	}
+	ft := &FileTriggers{
+		w:        w,
+		triggers: map[string]*fileTrigger{},
+		watched:  map[string]int{},
+	}
+	go ft.loop()
+	return ft, nil
+}
+
+// Sync starts, updates or stops watching for a pipeline after its metadata
+// changed.
+func (ft *FileTriggers) Sync(pm *PipelineMeta) error {
+	name := filepath.Base(filepath.Dir(pm.YamlPath))
+
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.remove(name)
+	if pm.Trigger.Type != structures.TriggerFile || !pm.Enabled {
+		return nil
+	}
+
+	t, err := newFileTrigger(name, pm.Trigger)
+	if err != nil {
+		return err
+	}
+	for _, dir := range t.dirs {
+		if err := ft.watch(dir); err != nil {
+			return err
+		}
+	}
+	ft.triggers[name] = t
+	fmt.Printf("Watching %s for pipeline %s\n", t.path, name)
+	return nil
+}
+
+// Remove stops watching for a pipeline, e.g. after its yaml was deleted.
+func (ft *FileTriggers) Remove(name string) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.remove(name)
+}
+
+func (ft *FileTriggers) remove(name string) {
+	t, ok := ft.triggers[name]
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.mu.Unlock()
+	for _, dir := range t.dirs {
+		ft.unwatch(dir)
+	}
+	delete(ft.triggers, name)
+}
+
+// watch and unwatch reference count directories shared by several triggers.
+func (ft *FileTriggers) watch(dir string) error {
+	if ft.watched[dir] == 0 {
+		if err := ft.w.Add(dir); err != nil {
+			return fmt.Errorf("Error watching %s: %w", dir, err)
+		}
+	}
+	ft.watched[dir]++
+	return nil
+}
+
+func (ft *FileTriggers) unwatch(dir string) {
+	ft.watched[dir]--
+	if ft.watched[dir] <= 0 {
+		delete(ft.watched, dir)
+		_ = ft.w.Remove(dir)
+	}
+}
+
+func (ft *FileTriggers) loop() {
+	for {
+		select {
+		case err, ok := <-ft.w.Errors:
+			if !ok {
+				return
+			}
+			fmt.Printf("ERROR: file trigger: %s\n", err)
+		case e, ok := <-ft.w.Events:
+			if !ok {
+				return
+			}
+			ft.handle(e)
+		}
+	}
+}
+
+func (ft *FileTriggers) handle(e fsnotify.Event) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	path := filepath.Clean(e.Name)
+	ops := eventNames(e.Op)
+	created_dir := false
+	if e.Op&fsnotify.Create != 0 {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			created_dir = true
+		}
+	}
+
+	gone := e.Op&(fsnotify.Remove|fsnotify.Rename) != 0
+
+	for _, t := range ft.triggers {
+		// Directories under a ** pattern are watched as they appear and
+		// forgotten when they go, so one created again is watched again.
+		if t.recursive && strings.HasPrefix(path, t.root+string(os.PathSeparator)) {
+			if created_dir {
+				ft.addDirs(t, path)
+			} else if gone {
+				ft.dropDirs(t, path)
+			}
+		}
+		if !t.match.MatchString(filepath.ToSlash(path)) {
+			continue
+		}
+		wanted := []string{}
+		for _, op := range ops {
+			if t.wants(op) {
+				wanted = append(wanted, op)
+			}
+		}
+		if len(wanted) > 0 {
+			t.record(path, wanted)
+		}
+	}
+}
+
+// addDirs watches a directory created under a recursive trigger's root and
+// everything below it. Files already in it were written before the watch
+// existed, so they are recorded as created.
+func (ft *FileTriggers) addDirs(t *fileTrigger, dir string) {
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if !slices.Contains(t.dirs, p) && ft.watch(p) == nil {
+				t.dirs = append(t.dirs, p)
+			}
+			return nil
+		}
+		if t.wants("create") && t.match.MatchString(filepath.ToSlash(p)) {
+			t.record(p, []string{"create"})
+		}
+		return nil
+	})
+}
+
+// dropDirs stops watching a removed or renamed directory and the ones below
+// it. The root stays, since the trigger can't see anything without it.
+func (ft *FileTriggers) dropDirs(t *fileTrigger, dir string) {
+	kept := t.dirs[:0]
+	for _, d := range t.dirs {
+		if d != t.root && (d == dir || strings.HasPrefix(d, dir+string(os.PathSeparator))) {
+			ft.unwatch(d)
+			continue
+		}
+		kept = append(kept, d)
+	}
+	t.dirs = kept
+}
+
+// wants reports whether the trigger listens for op. No events means all.
+func (t *fileTrigger) wants(op string) bool {
+	return len(t.events) == 0 || t.events[op]
+}
+
+func (t *fileTrigger) record(path string, ops []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, op := range ops {
+		if !slices.Contains(t.changes[path], op) {
+			t.changes[path] = append(t.changes[path], op)
+		}
+	}
+	t.last = path
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.timer = time.AfterFunc(t.debounce, t.fire)
+}
+
+// fire starts the pipeline with the changes collected since the last run.
+func (t *fileTrigger) fire() {
+	t.mu.Lock()
+	changes, last := t.changes, t.last
+	t.changes = map[string][]string{}
+	t.timer = nil
+	t.mu.Unlock()
+	if len(changes) == 0 {
+		return
+	}
+
+	files := make([]string, 0, len(changes))
+	for f := range changes {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	lines := make([]string, len(files))
+	for i, f := range files {
+		lines[i] = strings.Join(changes[f], ",") + " " + f
+	}
+
+	values := map[string]string{
+		"event":   structures.TriggerFile,
+		"path":    t.path,
+		"file":    last,
+		"files":   strings.Join(files, "\n"),
+		"changes": strings.Join(lines, "\n"),
+		"count":   strconv.Itoa(len(files)),
+	}
+	params := make(map[string]string, len(values))
+	for k, v := range values {
+		params[k] = v
+	}
+
+	run_info, err := t.start(runRequest{PipelineRef: t.pipeline, Parameters: params, event: values}, structures.TriggerFile)
+	if err != nil {
+		fmt.Printf("File trigger for %s failed to start a run: %v\n", t.pipeline, err)
+		return
+	}
+	fmt.Printf("File trigger started %s run %s for %d changed file(s)\n", t.pipeline, run_info.RunID, len(files))
+}
+
+// newFileTrigger works out what to watch for a path or glob. A directory
+// matches the files directly inside it. Globs are watched from the deepest
+// directory without wildcards, recursively when they contain **.
+func newFileTrigger(name string, tr Trigger) (*fileTrigger, error) {
+	path, err := filepath.Abs(tr.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	debounce := defaultDebounce
+	if tr.Debounce != "" {
+		if debounce, err = time.ParseDuration(tr.Debounce); err != nil {
+			return nil, fmt.Errorf("invalid debounce '%s': %w", tr.Debounce, err)
+		}
+	}
+
+	t := &fileTrigger{
+		pipeline: name,
+		path:     tr.Path,
+		events:   map[string]bool{},
+		debounce: debounce,
+		changes:  map[string][]string{},
+		start:    startRun,
+	}
+	for _, e := range tr.Events {
+		t.events[e] = true
+	}
+
+	pattern := path
+	if i := strings.IndexAny(path, "*?["); i >= 0 {
+		t.root = filepath.Dir(path[:i+1])
+		t.recursive = strings.Contains(path, "**")
+	} else if info, err := os.Stat(path); err == nil && info.IsDir() {
+		t.root = path
+		pattern = filepath.Join(path, "*")
+	} else {
+		t.root = filepath.Dir(path)
+	}
+	t.match = globRegexp(filepath.ToSlash(pattern))
+
+	if info, err := os.Stat(t.root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("file trigger path %s: directory %s does not exist", tr.Path, t.root)
+	}
+
+	t.dirs = []string{t.root}
+	if t.recursive {
+		err := filepath.WalkDir(t.root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != t.root {
+				t.dirs = append(t.dirs, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func eventNames(op fsnotify.Op) []string {
+	names := []string{}
+	for _, e := range []struct {
+		op   fsnotify.Op
+		name string
+	}{
+		{fsnotify.Create, "create"},
+		{fsnotify.Write, "write"},
+		{fsnotify.Remove, "remove"},
+		{fsnotify.Rename, "rename"},
+		{fsnotify.Chmod, "chmod"},
+	} {
+		if op&e.op != 0 {
+			names = append(names, e.name)
+		}
+	}
+	return names
+}
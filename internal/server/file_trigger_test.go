@@ -0,0 +1,274 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// mkdirs creates dirs under root and returns root.
+func mkdirs(t *testing.T, root string, dirs ...string) string {
+	t.Helper()
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestNewFileTrigger(t *testing.T) {
+	root := mkdirs(t, t.TempDir(), "drop", "src/a/b")
+	tests := []struct {
+		name      string
+		path      string
+		root      string
+		recursive bool
+		dirs      []string
+		match     []string
+		miss      []string
+	}{
+		{
+			name:  "file",
+			path:  "drop/data.csv",
+			root:  "drop",
+			dirs:  []string{"drop"},
+			match: []string{"drop/data.csv"},
+			miss:  []string{"drop/other.csv"},
+		},
+		{
+			name:  "directory",
+			path:  "drop",
+			root:  "drop",
+			dirs:  []string{"drop"},
+			match: []string{"drop/data.csv", "drop/x"},
+			miss:  []string{"drop/sub/data.csv", "src/main.go"},
+		},
+		{
+			name:  "glob",
+			path:  "drop/*.csv",
+			root:  "drop",
+			dirs:  []string{"drop"},
+			match: []string{"drop/data.csv"},
+			miss:  []string{"drop/data.json", "drop/sub/data.csv"},
+		},
+		{
+			name:      "recursive glob",
+			path:      "src/**/*.go",
+			root:      "src",
+			recursive: true,
+			dirs:      []string{"src", "src/a", "src/a/b"},
+			match:     []string{"src/main.go", "src/a/b/main.go"},
+			miss:      []string{"src/a/notes.md", "drop/main.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft, err := newFileTrigger("web", Trigger{Path: filepath.Join(root, tt.path)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ft.root != filepath.Join(root, tt.root) || ft.recursive != tt.recursive {
+				t.Errorf("root = %s (recursive %v), want %s (recursive %v)", ft.root, ft.recursive, tt.root, tt.recursive)
+			}
+			want := make([]string, len(tt.dirs))
+			for i, d := range tt.dirs {
+				want[i] = filepath.Join(root, d)
+			}
+			if !slices.Equal(ft.dirs, want) {
+				t.Errorf("dirs = %v, want %v", ft.dirs, want)
+			}
+			if ft.debounce != defaultDebounce {
+				t.Errorf("debounce = %v, want %v", ft.debounce, defaultDebounce)
+			}
+			for _, f := range tt.match {
+				if !ft.match.MatchString(filepath.ToSlash(filepath.Join(root, f))) {
+					t.Errorf("%s does not match", f)
+				}
+			}
+			for _, f := range tt.miss {
+				if ft.match.MatchString(filepath.ToSlash(filepath.Join(root, f))) {
+					t.Errorf("%s matches", f)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFileTriggerErrors(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		trigger Trigger
+		err     string
+	}{
+		{Trigger{Path: filepath.Join(root, "missing/*.csv")}, "does not exist"},
+		{Trigger{Path: filepath.Join(root, "data.csv"), Debounce: "soon"}, "invalid debounce 'soon'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err, func(t *testing.T) {
+			_, err := newFileTrigger("web", tt.trigger)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("newFileTrigger error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// newTestFileTriggers watches without running the event loop, so the test
+// feeds events to handle itself.
+func newTestFileTriggers(t *testing.T) *FileTriggers {
+	t.Helper()
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return &FileTriggers{w: w, triggers: map[string]*fileTrigger{}, watched: map[string]int{}}
+}
+
+func syncFileTrigger(t *testing.T, ft *FileTriggers, tr Trigger) *fileTrigger {
+	t.Helper()
+	tr.Type = "file"
+	if err := ft.Sync(&PipelineMeta{YamlPath: "/srv/.flume/web/web.yaml", Trigger: tr, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	trigger := ft.triggers["web"]
+	trigger.start = (&fakeStarts{}).start
+	t.Cleanup(func() { ft.Remove("web") })
+	return trigger
+}
+
+func changed(tr *fileTrigger) map[string][]string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	out := map[string][]string{}
+	for k, v := range tr.changes {
+		out[k] = slices.Clone(v)
+	}
+	return out
+}
+
+func TestFileTriggerHandle(t *testing.T) {
+	root := mkdirs(t, t.TempDir(), "src")
+	src := filepath.Join(root, "src")
+	ft := newTestFileTriggers(t)
+	tr := syncFileTrigger(t, ft, Trigger{Path: filepath.Join(src, "**/*.go"), Debounce: "1h"})
+
+	// A file written before the new directory was watched still counts.
+	pkg := filepath.Join(src, "pkg")
+	mkdirs(t, src, "pkg/inner")
+	early := filepath.Join(pkg, "inner", "early.go")
+	if err := os.WriteFile(early, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ft.handle(fsnotify.Event{Name: pkg, Op: fsnotify.Create})
+	if !slices.Contains(tr.dirs, pkg) || !slices.Contains(tr.dirs, filepath.Join(pkg, "inner")) {
+		t.Fatalf("dirs = %v, want the new directories", tr.dirs)
+	}
+	if got := changed(tr)[early]; !slices.Equal(got, []string{"create"}) {
+		t.Errorf("changes for %s = %v, want [create]", early, got)
+	}
+
+	// Files that don't match and other directories are ignored.
+	ft.handle(fsnotify.Event{Name: filepath.Join(src, "README.md"), Op: fsnotify.Write})
+	if _, ok := changed(tr)[filepath.Join(src, "README.md")]; ok {
+		t.Error("a file outside the pattern was recorded")
+	}
+
+	// A removed directory is forgotten, and watched again once recreated.
+	if err := os.RemoveAll(pkg); err != nil {
+		t.Fatal(err)
+	}
+	ft.handle(fsnotify.Event{Name: pkg, Op: fsnotify.Remove})
+	if slices.Contains(tr.dirs, pkg) || slices.Contains(tr.dirs, filepath.Join(pkg, "inner")) {
+		t.Errorf("dirs = %v after the directory was removed", tr.dirs)
+	}
+	if _, ok := ft.watched[pkg]; ok {
+		t.Error("the removed directory is still watched")
+	}
+	if !slices.Contains(tr.dirs, src) {
+		t.Error("the root was dropped")
+	}
+
+	mkdirs(t, src, "pkg")
+	ft.handle(fsnotify.Event{Name: pkg, Op: fsnotify.Create})
+	if !slices.Contains(tr.dirs, pkg) || ft.watched[pkg] != 1 {
+		t.Errorf("recreated directory not watched: dirs %v, count %d", tr.dirs, ft.watched[pkg])
+	}
+
+	main := filepath.Join(pkg, "main.go")
+	ft.handle(fsnotify.Event{Name: main, Op: fsnotify.Write | fsnotify.Chmod})
+	if got := changed(tr)[main]; !slices.Equal(got, []string{"write", "chmod"}) {
+		t.Errorf("changes for %s = %v, want [write chmod]", main, got)
+	}
+}
+
+func TestFileTriggerEvents(t *testing.T) {
+	root := t.TempDir()
+	ft := newTestFileTriggers(t)
+	tr := syncFileTrigger(t, ft, Trigger{Path: root, Events: []string{"create"}, Debounce: "1h"})
+
+	file := filepath.Join(root, "data.csv")
+	ft.handle(fsnotify.Event{Name: file, Op: fsnotify.Write})
+	if len(changed(tr)) != 0 {
+		t.Fatalf("a write was recorded by a create-only trigger: %v", changed(tr))
+	}
+	ft.handle(fsnotify.Event{Name: file, Op: fsnotify.Create | fsnotify.Write})
+	if got := changed(tr)[file]; !slices.Equal(got, []string{"create"}) {
+		t.Errorf("changes = %v, want [create]", got)
+	}
+}
+
+func TestFileTriggerDebounce(t *testing.T) {
+	f := &fakeStarts{}
+	tr := &fileTrigger{
+		pipeline: "web",
+		path:     "drop/*.csv",
+		debounce: 20 * time.Millisecond,
+		changes:  map[string][]string{},
+		start:    f.start,
+	}
+
+	tr.record("/drop/b.csv", []string{"create"})
+	tr.record("/drop/a.csv", []string{"create"})
+	tr.record("/drop/b.csv", []string{"write", "create"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for f.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// Nothing else is recorded, so no second run follows.
+	time.Sleep(50 * time.Millisecond)
+	if f.count() != 1 {
+		t.Fatalf("started %d runs, want 1", f.count())
+	}
+
+	req := f.reqs[0]
+	want := map[string]string{
+		"event":   "file",
+		"path":    "drop/*.csv",
+		"file":    "/drop/b.csv",
+		"files":   "/drop/a.csv\n/drop/b.csv",
+		"changes": "create /drop/a.csv\ncreate,write /drop/b.csv",
+		"count":   "2",
+	}
+	for k, v := range want {
+		if req.event[k] != v || req.Parameters[k] != v {
+			t.Errorf("%s = %q (param %q), want %q", k, req.event[k], req.Parameters[k], v)
+		}
+	}
+	if len(changed(tr)) != 0 {
+		t.Errorf("changes were kept after the run: %v", changed(tr))
+	}
+
+	// A fire with nothing recorded starts nothing.
+	tr.fire()
+	if f.count() != 1 {
+		t.Errorf("an empty fire started a run")
+	}
+}
@@ -0,0 +1,408 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	githubapp "github.com/AlexSTJO/flume/internal/github"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// githubEvent is the part of a push or pull_request delivery that triggers
+// match on and pipelines can read through ${trigger:...}.
+type githubEvent struct {
+	Name   string
+	Owner  string
+	Repo   string
+	Branch string
+	Number int
+	Values map[string]string
+
+	files      []string
+	filesKnown bool
+}
+
+type webhookRun struct {
+	Pipeline string `json:"pipeline"`
+	RunID    string `json:"run_id"`
+}
+
+type webhookResponse struct {
+	Status   string       `json:"status"`
+	Event    string       `json:"event"`
+	Delivery string       `json:"delivery,omitempty"`
+	Runs     []webhookRun `json:"runs"`
+	Errors   []string     `json:"errors,omitempty"`
+}
+
+// Pull request actions that mean the code under review changed.
+var pullRequestActions = map[string]bool{
+	"opened":      true,
+	"synchronize": true,
+	"reopened":    true,
+}
+
+func githubWebhook(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv("GITHUB_WEBHOOK_SECRET")
+	if secret == "" {
+		http.Error(w, "github webhooks are not configured: GITHUB_WEBHOOK_SECRET is not set", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 25<<20))
+	if err != nil {
+		http.Error(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validSignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	resp := webhookResponse{
+		Status:   "ignored",
+		Event:    r.Header.Get("X-GitHub-Event"),
+		Delivery: r.Header.Get("X-GitHub-Delivery"),
+		Runs:     []webhookRun{},
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if resp.Event == "ping" {
+		resp.Status = "pong"
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	ev, err := parseGitHubEvent(resp.Event, body)
+	if err != nil {
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ev == nil {
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	ev.Values["delivery"] = resp.Delivery
+
+	metas, err := pipelineMetas()
+	if err != nil {
+		http.Error(w, "Error reading pipelines: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, pm := range metas {
+		if pm.Trigger.Type != structures.TriggerGitHub || !pm.Enabled {
+			continue
+		}
+		name := filepath.Base(filepath.Dir(pm.YamlPath))
+
+		ok, err := matchGitHub(r.Context(), pm.Trigger, ev)
+		if err != nil {
+			resp.Errors = append(resp.Errors, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		run_info, err := startRun(runRequest{
+			PipelineRef: name,
+			Parameters:  maps.Clone(ev.Values),
+			event:       ev.Values,
+		}, structures.TriggerGitHub)
+		if err != nil {
+			resp.Errors = append(resp.Errors, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		resp.Runs = append(resp.Runs, webhookRun{Pipeline: name, RunID: run_info.RunID})
+	}
+
+	if len(resp.Runs) > 0 {
+		resp.Status = "started"
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// validSignature checks GitHub's X-Hub-Signature-256 header, an HMAC-SHA256
+// of the raw body keyed with the webhook secret.
+func validSignature(secret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// parseGitHubEvent returns nil for deliveries that never trigger a run:
+// other events, branch deletions and pull request actions like labeled.
+func parseGitHubEvent(name string, body []byte) (*githubEvent, error) {
+	var payload struct {
+		Ref        string `json:"ref"`
+		After      string `json:"after"`
+		Deleted    bool   `json:"deleted"`
+		Action     string `json:"action"`
+		Number     int    `json:"number"`
+		Repository struct {
+			FullName string `json:"full_name"`
+			Name     string `json:"name"`
+			Owner    struct {
+				Login string `json:"login"`
+			} `json:"owner"`
+		} `json:"repository"`
+		HeadCommit *struct {
+			Author struct {
+				Username string `json:"username"`
+				Name     string `json:"name"`
+			} `json:"author"`
+		} `json:"head_commit"`
+		Sender struct {
+			Login string `json:"login"`
+		} `json:"sender"`
+		Commits []struct {
+			Added    []string `json:"added"`
+			Removed  []string `json:"removed"`
+			Modified []string `json:"modified"`
+		} `json:"commits"`
+		PullRequest struct {
+			Head struct {
+				SHA string `json:"sha"`
+				Ref string `json:"ref"`
+			} `json:"head"`
+			Base struct {
+				Ref string `json:"ref"`
+			} `json:"base"`
+			User struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"pull_request"`
+	}
+
+	switch name {
+	case "push", "pull_request":
+	default:
+		return nil, nil
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	ev := &githubEvent{
+		Name:  name,
+		Owner: payload.Repository.Owner.Login,
+		Repo:  payload.Repository.Name,
+		Values: map[string]string{
+			"event": name,
+			"repo":  payload.Repository.FullName,
+			"owner": payload.Repository.Owner.Login,
+		},
+	}
+
+	switch name {
+	case "push":
+		if payload.Deleted {
+			return nil, nil
+		}
+		ev.Values["ref"] = payload.Ref
+		ev.Values["sha"] = payload.After
+		if branch, ok := strings.CutPrefix(payload.Ref, "refs/heads/"); ok {
+			ev.Branch = branch
+			ev.Values["branch"] = branch
+		}
+		if tag, ok := strings.CutPrefix(payload.Ref, "refs/tags/"); ok {
+			ev.Values["tag"] = tag
+		}
+		ev.Values["author"] = payload.Sender.Login
+		if payload.HeadCommit != nil {
+			if a := payload.HeadCommit.Author.Username; a != "" {
+				ev.Values["author"] = a
+			} else if a := payload.HeadCommit.Author.Name; a != "" {
+				ev.Values["author"] = a
+			}
+		}
+
+		// GitHub lists at most 20 commits in a push payload, which is close
+		// enough for path filters.
+		for _, c := range payload.Commits {
+			ev.files = append(ev.files, c.Added...)
+			ev.files = append(ev.files, c.Removed...)
+			ev.files = append(ev.files, c.Modified...)
+		}
+		ev.filesKnown = true
+	case "pull_request":
+		if !pullRequestActions[payload.Action] {
+			return nil, nil
+		}
+		pr := payload.PullRequest
+		ev.Number = payload.Number
+		ev.Branch = pr.Base.Ref
+		ev.Values["action"] = payload.Action
+		ev.Values["pr_number"] = strconv.Itoa(payload.Number)
+		ev.Values["ref"] = "refs/pull/" + strconv.Itoa(payload.Number) + "/head"
+		ev.Values["sha"] = pr.Head.SHA
+		ev.Values["branch"] = pr.Base.Ref
+		ev.Values["head_branch"] = pr.Head.Ref
+		ev.Values["author"] = pr.User.Login
+	}
+	return ev, nil
+}
+
+// matchGitHub applies a github trigger's filters. Events default to push,
+// branches match the pushed branch or a pull request's base branch, and
+// paths match if any changed file does.
+func matchGitHub(ctx context.Context, t Trigger, ev *githubEvent) (bool, error) {
+	events := t.Events
+	if len(events) == 0 {
+		events = []string{"push"}
+	}
+	if !matchAny(events, ev.Name, false) {
+		return false, nil
+	}
+	if len(t.Branches) > 0 && (ev.Branch == "" || !matchAny(t.Branches, ev.Branch, true)) {
+		return false, nil
+	}
+	if len(t.Paths) == 0 {
+		return true, nil
+	}
+
+	if !ev.filesKnown {
+		files, err := githubapp.PullRequestFiles(ctx, ev.Owner, ev.Repo, ev.Number)
+		if err != nil {
+			return false, fmt.Errorf("listing pull request files for path filters: %w", err)
+		}
+		ev.files, ev.filesKnown = files, true
+	}
+	for _, f := range ev.files {
+		if matchAny(t.Paths, f, true) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchAny(patterns []string, s string, glob bool) bool {
+	for _, p := range patterns {
+		if p == s || (glob && globRegexp(p).MatchString(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp compiles a branch or path glob. * and ? stay within one path
+// segment, ** matches across segments and [abc], [a-z] or [!abc] match one
+// character of a class.
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			class, n := globClass(pattern[i:])
+			if n == 0 {
+				b.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			b.WriteString(class)
+			i += n - 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// globClass converts the character class pattern starts with to a regular
+// expression and returns it with the length it takes up in the pattern. n is
+// 0 when the class is unterminated or invalid, so the [ is taken literally.
+func globClass(pattern string) (class string, n int) {
+	i := 1
+	negate := i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^')
+	if negate {
+		i++
+	}
+	start := i
+	// A ] right after the opening bracket is part of the class.
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	end := strings.IndexByte(pattern[i:], ']')
+	if end < 0 {
+		return "", 0
+	}
+	end += i
+
+	var b strings.Builder
+	b.WriteString("[")
+	if negate {
+		b.WriteString("^/")
+	}
+	for _, c := range pattern[start:end] {
+		if c == '\\' || c == '[' || c == ']' || c == '^' {
+			b.WriteString("\\")
+		}
+		b.WriteRune(c)
+	}
+	b.WriteString("]")
+	if _, err := regexp.Compile(b.String()); err != nil {
+		return "", 0
+	}
+	return b.String(), end + 1
+}
+
+// pipelineMetas returns the current metadata of every pipeline under .flume,
+// skipping pipelines that fail to load. It leaves meta.json alone: only the
+// watcher syncs it, so it still sees every change and reschedules triggers.
+func pipelineMetas() ([]*PipelineMeta, error) {
+	dirs, err := os.ReadDir(filepath.Join(".", ".flume"))
+	if err != nil {
+		return nil, err
+	}
+
+	metas := []*PipelineMeta{}
+	for _, d := range dirs {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(".", ".flume", d.Name(), d.Name()+".yaml")
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		pm, err := generateMeta(path)
+		if err != nil {
+			fmt.Printf("Skipping pipeline %s: %v\n", d.Name(), err)
+			continue
+		}
+		metas = append(metas, pm)
+	}
+	return metas, nil
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSignature(t *testing.T) {
+	body := []byte(`{"ref": "refs/heads/main"}`)
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"valid", sign("s3cret", body), true},
+		{"missing", "", false},
+		{"wrong secret", sign("other", body), false},
+		{"other body", sign("s3cret", []byte(`{}`)), false},
+		{"sha1 prefix", "sha1=" + sign("s3cret", body)[len("sha256="):], false},
+		{"not hex", "sha256=zzzz", false},
+		{"truncated", sign("s3cret", body)[:20], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validSignature("s3cret", body, tt.header); got != tt.want {
+				t.Errorf("validSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"main", "main", true},
+		{"release/*", "release/1.2", true},
+		{"release/*", "release/1.2/hotfix", false},
+		{"release/**", "release/1.2/hotfix", true},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"src/**/*.go", "srcmain.go", false},
+		{"**", "any/thing", true},
+		{"v?", "v1", true},
+		{"v?", "v10", false},
+		{"v[0-9]", "v7", true},
+		{"v[0-9]", "vx", false},
+		{"[!a]*", "bugfix", true},
+		{"[!a]*", "alpha", false},
+		{"[!a]*", "/x", false},
+		{"[^a]*", "bugfix", true},
+		{"[]]", "]", true},
+		{"[abc", "[abc", true},
+		{"a.b", "axb", false},
+		{"a+b", "a+b", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.s, func(t *testing.T) {
+			if got := globRegexp(tt.pattern).MatchString(tt.s); got != tt.want {
+				t.Errorf("globRegexp(%q) matching %q = %v, want %v", tt.pattern, tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGitHubEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event string
+		body  string
+		want  *githubEvent
+	}{
+		{
+			name:  "push",
+			event: "push",
+			body: `{"ref": "refs/heads/main", "after": "abc123",
+				"repository": {"full_name": "octo/app", "name": "app", "owner": {"login": "octo"}},
+				"head_commit": {"author": {"username": "alice"}}, "sender": {"login": "bot"},
+				"commits": [{"added": ["a.go"], "removed": ["b.go"], "modified": ["c.go"]}, {"modified": ["d.go"]}]}`,
+			want: &githubEvent{
+				Name: "push", Owner: "octo", Repo: "app", Branch: "main",
+				Values: map[string]string{
+					"event": "push", "repo": "octo/app", "owner": "octo",
+					"ref": "refs/heads/main", "sha": "abc123", "branch": "main", "author": "alice",
+				},
+				files:      []string{"a.go", "b.go", "c.go", "d.go"},
+				filesKnown: true,
+			},
+		},
+		{
+			name:  "tag push",
+			event: "push",
+			body: `{"ref": "refs/tags/v1.0", "after": "abc123",
+				"repository": {"full_name": "octo/app", "name": "app", "owner": {"login": "octo"}},
+				"sender": {"login": "bot"}}`,
+			want: &githubEvent{
+				Name: "push", Owner: "octo", Repo: "app",
+				Values: map[string]string{
+					"event": "push", "repo": "octo/app", "owner": "octo",
+					"ref": "refs/tags/v1.0", "sha": "abc123", "tag": "v1.0", "author": "bot",
+				},
+				filesKnown: true,
+			},
+		},
+		{
+			name:  "branch deletion",
+			event: "push",
+			body:  `{"ref": "refs/heads/old", "deleted": true}`,
+		},
+		{
+			name:  "pull request",
+			event: "pull_request",
+			body: `{"action": "synchronize", "number": 7,
+				"repository": {"full_name": "octo/app", "name": "app", "owner": {"login": "octo"}},
+				"pull_request": {"head": {"sha": "def456", "ref": "feature"}, "base": {"ref": "main"}, "user": {"login": "bob"}}}`,
+			want: &githubEvent{
+				Name: "pull_request", Owner: "octo", Repo: "app", Branch: "main", Number: 7,
+				Values: map[string]string{
+					"event": "pull_request", "repo": "octo/app", "owner": "octo", "action": "synchronize",
+					"pr_number": "7", "ref": "refs/pull/7/head", "sha": "def456",
+					"branch": "main", "head_branch": "feature", "author": "bob",
+				},
+			},
+		},
+		{
+			name:  "pull request labeled",
+			event: "pull_request",
+			body:  `{"action": "labeled", "number": 7}`,
+		},
+		{
+			name:  "other event",
+			event: "issues",
+			body:  `{"action": "opened"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGitHubEvent(tt.event, []byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGitHubEvent = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseGitHubEvent("push", []byte(`{`)); err == nil {
+		t.Error("expected an error for a malformed payload")
+	}
+}
+
+func TestMatchGitHub(t *testing.T) {
+	push := func(branch string, files ...string) *githubEvent {
+		return &githubEvent{Name: "push", Branch: branch, files: files, filesKnown: true}
+	}
+	pr := &githubEvent{Name: "pull_request", Branch: "main", files: []string{"docs/readme.md"}, filesKnown: true}
+	tag := &githubEvent{Name: "push", filesKnown: true}
+
+	tests := []struct {
+		name    string
+		trigger Trigger
+		ev      *githubEvent
+		want    bool
+	}{
+		{"push by default", Trigger{}, push("main"), true},
+		{"pull requests need listing", Trigger{}, pr, false},
+		{"pull request listed", Trigger{Events: []string{"pull_request"}}, pr, true},
+		{"branch match", Trigger{Branches: []string{"main"}}, push("main"), true},
+		{"branch glob", Trigger{Branches: []string{"release/**"}}, push("release/1/rc"), true},
+		{"branch miss", Trigger{Branches: []string{"main"}}, push("feature"), false},
+		{"negated class", Trigger{Branches: []string{"[!f]*"}}, push("feature"), false},
+		{"tags have no branch", Trigger{Branches: []string{"**"}}, tag, false},
+		{"path match", Trigger{Paths: []string{"src/**"}}, push("main", "README.md", "src/app/main.go"), true},
+		{"path miss", Trigger{Paths: []string{"src/**"}}, push("main", "README.md"), false},
+		{"no files", Trigger{Paths: []string{"**"}}, push("main"), false},
+		{"pull request paths", Trigger{Events: []string{"pull_request"}, Paths: []string{"docs/*.md"}}, pr, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchGitHub(context.Background(), tt.trigger, tt.ev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("matchGitHub = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type stubService struct{}
+
+func (stubService) Name() string {
+	return "stub"
+}
+
+func (stubService) Parameters() []structures.ParamSpec {
+	return nil
+}
+
+func (stubService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+	return nil
+}
+
+func init() {
+	structures.Registry["stub"] = stubService{}
+}
+
+// chdir switches to a temporary directory for the rest of the test.
+func chdir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestPipelineMetasLeavesMetaAlone(t *testing.T) {
+	dir := chdir(t)
+	pipeline := filepath.Join(dir, ".flume", "web")
+	if err := os.MkdirAll(pipeline, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	yaml := "name: web\ntrigger:\n  type: github\n  branches: [main]\ntasks:\n  build:\n    service: stub\n"
+	if err := os.WriteFile(filepath.Join(pipeline, "web.yaml"), []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	metas, err := pipelineMetas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metas) != 1 || metas[0].Name != "web" || !reflect.DeepEqual(metas[0].Trigger.Branches, []string{"main"}) {
+		t.Fatalf("pipelineMetas = %+v", metas)
+	}
+	if _, err := os.Stat(filepath.Join(pipeline, "meta.json")); !os.IsNotExist(err) {
+		t.Errorf("pipelineMetas wrote meta.json (stat err = %v)", err)
+	}
+}
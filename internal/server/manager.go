@@ -1,48 +1,98 @@
 package server
 
 import (
+	"bufio"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/AlexSTJO/flume/internal/engine"
+	"github.com/AlexSTJO/flume/internal/history"
+	"github.com/AlexSTJO/flume/internal/logging"
 	"github.com/AlexSTJO/flume/internal/structures"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/joho/godotenv"
 )
 
 type runRequest struct {
 	PipelineRef string            `json:"pipeline_ref"`
 	Parameters  map[string]string `json:"parameters,omitempty"`
+	Wait        bool              `json:"wait,omitempty"`
+	DryRun      bool              `json:"dry_run,omitempty"`
+
+	// event holds ${trigger:...} values for runs started by a trigger, and
+	// chain the pipelines upstream of a run started by another run.
+	event map[string]string
+	chain []string
 }
 
 type RunResponse struct {
-	Status       string `json:"status"`
-	RunID        string `json:"run_id"`
-	LogsUploaded bool   `json:"logs_uploaded,omitempty"`
+	Status string `json:"status"`
+	RunID  string `json:"run_id"`
 }
 
 func CreateServer() error {
+	_ = godotenv.Load()
+	if err := engine.ConfigureLimitsFromEnv(); err != nil {
+		return fmt.Errorf("limits config failed: %w", err)
+	}
+
+	store, err := history.Open()
+	if err != nil {
+		return fmt.Errorf("history store init failed: %w", err)
+	}
+	runs = NewRunRegistry(store)
+	structures.Launch = launchRun
+	structures.OnApproval = func(r *structures.RunInfo, _ string, _ structures.Approval) { runs.Save(r) }
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/run", runPipeline)
+	mux.HandleFunc("GET /runs", listRuns)
+	mux.HandleFunc("GET /runs/{id}", getRun)
+	mux.HandleFunc("GET /runs/{id}/logs", getRunLogs)
+	mux.HandleFunc("GET /runs/{id}/outputs", getRunOutputs)
+	mux.HandleFunc("GET /runs/{id}/outputs/{task}", getRunOutputs)
+	mux.HandleFunc("DELETE /runs/{id}", cancelRun)
+	mux.HandleFunc("POST /runs/{id}/cancel", cancelRun)
+	mux.HandleFunc("POST /runs/{id}/approvals/{task}", decideApproval)
+	mux.HandleFunc("POST /webhooks/github", githubWebhook)
 	go func() {
 		if err := http.ListenAndServe(":8080", mux); err != nil {
 			fmt.Printf("Error creating server: %v", err)
 		}
 	}()
 
-	CronManager, err := CronInit()
+	cron_manager := NewCronManager()
+	file_triggers, err := NewFileTriggers()
 	if err != nil {
-		return fmt.Errorf("cron init failed: %w", err)
+		return err
+	}
+	metas, err := pipelineMetas()
+	if err != nil {
+		return fmt.Errorf("reading pipelines failed: %w", err)
+	}
+	for _, pm := range metas {
+		if err := cron_manager.Sync(pm); err != nil {
+			fmt.Printf("Error adding cron trigger: %v\n", err)
+		}
+		if err := file_triggers.Sync(pm); err != nil {
+			fmt.Printf("Error adding file trigger: %v\n", err)
+		}
 	}
 
 	go func() {
-		if err := FileWatcher(CronManager); err != nil {
+		if err := FileWatcher(cron_manager, file_triggers); err != nil {
 			fmt.Printf("Error creating file watcher: %v", err)
 		}
 	}()
@@ -60,93 +110,466 @@ func runPipeline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var s3_client *s3.Client
+	if req.DryRun {
+		plan, err := planRun(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(plan)
+		return
+	}
 
-	run_info, err := structures.GenerateRunInfo(req.PipelineRef, req.Parameters)
+	run_info, err := startRun(req, "api")
 	if err != nil {
-		http.Error(w, "Error Geerating Run Info: "+err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	path := filepath.Join(".", ".flume", run_info.Pipeline, run_info.Pipeline+".yaml")
-	if run_info.Remote {
-		aws_ctx := context.Background()
-		cfg, err := config.LoadDefaultConfig(aws_ctx)
-		if err != nil {
-			http.Error(w, "Failed To Load AWS Config"+err.Error(), http.StatusBadRequest)
+	if req.Wait {
+		select {
+		case <-run_info.Status.Done():
+		case <-r.Context().Done():
 			return
 		}
-		s3_client = s3.NewFromConfig(cfg)
 
-		out, err := s3_client.GetObject(aws_ctx, &s3.GetObjectInput{
-			Bucket: aws.String(run_info.S3.Bucket),
-			Key:    aws.String(run_info.S3.Key),
-		})
+		code := http.StatusOK
+		if run_info.Status.State() != structures.RunSucceeded {
+			code = http.StatusInternalServerError
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(run_info.Summary())
+		return
+	}
 
-		if err != nil {
-			err_string := fmt.Sprintf("Failed to get key: '%s' from bucket: '%s' -> %s", run_info.S3.Key, run_info.S3.Bucket, err.Error())
-			http.Error(w, err_string, http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(RunResponse{
+		Status: string(run_info.Status.State()),
+		RunID:  run_info.RunID,
+	})
+}
+
+func getRun(w http.ResponseWriter, r *http.Request) {
+	summary, err := runs.Summary(r.PathValue("id"))
+	if errors.Is(err, history.ErrNotFound) {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error reading run: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// getRunOutputs returns the task outputs of a run, or of a single task when
+// the path names one. Finished runs are served from the history store.
+func getRunOutputs(w http.ResponseWriter, r *http.Request) {
+	summary, err := runs.Summary(r.PathValue("id"))
+	if errors.Is(err, history.ErrNotFound) {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error reading run: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	outputs := summary.Outputs
+	if outputs == nil {
+		outputs = map[string]map[string]any{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if task := r.PathValue("task"); task != "" {
+		values, ok := outputs[task]
+		if !ok {
+			http.Error(w, "no outputs for task "+task, http.StatusNotFound)
 			return
 		}
+		json.NewEncoder(w).Encode(values)
+		return
+	}
+	json.NewEncoder(w).Encode(outputs)
+}
 
-		defer out.Body.Close()
+// getRunLogs serves a run's log as plain text, or as the raw JSONL with
+// ?raw=true. It is the details link of GitHub check runs.
+func getRunLogs(w http.ResponseWriter, r *http.Request) {
+	summary, err := runs.Summary(r.PathValue("id"))
+	if errors.Is(err, history.ErrNotFound) {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error reading run: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		b, err := io.ReadAll(out.Body)
-		if err != nil {
-			http.Error(w, "Unable to read file body"+err.Error(), http.StatusBadRequest)
+	f, err := os.Open(summary.LogPath)
+	if summary.LogPath == "" || errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "run has no log", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error opening log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	if r.URL.Query().Get("raw") == "true" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.Copy(w, f)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for sc.Scan() {
+		var line logging.LogLine
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			fmt.Fprintln(w, sc.Text())
+			continue
+		}
+		fmt.Fprintf(w, "%s  %-8s  %s\n", line.TS, line.Level, strings.TrimRight(line.Msg, "\n"))
+	}
+}
+
+func cancelRun(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !runs.Cancel(id) {
+		if _, err := runs.Summary(id); err != nil {
+			http.Error(w, "run not found", http.StatusNotFound)
 			return
 		}
+		http.Error(w, "run is not active", http.StatusConflict)
+		return
+	}
 
-		dir := filepath.Dir(path)
-		if err := os.MkdirAll(dir, 0o755); err != nil {
-			http.Error(w, "Error creating directories for remote file", http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(RunResponse{
+		Status: "cancelling",
+		RunID:  id,
+	})
+}
+
+type approvalRequest struct {
+	Decision string `json:"decision"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// decideApproval approves or rejects a task or deployment waiting in an
+// active run. The approver is whoever owns the bearer token, see
+// approvalTokens.
+func decideApproval(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	tokens, err := approvalTokens()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	approver, ok := tokens.approver(r.Header.Get("Authorization"))
+	if !ok {
+		http.Error(w, "a valid approval token is required", http.StatusUnauthorized)
+		return
+	}
+
+	var req approvalRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid json: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Decision != "approve" && req.Decision != "reject" {
+		http.Error(w, "decision must be approve or reject", http.StatusBadRequest)
+		return
+	}
+
+	id, task := r.PathValue("id"), r.PathValue("task")
+	run_info, ok := runs.Get(id)
+	if !ok {
+		if _, err := runs.Summary(id); err != nil {
+			http.Error(w, "run not found", http.StatusNotFound)
 			return
 		}
+		http.Error(w, "run is not active", http.StatusConflict)
+		return
+	}
 
-		if err := os.WriteFile(path, b, 0o644); err != nil {
-			http.Error(w, "Writing to tmp failed", http.StatusBadRequest)
+	a, err := run_info.Status.Decide(task, structures.ApprovalDecision{
+		Approve:  req.Decision == "approve",
+		Approver: approver,
+		Comment:  req.Comment,
+	})
+	switch {
+	case errors.Is(err, structures.ErrNoPendingApproval):
+		http.Error(w, "no pending approval for "+task, http.StatusConflict)
+		return
+	case errors.Is(err, structures.ErrNotApprover):
+		http.Error(w, approver+" may not decide this approval", http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	runs.Save(run_info)
+	fmt.Printf("Run %s: %s %s by %s\n", id, task, a.State, a.Approver)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+// approverTokens maps approval tokens to the approver they identify.
+type approverTokens map[string]string
+
+// approvalTokens reads FLUME_APPROVAL_TOKENS, e.g.
+// FLUME_APPROVAL_TOKENS="alice=s3cret,bob=t0ken". Deciding approvals over the
+// API is disabled while it is unset.
+func approvalTokens() (approverTokens, error) {
+	v := strings.TrimSpace(os.Getenv("FLUME_APPROVAL_TOKENS"))
+	if v == "" {
+		return nil, fmt.Errorf("approvals are not configured: FLUME_APPROVAL_TOKENS is not set")
+	}
+	tokens := approverTokens{}
+	for _, entry := range strings.Split(v, ",") {
+		name, token, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("invalid approval token entry in FLUME_APPROVAL_TOKENS, expected approver=token")
+		}
+		tokens[token] = name
+	}
+	return tokens, nil
+}
+
+// approver returns who owns the token in an "Authorization: Bearer <token>"
+// header.
+func (t approverTokens) approver(header string) (string, bool) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	found := ""
+	for known, name := range t {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			found = name
+		}
+	}
+	return found, found != ""
+}
+
+func listRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := history.Filter{
+		Pipeline: q.Get("pipeline"),
+		Status:   structures.RunState(q.Get("status")),
+	}
+
+	if since := q.Get("since"); since != "" {
+		t, err := parseSince(since)
+		if err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+		f.Since = t
 	}
 
-	p, err := structures.Initialize(path)
+	limit, err := queryInt(q.Get("limit"), 50)
+	if err != nil || limit <= 0 || limit > 500 {
+		http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(q.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	recs, err := runs.List(f)
 	if err != nil {
-		http.Error(w, "Pipeline Initalization Failure:"+err.Error(), http.StatusBadRequest)
+		http.Error(w, "Error listing runs: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Outputs and plans can be large, so listings leave them to
+	// GET /runs/{id}/outputs and GET /runs/{id}.
+	for i := range recs {
+		recs[i].Outputs = nil
+		for name, a := range recs[i].Approvals {
+			a.Plan = ""
+			recs[i].Approvals[name] = a
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history.Paginate(recs, limit, offset))
+}
+
+// parseSince accepts either a full RFC 3339 timestamp or a plain date.
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+func queryInt(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// startRun prepares the pipeline referenced by req and launches it in the
+// background. Errors returned here happen before the engine starts and are
+// the caller's fault.
+func startRun(req runRequest, trigger string) (*structures.RunInfo, error) {
+	run_info, err := structures.GenerateRunInfo(req.PipelineRef, req.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("Error Generating Run Info: %w", err)
+	}
+	run_info.Trigger = trigger
+	run_info.Event = req.event
+	run_info.Chain = req.chain
+
+	p, s3_client, err := loadPipeline(run_info.Pipeline, run_info.Remote, run_info.S3)
+	if err != nil {
+		return nil, err
+	}
+
 	e, err := engine.Build(p, run_info)
 	if err != nil {
-		http.Error(w, "Engine Build Failure: "+err.Error(), http.StatusBadRequest)
-		return
+		return nil, fmt.Errorf("Engine Build Failure: %w", err)
 	}
-	if err = e.Start(); err != nil {
-		http.Error(w, "Engine Run Failure: "+err.Error(), http.StatusBadRequest)
-		return
+
+	run_ctx, cancel := context.WithCancel(context.Background())
+	runs.Add(run_info, cancel)
+	go func() {
+		if err := e.Start(run_ctx); err != nil {
+			fmt.Printf("Run %s failed: %v\n", run_info.RunID, err)
+		}
+		runs.Finish(run_info)
+		triggerDownstream(run_info)
+		if run_info.Remote {
+			if err := uploadLogs(s3_client, run_info); err != nil {
+				fmt.Printf("Run %s log upload failed: %v\n", run_info.RunID, err)
+			}
+		}
+	}()
+
+	return run_info, nil
+}
+
+// planRun loads the pipeline referenced by req and returns its execution plan
+// without running anything. A remote pipeline is only kept in memory, so a
+// dry run leaves .flume, and the watcher scheduling from it, untouched.
+func planRun(req runRequest) (*engine.Plan, error) {
+	pipeline, remote, remote_pipeline, err := structures.ParsePipelineRef(req.PipelineRef)
+	if err != nil {
+		return nil, fmt.Errorf("Error Parsing Pipeline Ref: %w", err)
 	}
 
-	logsUploaded := false
-	if run_info.Remote {
-		log_file := filepath.Join(run_info.RunDir, "logs", run_info.RunID+".jsonl")
-		key := filepath.Join("logs", run_info.Pipeline, run_info.RunID+".jsonl")
-		file, err := os.Open(log_file)
-		if err == nil {
-			defer file.Close()
-			_, err = s3_client.PutObject(context.TODO(), &s3.PutObjectInput{
-				Bucket: aws.String(run_info.S3.Bucket),
-				Key:    aws.String(key),
-				Body:   file,
-			})
-			logsUploaded = (err == nil)
+	var p *structures.Pipeline
+	if remote {
+		b, _, err := fetchPipeline(remote_pipeline)
+		if err != nil {
+			return nil, err
+		}
+		p, err = structures.Parse(b)
+		if err != nil {
+			return nil, fmt.Errorf("Pipeline Initalization Failure: %w", err)
+		}
+	} else {
+		p, err = structures.Initialize(pipelinePath(pipeline))
+		if err != nil {
+			return nil, fmt.Errorf("Pipeline Initalization Failure: %w", err)
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(RunResponse{
-		Status:       "success",
-		RunID:        run_info.RunID,
-		LogsUploaded: logsUploaded,
+	plan, err := engine.BuildPlan(p, req.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("Plan Failure: %w", err)
+	}
+	return plan, nil
+}
+
+// loadPipeline initializes a pipeline from .flume, fetching it from S3 first
+// when the reference is remote. The S3 client is returned for log uploads.
+func loadPipeline(pipeline string, remote bool, remote_pipeline *structures.RemotePipeline) (*structures.Pipeline, *s3.Client, error) {
+	var s3_client *s3.Client
+
+	path := pipelinePath(pipeline)
+	if remote {
+		b, client, err := fetchPipeline(remote_pipeline)
+		if err != nil {
+			return nil, nil, err
+		}
+		s3_client = client
+
+		dir := filepath.Dir(path)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, nil, fmt.Errorf("Error creating directories for remote file: %w", err)
+		}
+
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			return nil, nil, fmt.Errorf("Writing to tmp failed: %w", err)
+		}
+	}
+
+	p, err := structures.Initialize(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Pipeline Initalization Failure: %w", err)
+	}
+	return p, s3_client, nil
+}
+
+func pipelinePath(pipeline string) string {
+	return filepath.Join(".", ".flume", pipeline, pipeline+".yaml")
+}
+
+// fetchPipeline reads a pipeline file from S3.
+func fetchPipeline(remote_pipeline *structures.RemotePipeline) ([]byte, *s3.Client, error) {
+	aws_ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(aws_ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed To Load AWS Config: %w", err)
+	}
+	s3_client := s3.NewFromConfig(cfg)
+
+	out, err := s3_client.GetObject(aws_ctx, &s3.GetObjectInput{
+		Bucket: aws.String(remote_pipeline.Bucket),
+		Key:    aws.String(remote_pipeline.Key),
 	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to get key: '%s' from bucket: '%s' -> %w", remote_pipeline.Key, remote_pipeline.Bucket, err)
+	}
+	defer out.Body.Close()
+
+	b, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to read file body: %w", err)
+	}
+	return b, s3_client, nil
+}
 
+func uploadLogs(s3_client *s3.Client, run_info *structures.RunInfo) error {
+	log_file := run_info.LogPath()
+	key := filepath.Join("logs", run_info.Pipeline, run_info.RunID+".jsonl")
+	file, err := os.Open(log_file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = s3_client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(run_info.S3.Bucket),
+		Key:    aws.String(key),
+		Body:   file,
+	})
+	return err
 }
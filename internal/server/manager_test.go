@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+func TestDecideApproval(t *testing.T) {
+	runs = NewRunRegistry(nil)
+	r := &structures.RunInfo{RunID: "run-1", Status: structures.NewRunStatus()}
+	r.Status.Start([]string{"deploy"})
+	runs.Add(r, func() {})
+
+	decided := make(chan structures.Approval, 1)
+	go func() {
+		a, _ := r.AwaitApproval(context.Background(), "deploy", structures.ApprovalRequest{Approvers: []string{"alice"}})
+		decided <- a
+	}()
+	for r.Status.State() != structures.RunWaitingForApproval {
+		time.Sleep(time.Millisecond)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs/{id}/approvals/{task}", decideApproval)
+	post := func(path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Setenv("FLUME_APPROVAL_TOKENS", "")
+	if rec := post("/runs/run-1/approvals/deploy", "alice-token", `{"decision": "approve"}`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("without FLUME_APPROVAL_TOKENS: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	t.Setenv("FLUME_APPROVAL_TOKENS", "alice=alice-token, bob=bob-token")
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		body  string
+		code  int
+	}{
+		{"no token", "/runs/run-1/approvals/deploy", "", `{"decision": "approve"}`, http.StatusUnauthorized},
+		{"unknown token", "/runs/run-1/approvals/deploy", "guess", `{"decision": "approve"}`, http.StatusUnauthorized},
+		{"approver in the body", "/runs/run-1/approvals/deploy", "bob-token", `{"decision": "approve", "approver": "alice"}`, http.StatusForbidden},
+		{"bad decision", "/runs/run-1/approvals/deploy", "alice-token", `{"decision": "maybe"}`, http.StatusBadRequest},
+		{"unknown run", "/runs/run-2/approvals/deploy", "alice-token", `{"decision": "approve"}`, http.StatusNotFound},
+		{"no pending approval", "/runs/run-1/approvals/build", "alice-token", `{"decision": "approve"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post(tt.path, tt.token, tt.body); rec.Code != tt.code {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.code, rec.Body.String())
+			}
+		})
+	}
+
+	rec := post("/runs/run-1/approvals/deploy", "alice-token", `{"decision": "approve", "comment": "lgtm"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var got structures.Approval
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.State != structures.ApprovalApproved || got.Approver != "alice" {
+		t.Errorf("response = %+v, want approved by alice", got)
+	}
+	if a := <-decided; a.State != structures.ApprovalApproved || a.Comment != "lgtm" {
+		t.Errorf("AwaitApproval = %+v, want approved with alice's comment", a)
+	}
+
+	if rec := post("/runs/run-1/approvals/deploy", "alice-token", `{"decision": "reject"}`); rec.Code != http.StatusConflict {
+		t.Errorf("second decision: status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
@@ -7,13 +7,24 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"github.com/AlexSTJO/flume/internal/structures"
 )
 
 type Trigger struct {
-	Type string `json:"type"`
-	Cron string `json:"cron,omitempty"`
+	Type      string   `json:"type"`
+	Cron      string   `json:"cron,omitempty"`
+	Timezone  string   `json:"tz,omitempty"`
+	Jitter    string   `json:"jitter,omitempty"`
+	Overlap   string   `json:"overlap,omitempty"`
+	Events    []string `json:"events,omitempty"`
+	Branches  []string `json:"branches,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	Debounce  string   `json:"debounce,omitempty"`
+	Pipelines []string `json:"pipelines,omitempty"`
+	When      string   `json:"when,omitempty"`
 }
 
 type PipelineMeta struct {
@@ -42,14 +53,24 @@ func generateMeta(absPath string) (*PipelineMeta, error) {
 	}
 
 	t := Trigger{
-		Type: p.Trigger.Type,
-		Cron: p.Trigger.CronExpression,
+		Type:      p.Trigger.Type,
+		Cron:      p.Trigger.CronExpression,
+		Timezone:  p.Trigger.Timezone,
+		Jitter:    p.Trigger.Jitter,
+		Overlap:   p.Trigger.Overlap,
+		Events:    p.Trigger.Events,
+		Branches:  p.Trigger.Branches,
+		Paths:     p.Trigger.Paths,
+		Path:      p.Trigger.Path,
+		Debounce:  p.Trigger.Debounce,
+		Pipelines: p.Trigger.Pipelines,
+		When:      p.Trigger.When,
 	}
 	pm := &PipelineMeta{
 		Name:          p.Name,
 		YamlPath:      absPath,
 		Trigger:       t,
-		Enabled:       true,
+		Enabled:       p.Trigger.IsEnabled(),
 		YamlSha256:    sum,
 		YamlMtimeUnix: info.ModTime().Unix(),
 	}
@@ -96,7 +117,7 @@ func SyncMeta(yamlPath string) (bool, error, *PipelineMeta) {
 	if oldPM != nil &&
 		oldPM.YamlSha256 == newPM.YamlSha256 &&
 		oldPM.YamlMtimeUnix == newPM.YamlMtimeUnix &&
-		oldPM.Trigger == newPM.Trigger &&
+		reflect.DeepEqual(oldPM.Trigger, newPM.Trigger) &&
 		oldPM.Enabled == newPM.Enabled &&
 		oldPM.Name == newPM.Name &&
 		oldPM.YamlPath == newPM.YamlPath {
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/AlexSTJO/flume/internal/history"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+// RunRegistry tracks the runs started by this process. It saves a run to the
+// history store when it starts, when an approval is requested or decided,
+// and when it finishes, so finished runs outlive the server. Task progress
+// in between is only served from memory.
+type RunRegistry struct {
+	mu      sync.RWMutex
+	runs    map[string]*structures.RunInfo
+	cancels map[string]context.CancelFunc
+	store   history.Store
+}
+
+var runs *RunRegistry
+
+func NewRunRegistry(store history.Store) *RunRegistry {
+	return &RunRegistry{
+		runs:    make(map[string]*structures.RunInfo),
+		cancels: make(map[string]context.CancelFunc),
+		store:   store,
+	}
+}
+
+func (rr *RunRegistry) Add(r *structures.RunInfo, cancel context.CancelFunc) {
+	rr.mu.Lock()
+	rr.runs[r.RunID] = r
+	rr.cancels[r.RunID] = cancel
+	rr.mu.Unlock()
+	rr.Save(r)
+}
+
+// Finish releases the run's context and persists its final state. Once the
+// run is in the history store it is served from there, so the registry drops
+// it to keep a long-running server's memory bounded.
+func (rr *RunRegistry) Finish(r *structures.RunInfo) {
+	rr.mu.Lock()
+	cancel, ok := rr.cancels[r.RunID]
+	delete(rr.cancels, r.RunID)
+	rr.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	if rr.Save(r) {
+		rr.mu.Lock()
+		delete(rr.runs, r.RunID)
+		rr.mu.Unlock()
+	}
+}
+
+// Cancel stops an active run. It reports false when the run is unknown to
+// this process or has already finished.
+func (rr *RunRegistry) Cancel(id string) bool {
+	rr.mu.RLock()
+	cancel, ok := rr.cancels[id]
+	rr.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	cancel()
+	return true
+}
+
+// Save persists the run's current state and reports whether it was stored.
+func (rr *RunRegistry) Save(r *structures.RunInfo) bool {
+	if rr.store == nil {
+		return false
+	}
+	if err := rr.store.Save(r.Summary()); err != nil {
+		fmt.Printf("Error saving run %s to history: %v\n", r.RunID, err)
+		return false
+	}
+	return true
+}
+
+func (rr *RunRegistry) Get(id string) (*structures.RunInfo, bool) {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+	r, ok := rr.runs[id]
+	return r, ok
+}
+
+// Summary returns the live summary of a run started by this process, falling
+// back to the history store for older runs.
+func (rr *RunRegistry) Summary(id string) (*structures.RunSummary, error) {
+	if r, ok := rr.Get(id); ok {
+		s := r.Summary()
+		return &s, nil
+	}
+	if rr.store == nil {
+		return nil, history.ErrNotFound
+	}
+	return rr.store.Get(id)
+}
+
+func (rr *RunRegistry) List(f history.Filter) ([]structures.RunSummary, error) {
+	recs := []structures.RunSummary{}
+	if rr.store != nil {
+		stored, err := rr.store.List(f)
+		if err != nil {
+			return nil, err
+		}
+		recs = stored
+	}
+
+	// Live runs are fresher than whatever was last persisted for them.
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+	for i, rec := range recs {
+		if r, ok := rr.runs[rec.RunID]; ok {
+			recs[i] = r.Summary()
+		}
+	}
+	return recs, nil
+}
@@ -3,12 +3,14 @@ package server
 import (
 	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fsnotify/fsnotify"
 )
 
-func FileWatcher(c *CronManager) error {
+func FileWatcher(c *CronManager, ft *FileTriggers) error {
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("Error creating file watcher: %w", err)
@@ -16,7 +18,7 @@ func FileWatcher(c *CronManager) error {
 
 	defer w.Close()
 
-	go watchLoop(w, c)
+	go watchLoop(w, c, ft)
 	filepath := filepath.Join(".", ".flume")
 	if err = w.Add(filepath); err != nil {
 		return fmt.Errorf("Error adding directory to watcher: %w", err)
@@ -28,7 +30,7 @@ func FileWatcher(c *CronManager) error {
 
 }
 
-func watchLoop(w *fsnotify.Watcher, c *CronManager) {
+func watchLoop(w *fsnotify.Watcher, c *CronManager, ft *FileTriggers) {
 	for {
 		select {
 		case err, ok := <-w.Errors:
@@ -41,25 +43,83 @@ func watchLoop(w *fsnotify.Watcher, c *CronManager) {
 				return
 			}
 
-			if e.Op&fsnotify.Write == fsnotify.Write || e.Op&fsnotify.Create == fsnotify.Create {
-				ext := filepath.Ext(e.Name)
-				if ext == ".yaml" {
-					change, err, pm := SyncMeta(e.Name)
-					if err != nil {
-						fmt.Printf("ERROR: %s", err)
+			// New pipeline directories are watched as they appear, and
+			// pipelines copied in with them are picked up right away.
+			if e.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(e.Name); err == nil && info.IsDir() {
+					if err := addTree(w, e.Name); err != nil {
+						fmt.Printf("ERROR: %s\n", err)
 					}
-					if change {
-						if pm.Trigger.Type == "cron" {
-							c.ResyncCron(pm)
-						}
-						fmt.Printf("Synced file: %s\n", e.Name)
+					if name, ok := pipelineName(e.Name); ok {
+						syncPipeline(filepath.Join(e.Name, name+".yaml"), c, ft)
 					}
+					continue
+				}
+			}
+
+			name, ok := pipelineName(e.Name)
+			if !ok {
+				continue
+			}
+			if e.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				dir := filepath.Join(".", ".flume", name)
+				if _, err := os.Stat(filepath.Join(dir, name+".yaml")); err != nil {
+					c.Remove(name)
+					ft.Remove(name)
+					_ = os.Remove(filepath.Join(dir, "meta.json"))
+				}
+				continue
+			}
+			if e.Op&fsnotify.Write == fsnotify.Write || e.Op&fsnotify.Create == fsnotify.Create {
+				if filepath.Ext(e.Name) == ".yaml" {
+					syncPipeline(e.Name, c, ft)
 				}
 			}
 		}
 	}
 }
 
+// pipelineName returns the pipeline a path under .flume belongs to: its
+// directory .flume/<name> or its file .flume/<name>/<name>.yaml.
+func pipelineName(path string) (string, bool) {
+	rel, err := filepath.Rel(filepath.Join(".", ".flume"), path)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if parts[0] == "" || strings.HasPrefix(parts[0], ".") {
+		return "", false
+	}
+	switch len(parts) {
+	case 1:
+		return parts[0], true
+	case 2:
+		return parts[0], parts[1] == parts[0]+".yaml"
+	}
+	return "", false
+}
+
+func syncPipeline(yamlPath string, c *CronManager, ft *FileTriggers) {
+	if _, err := os.Stat(yamlPath); err != nil {
+		return
+	}
+	change, err, pm := SyncMeta(yamlPath)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		return
+	}
+	if !change {
+		return
+	}
+	if err := c.Sync(pm); err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+	}
+	if err := ft.Sync(pm); err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+	}
+	fmt.Printf("Synced file: %s\n", yamlPath)
+}
+
 func addTree(w *fsnotify.Watcher, root string) error {
 	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
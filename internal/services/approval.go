@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/resolver"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+type ApprovalService struct{}
+
+type approvalParams struct {
+	Message   string        `param:"message"`
+	Approvers []string      `param:"approvers"`
+	Timeout   time.Duration `param:"timeout"`
+}
+
+func (s ApprovalService) Name() string {
+	return "approval"
+}
+
+func (s ApprovalService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "message", Type: structures.ParamString, Default: "", Description: "What is being approved, shown with the run"},
+		{Name: "approvers", Type: structures.ParamList, Default: []any{}, Description: "Who may decide; anyone with an approval token when empty"},
+		{Name: "timeout", Type: structures.ParamDuration, Default: "0s", Description: "Reject when nobody decides in time; 0s waits forever"},
+	}
+}
+
+func (s ApprovalService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+	out := map[string]string{"success": "false", "approved": "false"}
+	defer ctx.SetEventValues(n, out)
+
+	var p approvalParams
+	if err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r); err != nil {
+		return err
+	}
+
+	l.InfoLogger(fmt.Sprintf("Waiting for approval of '%s' (POST /runs/%s/approvals/%s)", n, r.RunID, n))
+	a, err := r.AwaitApproval(c, n, structures.ApprovalRequest{
+		Summary:   p.Message,
+		Approvers: p.Approvers,
+		Timeout:   p.Timeout,
+	})
+	if err != nil {
+		return err
+	}
+	out["approver"] = a.Approver
+	out["comment"] = a.Comment
+
+	if err := a.Err(n); err != nil {
+		return err
+	}
+	l.SuccessLogger(fmt.Sprintf("'%s' approved by %s", n, a.Approver))
+	out["approved"] = "true"
+	out["success"] = "true"
+	return nil
+}
+
+func init() {
+	structures.Registry["approval"] = ApprovalService{}
+}
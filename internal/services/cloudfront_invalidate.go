@@ -18,6 +18,11 @@ type CloudfrontInvalidateService struct {
 	client *cloudfront.Client
 }
 
+type cloudfrontInvalidateParams struct {
+	DistID string   `param:"dist_id"`
+	Paths  []string `param:"paths"`
+}
+
 func NewCloudfrontInvalidateService() (*CloudfrontInvalidateService, error) {
 	cfg, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
@@ -33,46 +38,26 @@ func (s CloudfrontInvalidateService) Name() string {
 	return "cloudfront_invalidate"
 }
 
-func (s CloudfrontInvalidateService) Parameters() []string {
-	return []string{"dist_id", "paths"}
+func (s CloudfrontInvalidateService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "dist_id", Type: structures.ParamString, Required: true, Description: "CloudFront distribution ID"},
+		{Name: "paths", Type: structures.ParamList, Required: true, Description: "Paths to invalidate, e.g. /*"},
+	}
 }
 
-func (s CloudfrontInvalidateService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s CloudfrontInvalidateService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	runCtx := make(map[string]string, 1)
 	defer ctx.SetEventValues(n, runCtx)
 	runCtx["success"] = "false"
-	raw_dist_id, err := resolver.ResolveAny(t.Parameters["dist_id"], ctx, infra_outputs, r)
+	var p cloudfrontInvalidateParams
+	err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r)
 	if err != nil {
 		return err
 	}
-
-	dist_id, ok := raw_dist_id.(string)
-	if !ok {
-		return fmt.Errorf("Parameter 'dist_id' has to be a string")
-	}
-
-	raw_paths, err := resolver.ResolveAny(t.Parameters["paths"], ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	rawList, ok := raw_paths.([]any)
-	if !ok {
-		return fmt.Errorf("Parameter 'paths' has to be a list")
-	}
-
-	paths := make([]string, len(rawList))
-	for i, v := range rawList {
-		s, ok := v.(string)
-		if !ok {
-			return fmt.Errorf("all paths must be strings, got %T", v)
-		}
-		paths[i] = s
-	}
-	awsCtx := context.Background()
+	dist_id, paths := p.DistID, p.Paths
 
 	callerRef := fmt.Sprintf("flume-%d", time.Now().UnixNano())
-	if _, err = s.client.CreateInvalidation(awsCtx, &cloudfront.CreateInvalidationInput{
+	if _, err = s.client.CreateInvalidation(c, &cloudfront.CreateInvalidationInput{
 		DistributionId: aws.String(dist_id),
 		InvalidationBatch: &types.InvalidationBatch{
 			CallerReference: aws.String(callerRef),
@@ -1,9 +1,11 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"sort"
 
 	"github.com/AlexSTJO/flume/internal/logging"
 	"github.com/AlexSTJO/flume/internal/resolver"
@@ -14,97 +16,67 @@ import (
 type DockerBuildService struct {
 }
 
+type dockerBuildParams struct {
+	BuildPath   string            `param:"build_path"`
+	ImageName   string            `param:"image_name"`
+	Tag         string            `param:"tag"`
+	Attachments []string          `param:"attachments"`
+	BuildArgs   map[string]string `param:"build_args"`
+}
+
 func (s DockerBuildService) Name() string {
 	return "docker_build"
 }
 
-func (s DockerBuildService) Parameters() []string {
-	return []string{"build_path", "image_name", "tag", "attachments", "build_args"}
+func (s DockerBuildService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "build_path", Type: structures.ParamString, Required: true, Description: "Directory containing the Dockerfile"},
+		{Name: "image_name", Type: structures.ParamString, Required: true, Description: "Name of the image to build"},
+		{Name: "tag", Type: structures.ParamString, Required: true, Description: "Image tag"},
+		{Name: "attachments", Type: structures.ParamList, Default: []any{}, Description: "Directories copied into the build context first"},
+		{Name: "build_args", Type: structures.ParamMap, Description: "Values passed with --build-arg"},
+	}
 }
 
-func (s DockerBuildService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s DockerBuildService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	runCtx := make(map[string]string, 2)
 	runCtx["success"] = "false"
 	defer ctx.SetEventValues(n, runCtx)
-	raw_build_path, err := t.StringParam("build_path")
-	if err != nil {
-		return err
-	}
-	build_path, err := resolver.ResolveStringParam(raw_build_path, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_attachments := t.Parameters["attachments"]
-	resolved, err := resolver.ResolveAny(raw_attachments, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	attachments, err := resolver.ToStringSlice(resolved)
-	if err != nil {
-		return err
-	}
-	raw_image_name, err := t.StringParam("image_name")
-	if err != nil {
-		return err
-	}
-	image_name, err := resolver.ResolveString(raw_image_name, ctx, infra_outputs, r)
+	var p dockerBuildParams
+	err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r)
 	if err != nil {
 		return err
 	}
 
-	raw_tag, err := t.StringParam("tag")
-	if err != nil {
-		return err
-	}
-	tag, err := resolver.ResolveStringParam(raw_tag, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_build_args := t.Parameters["build_args"]
-	build_args := make(map[string]string)
-	if raw_build_args != nil {
-		a_build_args, err := resolver.ResolveAny(raw_build_args, ctx, infra_outputs, r)
-		if err != nil {
-			return err
-		}
-		t_build_args, ok := a_build_args.(map[string]string)
-		if !ok {
-			return fmt.Errorf("build args must be key value pairs")
-		}
-		build_args = t_build_args
-	}
-
-	for _, v := range attachments {
+	for _, v := range p.Attachments {
 		name := filepath.Base(filepath.Clean(v))
-		if err := utils.CopyDir(v, filepath.Join(build_path, name)); err != nil {
+		if err := utils.CopyDir(v, filepath.Join(p.BuildPath, name)); err != nil {
 			return err
 		}
 
 	}
 
-	imageRef := fmt.Sprintf("%s:%s", image_name, tag)
+	imageRef := fmt.Sprintf("%s:%s", p.ImageName, p.Tag)
 
 	args := []string{
 		"build",
 		"-t", imageRef,
 		"-f", "Dockerfile",
-		".",
 	}
 
-	flat_build_args := []string{}
-
-	for k, v := range build_args {
-		kp := []string{k, v}
-		flat_build_args = append(flat_build_args, kp...)
+	keys := make([]string, 0, len(p.BuildArgs))
+	for k := range p.BuildArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--build-arg", k+"="+p.BuildArgs[k])
 	}
 
-	args = append(args, flat_build_args...)
+	args = append(args, ".")
 
-	cmd := exec.Command("docker", args...)
-	cmd.Dir = build_path
+	cmd := exec.CommandContext(c, "docker", args...)
+	cmd.Dir = p.BuildPath
 
 	_, err = cmd.CombinedOutput()
 	if err != nil {
@@ -21,12 +21,22 @@ type EcrUploadService struct {
 	account_id string
 }
 
+type ecrUploadParams struct {
+	LocalImage string `param:"local_image"`
+	Registry   string `param:"registry"`
+	Tag        string `param:"tag"`
+}
+
 func (s EcrUploadService) Name() string {
 	return "ecr_upload"
 }
 
-func (s EcrUploadService) Parameters() []string {
-	return []string{"local_image", "registry", "tag"}
+func (s EcrUploadService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "local_image", Type: structures.ParamString, Required: true, Description: "Local image name, without tag"},
+		{Name: "registry", Type: structures.ParamString, Required: true, Description: "ECR repository name"},
+		{Name: "tag", Type: structures.ParamString, Required: true, Description: "Tag to push"},
+	}
 }
 
 func NewEcrUploadService() (*EcrUploadService, error) {
@@ -47,40 +57,17 @@ func NewEcrUploadService() (*EcrUploadService, error) {
 	}, nil
 }
 
-func (s EcrUploadService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s EcrUploadService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	runCtx := make(map[string]string, 2)
 	defer ctx.SetEventValues(n, runCtx)
 	runCtx["success"] = "false"
-	aws_context := context.Background()
-
-	raw_local_image, err := t.StringParam("local_image")
-	if err != nil {
-		return err
-	}
-	local_image, err := resolver.ResolveStringParam(raw_local_image, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_registry, err := t.StringParam("registry")
-	if err != nil {
-		return err
-	}
-	registry, err := resolver.ResolveStringParam(raw_registry, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_tag, err := t.StringParam("tag")
-	if err != nil {
-		return err
-	}
-	tag, err := resolver.ResolveStringParam(raw_tag, ctx, infra_outputs, r)
-	if err != nil {
+	var p ecrUploadParams
+	if err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r); err != nil {
 		return err
 	}
+	local_image, registry, tag := p.LocalImage, p.Registry, p.Tag
 
-	auth, err := s.client.GetAuthorizationToken(aws_context, &ecr.GetAuthorizationTokenInput{})
+	auth, err := s.client.GetAuthorizationToken(c, &ecr.GetAuthorizationTokenInput{})
 	if err != nil {
 		return err
 	}
@@ -95,7 +82,8 @@ func (s EcrUploadService) Run(t structures.Task, n string, ctx *structures.Conte
 
 	l.InfoLogger(fmt.Sprintf("Logging into registry: %s", registry))
 
-	login := exec.Command(
+	login := exec.CommandContext(
+		c,
 		"docker", "login",
 		"--username", username,
 		"--password-stdin",
@@ -113,13 +101,13 @@ func (s EcrUploadService) Run(t structures.Task, n string, ctx *structures.Conte
 	remote_image := fmt.Sprintf("%s:%s", registry, tag)
 	l.InfoLogger(fmt.Sprintf("Tagging Image: %s", remote_image))
 
-	if err := exec.Command("docker", "tag", local_image, remote_image).Run(); err != nil {
+	if err := exec.CommandContext(c, "docker", "tag", local_image, remote_image).Run(); err != nil {
 		err = fmt.Errorf("docker tag failed: %w", err)
 		l.ErrorLogger(err)
 		return err
 	}
 
-	cmd := exec.Command("docker", "push", remote_image)
+	cmd := exec.CommandContext(c, "docker", "push", remote_image)
 	_, err = cmd.CombinedOutput()
 	if err != nil {
 		err = fmt.Errorf("docker push failed: %w", err)
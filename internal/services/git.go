@@ -8,28 +8,36 @@ import (
 
 	"github.com/AlexSTJO/flume/internal/github"
 	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/resolver"
 	"github.com/AlexSTJO/flume/internal/structures"
 	"github.com/AlexSTJO/flume/internal/utils"
 )
 
 type GitService struct{}
 
+type gitParams struct {
+	RepoURL string `param:"repo_url"`
+}
+
 func (s GitService) Name() string {
 	return "git"
 }
 
-func (s GitService) Parameters() []string {
-	return []string{"repo_url"}
+func (s GitService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "repo_url", Type: structures.ParamString, Required: true, Description: "GitHub repository to clone"},
+	}
 }
 
-func (s GitService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s GitService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	runCtx := make(map[string]string, 2)
 	defer ctx.SetEventValues(n, runCtx)
 	runCtx["success"] = "false"
-	repo_url, err := t.StringParam("repo_url")
-	if err != nil {
+	var p gitParams
+	if err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r); err != nil {
 		return err
 	}
+	repo_url := p.RepoURL
 
 	repo_folder := filepath.Join(r.RunDir, "job_outputs", n)
 	owner, repo, err := utils.ParseGitHubRepo(repo_url)
@@ -37,7 +45,7 @@ func (s GitService) Run(t structures.Task, n string, ctx *structures.Context, in
 		return err
 	}
 
-	token, err := githubapp.InstallationTokenForRepo(context.Background(), owner, repo)
+	token, err := githubapp.InstallationTokenForRepo(c, owner, repo)
 	if err != nil {
 		return err
 	}
@@ -46,7 +54,7 @@ func (s GitService) Run(t structures.Task, n string, ctx *structures.Context, in
 
 	l.InfoLogger(fmt.Sprintf("Cloning repo '%s", repo_url))
 
-	cmd := exec.Command("git", "clone", app_repo_url, repo_folder)
+	cmd := exec.CommandContext(c, "git", "clone", app_repo_url, repo_folder)
 	_, err = cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("Error cloning repo: %w", err)
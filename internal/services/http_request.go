@@ -2,6 +2,8 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,86 +18,57 @@ import (
 type HttpRequest struct {
 }
 
+type httpRequestParams struct {
+	URL     string            `param:"url"`
+	Method  string            `param:"method"`
+	Body    string            `param:"body"`
+	Headers map[string]string `param:"headers"`
+	Timeout time.Duration     `param:"timeout"`
+}
+
 func (s HttpRequest) Name() string {
 	return "http_request"
 }
 
-func (s HttpRequest) Parameters() []string {
-	return []string{"url", "method"}
+func (s HttpRequest) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "url", Type: structures.ParamString, Required: true, Description: "Request URL"},
+		{Name: "method", Type: structures.ParamString, Default: "GET", Allowed: []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"}, Description: "HTTP method"},
+		{Name: "body", Type: structures.ParamString, Default: "", Description: "Request body"},
+		{Name: "headers", Type: structures.ParamMap, Default: map[string]any{}, Description: "Request headers"},
+		{Name: "timeout", Type: structures.ParamDuration, Default: "30s", Description: "Timeout for the whole request"},
+	}
 }
 
-func (s HttpRequest) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
-	runCtx := make(map[string]string)
-	defer ctx.SetEventValues(n, runCtx)
+func (s HttpRequest) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+	runCtx := make(map[string]any)
+	defer ctx.SetOutputs(n, runCtx)
+	runCtx["success"] = "false"
 
-	rawUrl, err := t.StringParam("url")
-	if err != nil {
+	var p httpRequestParams
+	if err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r); err != nil {
 		return err
 	}
-	url, err := resolver.ResolveStringParam(rawUrl, ctx, infra_outputs, r)
-	if err != nil {
-		return fmt.Errorf("resolving url: %w", err)
-	}
 
-	rawMethod, err := t.StringParam("method")
-	if err != nil {
-		return err
-	}
-	method, err := resolver.ResolveStringParam(rawMethod, ctx, infra_outputs, r)
-	if err != nil {
-		return fmt.Errorf("resolving url: %w", err)
-	}
-
-	rawBody, err := t.StringParam("body")
-	if err != nil {
-		return err
-	}
-	body, err := resolver.ResolveStringParam(rawBody, ctx, infra_outputs, r)
-	if err != nil {
-		return fmt.Errorf("resolving body: %w", err)
-	}
-
-	method = strings.ToUpper(method)
-
-	ValidMethods := map[string]bool{
-		"GET": true, "POST": true, "PUT": true, "DELETE": true, "PATCH": true, "HEAD": true, "OPTIONS": true,
-	}
-
-	if !ValidMethods[method] {
-		return fmt.Errorf("http method invalid: %s", method)
-	}
+	method := strings.ToUpper(p.Method)
+	url := p.URL
 
 	var reqBody io.Reader
-	if body != "" {
-		reqBody = bytes.NewBufferString(body)
+	if p.Body != "" {
+		reqBody = bytes.NewBufferString(p.Body)
 	}
 
-	req, err := http.NewRequest(method, url, reqBody)
+	req, err := http.NewRequestWithContext(c, method, url, reqBody)
 	if err != nil {
 		return fmt.Errorf("Creating Request: %w", err)
 	}
 
-	headersRaw, ok := t.Parameters["headers"].(map[string]any)
-	if !ok {
-		return fmt.Errorf("header parameters need to be a map")
-	}
-
-	res_headers, err := resolver.ResolveAny(headersRaw, ctx, infra_outputs, r)
-	if err != nil {
-		return fmt.Errorf("resolving headers: %w", err)
-	}
-
-	headers, ok := res_headers.(map[string]any)
-	if ok {
-		for key, val := range headers {
-			if strVal, ok := val.(string); ok {
-				req.Header.Set(key, strVal)
-			}
-		}
+	for key, val := range p.Headers {
+		req.Header.Set(key, val)
 	}
 
 	client := &http.Client{
-		Timeout: 30 & time.Second,
+		Timeout: p.Timeout,
 	}
 
 	l.InfoLogger(fmt.Sprintf("HTTP %s %s", method, url))
@@ -110,18 +83,37 @@ func (s HttpRequest) Run(t structures.Task, n string, ctx *structures.Context, i
 		return fmt.Errorf("reading response body: %w", err)
 	}
 
-	runCtx["status_code"] = fmt.Sprintf("%d", resp.StatusCode)
+	runCtx["status_code"] = resp.StatusCode
 	runCtx["body"] = string(respBody)
 	runCtx["content_type"] = resp.Header.Get("Content-Type")
 
+	headers := make(map[string]any, len(resp.Header))
+	for k := range resp.Header {
+		headers[strings.ToLower(k)] = resp.Header.Get(k)
+	}
+	runCtx["headers"] = headers
+
+	// JSON responses are also exposed parsed, so later tasks can reach into
+	// them with ${context:task.json.items[0].id}. Numbers stay json.Number so
+	// large IDs aren't rounded through float64.
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		var parsed any
+		dec := json.NewDecoder(bytes.NewReader(respBody))
+		dec.UseNumber()
+		if err := dec.Decode(&parsed); err == nil {
+			runCtx["json"] = parsed
+		} else {
+			l.WarnLogger(fmt.Sprintf("Response claims to be JSON but could not be parsed: %v", err))
+		}
+	}
+
 	l.InfoLogger(fmt.Sprintf("Response: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode)))
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		runCtx["success"] = "true"
-	} else {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
 	}
 
+	runCtx["success"] = "true"
 	return nil
 }
 
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -14,27 +15,32 @@ import (
 
 type JsonWriterService struct{}
 
+type jsonWriterParams struct {
+	FileName string         `param:"file_name"`
+	Data     map[string]any `param:"data"`
+}
+
 func (s JsonWriterService) Name() string {
 	return "json_writer"
 }
 
-func (s JsonWriterService) Parameters() []string {
-	return []string{"file_name", "data"}
+func (s JsonWriterService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "file_name", Type: structures.ParamString, Required: true, Description: "File written under the task's output directory; .json is appended if missing"},
+		{Name: "data", Type: structures.ParamMap, Required: true, Description: "Object to encode"},
+	}
 }
 
-func (s JsonWriterService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s JsonWriterService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	runCtx := make(map[string]string, 1)
 	defer ctx.SetEventValues(n, runCtx)
 	runCtx["success"] = "false"
 
-	u_file_name, err := t.StringParam("file_name")
-	if err != nil {
-		return err
-	}
-	file_name, err := resolver.ResolveStringParam(u_file_name, ctx, infra_outputs, r)
-	if err != nil {
+	var p jsonWriterParams
+	if err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r); err != nil {
 		return err
 	}
+	file_name := p.FileName
 
 	if !strings.HasSuffix(file_name, ".json") {
 		file_name = file_name + ".json"
@@ -42,20 +48,6 @@ func (s JsonWriterService) Run(t structures.Task, n string, ctx *structures.Cont
 
 	json_file := filepath.Join(r.RunDir, "job_outputs", n, file_name)
 
-	payload := make(map[string]any)
-	data, ok := t.Parameters["data"].(map[string]any)
-	if !ok {
-		return fmt.Errorf("json data is bad")
-	}
-	for k, v := range data {
-		payload[k] = v
-	}
-
-	resolved_payload, err := resolver.ResolveAny(payload, ctx, infra_outputs, r)
-	if err != nil {
-		return fmt.Errorf("Error resolving data: %w", err)
-	}
-
 	dir := filepath.Dir(json_file)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return fmt.Errorf("creating directory @ %s: %w", json_file, err)
@@ -69,7 +61,7 @@ func (s JsonWriterService) Run(t structures.Task, n string, ctx *structures.Cont
 	enc := json.NewEncoder(f)
 	enc.SetIndent("", "  ")
 
-	if err := enc.Encode(resolved_payload); err != nil {
+	if err := enc.Encode(p.Data); err != nil {
 		return fmt.Errorf("encoding json: %w", err)
 	}
 
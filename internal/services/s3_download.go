@@ -21,12 +21,24 @@ type S3DownloadService struct {
 	client *s3.Client
 }
 
+type s3DownloadParams struct {
+	Bucket      string `param:"bucket"`
+	Destination string `param:"destination"`
+	Key         string `param:"key"`
+	Prefix      string `param:"prefix"`
+}
+
 func (s S3DownloadService) Name() string {
 	return "s3_download"
 }
 
-func (s S3DownloadService) Parameters() []string {
-	return []string{"bucket", "destination"}
+func (s S3DownloadService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "bucket", Type: structures.ParamString, Required: true, Description: "Source bucket"},
+		{Name: "destination", Type: structures.ParamString, Required: true, Description: "Local file or directory to download into"},
+		{Name: "key", Type: structures.ParamString, Description: "Single object to download"},
+		{Name: "prefix", Type: structures.ParamString, Description: "Download every object under this prefix"},
+	}
 }
 
 func NewS3DownloadService() (*S3DownloadService, error) {
@@ -39,47 +51,25 @@ func NewS3DownloadService() (*S3DownloadService, error) {
 	}, nil
 }
 
-func (s S3DownloadService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s S3DownloadService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	runCtx := make(map[string]string)
 	defer ctx.SetEventValues(n, runCtx)
 	runCtx["success"] = "false"
 
-	rawBucket, err := t.StringParam("bucket")
-	if err != nil {
-		return err
-	}
-	bucket, err := resolver.ResolveStringParam(rawBucket, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	rawDestination, err := t.StringParam("destination")
-	if err != nil {
-		return err
-	}
-	destination, err := resolver.ResolveStringParam(rawDestination, ctx, infra_outputs, r)
-	if err != nil {
+	var p s3DownloadParams
+	if err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r); err != nil {
 		return err
 	}
-
-	var key, prefix string
-	if rawKey, err := t.StringParam("key"); err == nil {
-		key, _ = resolver.ResolveStringParam(rawKey, ctx, infra_outputs, r)
-	}
-	if rawPrefix, err := t.StringParam("prefix"); err == nil {
-		prefix, _ = resolver.ResolveStringParam(rawPrefix, ctx, infra_outputs, r)
-	}
+	bucket, destination, key, prefix := p.Bucket, p.Destination, p.Key, p.Prefix
 
 	if key == "" && prefix == "" {
 		return fmt.Errorf("s3_download: must provide either 'key' or 'prefix' parameter")
 	}
 
-	awsCtx := context.Background()
-
 	if key != "" {
 		l.InfoLogger(fmt.Sprintf("Downloading s3://%s/%s to %s", bucket, key, destination))
 
-		if err := s.downloadFile(awsCtx, bucket, key, destination); err != nil {
+		if err := s.downloadFile(c, bucket, key, destination); err != nil {
 			return err
 		}
 
@@ -97,7 +87,7 @@ func (s S3DownloadService) Run(t structures.Task, n string, ctx *structures.Cont
 
 	downloadCount := 0
 	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(awsCtx)
+		page, err := paginator.NextPage(c)
 		if err != nil {
 			return fmt.Errorf("listing objects: %w", err)
 		}
@@ -114,7 +104,7 @@ func (s S3DownloadService) Run(t structures.Task, n string, ctx *structures.Cont
 
 			destPath := filepath.Join(destination, relPath)
 
-			if err := s.downloadFile(awsCtx, bucket, objKey, destPath); err != nil {
+			if err := s.downloadFile(c, bucket, objKey, destPath); err != nil {
 				return err
 			}
 			downloadCount++
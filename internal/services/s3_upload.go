@@ -21,12 +21,22 @@ type S3UploadService struct {
 	client *s3.Client
 }
 
+type s3UploadParams struct {
+	Bucket string `param:"bucket"`
+	Source string `param:"source"`
+	Prefix string `param:"prefix"`
+}
+
 func (s S3UploadService) Name() string {
 	return "s3_upload"
 }
 
-func (s S3UploadService) Parameters() []string {
-	return []string{"bucket", "source", "prefix"}
+func (s S3UploadService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "bucket", Type: structures.ParamString, Required: true, Description: "Destination bucket"},
+		{Name: "source", Type: structures.ParamString, Required: true, Description: "Local directory to upload"},
+		{Name: "prefix", Type: structures.ParamString, Default: "", Description: "Key prefix for uploaded objects"},
+	}
 }
 
 func NewS3SyncService() (*S3UploadService, error) {
@@ -39,42 +49,20 @@ func NewS3SyncService() (*S3UploadService, error) {
 	}, nil
 }
 
-func (s S3UploadService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s S3UploadService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	runCtx := make(map[string]string, 1)
 	defer ctx.SetEventValues(n, runCtx)
 	runCtx["success"] = "false"
 
-	raw_bucket, err := t.StringParam("bucket")
-	if err != nil {
-		return err
-	}
-	bucket, err := resolver.ResolveStringParam(raw_bucket, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_source, err := t.StringParam("source")
-	if err != nil {
-		return err
-	}
-	source, err := resolver.ResolveStringParam(raw_source, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_prefix, err := t.StringParam("prefix")
-	if err != nil {
-		return err
-	}
-	prefix, err := resolver.ResolveStringParam(raw_prefix, ctx, infra_outputs, r)
+	var p s3UploadParams
+	err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r)
 	if err != nil {
 		return err
 	}
+	bucket, source, prefix := p.Bucket, p.Source, p.Prefix
 
 	l.InfoLogger(fmt.Sprintf("Uploading contents of '%s' to bucket: '%s' with prefix of '%s'", source, bucket, prefix))
 
-	awsCtx := context.Background()
-
 	err = filepath.WalkDir(source, func(path string, d os.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
@@ -104,7 +92,7 @@ func (s S3UploadService) Run(t structures.Task, n string, ctx *structures.Contex
 		if contentType == "" {
 			contentType = "application/octet-stream"
 		}
-		_, err = s.client.PutObject(awsCtx, &s3.PutObjectInput{
+		_, err = s.client.PutObject(c, &s3.PutObjectInput{
 			Bucket:      aws.String(bucket),
 			Key:         aws.String(key),
 			Body:        f,
@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,31 +10,36 @@ import (
 	"github.com/AlexSTJO/flume/internal/logging"
 	"github.com/AlexSTJO/flume/internal/resolver"
 	"github.com/AlexSTJO/flume/internal/structures"
+	"github.com/AlexSTJO/flume/internal/utils"
 )
 
 type ShellService struct{}
 
+type shellParams struct {
+	Command string `param:"command"`
+}
+
 func (s ShellService) Name() string {
 	return "shell"
 }
 
-func (s ShellService) Parameters() []string {
-	return []string{"command"}
+func (s ShellService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "command", Type: structures.ParamString, Required: true, Description: "Command run with sh -c"},
+	}
 }
 
-func (s ShellService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s ShellService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	rContext := make(map[string]string, 2)
-	raw_command, err := t.StringParam("command")
-	if err != nil {
-		return err
-	}
-	command, err := resolver.ResolveStringParam(raw_command, ctx, infra_outputs, r)
+	var p shellParams
+	err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r)
 	if err != nil {
 		rContext["success"] = "false"
 		ctx.SetEventValues(n, rContext)
 		return err
 	}
-	cmd := exec.Command("sh", "-c", command)
+	cmd := exec.CommandContext(c, "sh", "-c", p.Command)
+	utils.KillProcessGroup(cmd)
 
 	var outBuf, errBuf bytes.Buffer
 
@@ -46,6 +52,9 @@ func (s ShellService) Run(t structures.Task, n string, ctx *structures.Context,
 	if err != nil {
 		rContext["success"] = "false"
 		ctx.SetEventValues(n, rContext)
+		if c.Err() != nil {
+			return c.Err()
+		}
 		return fmt.Errorf("Shell Error Occurred: %v", err)
 	}
 
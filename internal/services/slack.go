@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -22,15 +23,29 @@ type slackMessage struct {
 	IconEmoji   string `json:"icon_emoji,omitempty"`
 }
 
+type slackParams struct {
+	WebhookURL string `param:"webhook_url"`
+	Message    string `param:"message"`
+	Channel    string `param:"channel"`
+	Username   string `param:"username"`
+	IconEmoji  string `param:"icon_emoji"`
+}
+
 func (s SlackService) Name() string {
 	return "slack"
 }
 
-func (s SlackService) Parameters() []string {
-	return []string{"webhook_url", "message"}
+func (s SlackService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "webhook_url", Type: structures.ParamString, Required: true, Secret: true, Description: "Incoming webhook URL"},
+		{Name: "message", Type: structures.ParamString, Required: true, Description: "Message text"},
+		{Name: "channel", Type: structures.ParamString, Description: "Overrides the webhook's default channel"},
+		{Name: "username", Type: structures.ParamString, Description: "Overrides the webhook's display name"},
+		{Name: "icon_emoji", Type: structures.ParamString, Description: "Overrides the webhook's icon"},
+	}
 }
 
-func (s SlackService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s SlackService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	runCtx := make(map[string]string)
 	var err error
 	defer func() {
@@ -38,45 +53,18 @@ func (s SlackService) Run(t structures.Task, n string, ctx *structures.Context,
 		ctx.SetEventValues(n, runCtx)
 	}()
 
-	rawWebhookURL, err := t.StringParam("webhook_url")
+	var p slackParams
+	err = resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r)
 	if err != nil {
 		return err
 	}
-	webhookURL, err := resolver.ResolveStringParam(rawWebhookURL, ctx, infra_outputs, r)
-	if err != nil {
-		return fmt.Errorf("resolving webhook_url: %w", err)
-	}
-
-	rawMessage, err := t.StringParam("message")
-	if err != nil {
-		return err
-	}
-	message, err := resolver.ResolveStringParam(rawMessage, ctx, infra_outputs, r)
-	if err != nil {
-		return fmt.Errorf("resolving message: %w", err)
-	}
+	webhookURL := p.WebhookURL
 
 	msg := slackMessage{
-		Text: message,
-	}
-
-	// Optional parameters
-	if rawChannel, err := t.StringParam("channel"); err == nil {
-		if channel, err := resolver.ResolveStringParam(rawChannel, ctx, infra_outputs, r); err == nil && channel != "" {
-			msg.Channel = channel
-		}
-	}
-
-	if rawUsername, err := t.StringParam("username"); err == nil {
-		if username, err := resolver.ResolveStringParam(rawUsername, ctx, infra_outputs, r); err == nil && username != "" {
-			msg.Username = username
-		}
-	}
-
-	if rawIconEmoji, err := t.StringParam("icon_emoji"); err == nil {
-		if iconEmoji, err := resolver.ResolveStringParam(rawIconEmoji, ctx, infra_outputs, r); err == nil && iconEmoji != "" {
-			msg.IconEmoji = iconEmoji
-		}
+		Text:      p.Message,
+		Channel:   p.Channel,
+		Username:  p.Username,
+		IconEmoji: p.IconEmoji,
 	}
 
 	payload, err := json.Marshal(msg)
@@ -84,7 +72,7 @@ func (s SlackService) Run(t structures.Task, n string, ctx *structures.Context,
 		return fmt.Errorf("marshaling slack message: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", webhookURL, bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(c, "POST", webhookURL, bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("creating request: %w", err)
 	}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"net/smtp"
 	"strconv"
@@ -13,15 +14,31 @@ import (
 
 type EmailService struct{}
 
+type emailParams struct {
+	Username  string `param:"username"`
+	Password  string `param:"password"`
+	Host      string `param:"host"`
+	Recipient string `param:"recipient"`
+	Subject   string `param:"subject"`
+	Body      string `param:"body"`
+}
+
 func (s EmailService) Name() string {
 	return "send_email"
 }
 
-func (s EmailService) Parameters() []string {
-	return []string{"username", "password", "host", "recipient", "subject", "body"}
+func (s EmailService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "username", Type: structures.ParamString, Required: true, Description: "SMTP login, also used as the sender"},
+		{Name: "password", Type: structures.ParamString, Required: true, Secret: true, Description: "SMTP password"},
+		{Name: "host", Type: structures.ParamString, Required: true, Description: "SMTP host, port 587 is used"},
+		{Name: "recipient", Type: structures.ParamString, Required: true, Description: "Recipient address"},
+		{Name: "subject", Type: structures.ParamString, Required: true, Description: "Subject line"},
+		{Name: "body", Type: structures.ParamString, Required: true, Description: "Plain text body"},
+	}
 }
 
-func (s EmailService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s EmailService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	tContext := make(map[string]string)
 	var err error
 	defer func() {
@@ -29,59 +46,13 @@ func (s EmailService) Run(t structures.Task, n string, ctx *structures.Context,
 		ctx.SetEventValues(n, tContext)
 	}()
 
-	raw_username, err := t.StringParam("username")
-	if err != nil {
-		return err
-	}
-	username, err := resolver.ResolveStringParam(raw_username, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_password, err := t.StringParam("password")
-	if err != nil {
-		return err
-	}
-	password, err := resolver.ResolveStringParam(raw_password, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_host, err := t.StringParam("host")
-	if err != nil {
-		return err
-	}
-	host, err := resolver.ResolveStringParam(raw_host, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_subject, err := t.StringParam("subject")
-	if err != nil {
-		return err
-	}
-	subject, err := resolver.ResolveStringParam(raw_subject, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_body, err := t.StringParam("body")
-	if err != nil {
-		return err
-	}
-	body, err := resolver.ResolveStringParam(raw_body, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_recipient, err := t.StringParam("recipient")
-	if err != nil {
-		return err
-	}
-	recipient, err := resolver.ResolveStringParam(raw_recipient, ctx, infra_outputs, r)
+	var p emailParams
+	err = resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r)
 	if err != nil {
 		return err
 	}
+	username, password, host := p.Username, p.Password, p.Host
+	recipient, subject, body := p.Recipient, p.Subject, p.Body
 
 	e := email.NewEmail()
 	e.From = username
@@ -92,6 +63,10 @@ func (s EmailService) Run(t structures.Task, n string, ctx *structures.Context,
 	addr := fmt.Sprintf("%s:%d", host, 587)
 	auth := smtp.PlainAuth("", username, password, host)
 
+	if err = c.Err(); err != nil {
+		return err
+	}
+
 	if err := e.Send(addr, auth); err != nil {
 		l.ErrorLogger(err)
 		return err
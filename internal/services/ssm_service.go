@@ -19,12 +19,20 @@ type SSMService struct {
 	client *ssm.Client
 }
 
+type ssmParams struct {
+	InstanceID string   `param:"instance_id"`
+	Commands   []string `param:"commands"`
+}
+
 func (s SSMService) Name() string {
 	return "ssm"
 }
 
-func (s SSMService) Parameters() []string {
-	return []string{"instance_id", "commands"}
+func (s SSMService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "instance_id", Type: structures.ParamString, Required: true, Description: "EC2 instance to run on"},
+		{Name: "commands", Type: structures.ParamList, Required: true, Description: "Shell commands run with AWS-RunShellScript"},
+	}
 }
 
 func NewSSMService() (*SSMService, error) {
@@ -37,35 +45,20 @@ func NewSSMService() (*SSMService, error) {
 	}, err
 }
 
-func (s SSMService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s SSMService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	runCtx := make(map[string]string, 2)
 	defer ctx.SetEventValues(n, runCtx)
 	runCtx["success"] = "false"
 
-	aws_ctx := context.Background()
-
-	raw_instance, err := t.StringParam("instance_id")
-	if err != nil {
-		return err
-	}
-	instance_id, err := resolver.ResolveStringParam(raw_instance, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-
-	raw_commands := t.Parameters["commands"]
-	res_commands, err := resolver.ResolveAny(raw_commands, ctx, infra_outputs, r)
-	if err != nil {
-		return err
-	}
-	commands, err := resolver.ToStringSlice(res_commands)
-	if err != nil {
+	var p ssmParams
+	if err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r); err != nil {
 		return err
 	}
+	instance_id, commands := p.InstanceID, p.Commands
 
 	l.InfoLogger(fmt.Sprintf("Sending commands: '%d' to instance: '%s'", len(commands), instance_id))
 
-	send_out, err := s.client.SendCommand(aws_ctx, &ssm.SendCommandInput{
+	send_out, err := s.client.SendCommand(c, &ssm.SendCommandInput{
 		DocumentName:   aws.String("AWS-RunShellScript"),
 		InstanceIds:    []string{instance_id},
 		TimeoutSeconds: aws.Int32(600),
@@ -89,17 +82,23 @@ func (s SSMService) Run(t structures.Task, n string, ctx *structures.Context, in
 
 	for {
 		if time.Now().After(deadline) {
-			return fmt.Errorf("timeout waiting for command %s", cmd_id)
+			return s.cancelCommand(cmd_id, instance_id, l, fmt.Errorf("timeout waiting for command %s", cmd_id))
+		}
+		if c.Err() != nil {
+			return s.cancelCommand(cmd_id, instance_id, l, c.Err())
 		}
 
-		inv, err := s.client.GetCommandInvocation(aws_ctx, &ssm.GetCommandInvocationInput{
+		inv, err := s.client.GetCommandInvocation(c, &ssm.GetCommandInvocationInput{
 			CommandId:  aws.String(cmd_id),
 			InstanceId: aws.String(instance_id),
 		})
 
 		if err != nil {
+			if c.Err() != nil {
+				return s.cancelCommand(cmd_id, instance_id, l, c.Err())
+			}
 			if strings.Contains(err.Error(), "InvocationDoesNotExist") {
-				time.Sleep(2 * time.Second)
+				sleepCtx(c, 2*time.Second)
 				continue
 			}
 			return fmt.Errorf("get command invocation: %w", err)
@@ -125,7 +124,7 @@ func (s SSMService) Run(t structures.Task, n string, ctx *structures.Context, in
 		case types.CommandInvocationStatusPending,
 			types.CommandInvocationStatusInProgress,
 			types.CommandInvocationStatusDelayed:
-			time.Sleep(2 * time.Second)
+			sleepCtx(c, 2*time.Second)
 			continue
 		default:
 			if inv.Status != types.CommandInvocationStatusSuccess {
@@ -137,6 +136,31 @@ func (s SSMService) Run(t structures.Task, n string, ctx *structures.Context, in
 	}
 }
 
+// cancelCommand stops a command the run no longer wants, either because the
+// run was cancelled or the wait timed out. The run context may already be
+// done, so the API call gets its own short deadline.
+func (s SSMService) cancelCommand(cmd_id string, instance_id string, l *logging.Config, cause error) error {
+	l.WarnLogger(fmt.Sprintf("Cancelling SSM command %s", cmd_id))
+	cancel_ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := s.client.CancelCommand(cancel_ctx, &ssm.CancelCommandInput{
+		CommandId:   aws.String(cmd_id),
+		InstanceIds: []string{instance_id},
+	})
+	if err != nil {
+		l.ErrorLogger(fmt.Errorf("cancel command %s: %w", cmd_id, err))
+	}
+	return cause
+}
+
+func sleepCtx(c context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-c.Done():
+	}
+}
+
 func deref(p *string) string {
 	if p == nil {
 		return ""
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+	"github.com/AlexSTJO/flume/internal/resolver"
+	"github.com/AlexSTJO/flume/internal/structures"
+)
+
+type TriggerPipelineService struct{}
+
+type triggerPipelineParams struct {
+	Pipeline   string            `param:"pipeline"`
+	Parameters map[string]string `param:"parameters"`
+	Wait       bool              `param:"wait"`
+	FailOnFail bool              `param:"fail_on_failure"`
+}
+
+func (s TriggerPipelineService) Name() string {
+	return "trigger_pipeline"
+}
+
+func (s TriggerPipelineService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "pipeline", Type: structures.ParamString, Required: true, Description: "Pipeline ref to start, like pipeline_ref in POST /run"},
+		{Name: "parameters", Type: structures.ParamMap, Default: map[string]any{}, Description: "Parameters for the child run"},
+		{Name: "wait", Type: structures.ParamBool, Default: true, Description: "Wait for the child run to finish"},
+		{Name: "fail_on_failure", Type: structures.ParamBool, Default: true, Description: "Fail the task when the awaited child run does not succeed"},
+	}
+}
+
+func (s TriggerPipelineService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+	out := map[string]any{"success": "false"}
+	defer ctx.SetOutputs(n, out)
+
+	var p triggerPipelineParams
+	if err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r); err != nil {
+		return err
+	}
+	if structures.Launch == nil {
+		return fmt.Errorf("trigger_pipeline is not available in this mode")
+	}
+
+	child, cancel, err := structures.Launch(structures.LaunchRequest{
+		PipelineRef: p.Pipeline,
+		Params:      p.Parameters,
+		Trigger:     "pipeline",
+		Event: map[string]string{
+			"pipeline": r.Pipeline,
+			"run_id":   r.RunID,
+			"task":     n,
+		},
+		Parent: r,
+	})
+	if err != nil {
+		return fmt.Errorf("Error starting pipeline %s: %w", p.Pipeline, err)
+	}
+	out["run_id"] = child.RunID
+	out["pipeline"] = child.Pipeline
+	l.InfoLogger(fmt.Sprintf("Started pipeline %s, run %s", child.Pipeline, child.RunID))
+
+	if !p.Wait {
+		out["state"] = string(child.Status.State())
+		out["success"] = "true"
+		return nil
+	}
+
+	// The child's tasks may need the slot this task holds.
+	structures.ReleaseSlot(c)
+	select {
+	case <-child.Status.Done():
+	case <-c.Done():
+		l.WarnLogger(fmt.Sprintf("Cancelling child run %s", child.RunID))
+		cancel()
+		<-child.Status.Done()
+		out["state"] = string(child.Status.State())
+		return c.Err()
+	}
+
+	summary := child.Summary()
+	out["state"] = string(summary.State)
+	outputs := make(map[string]any, len(summary.Outputs))
+	for task, values := range summary.Outputs {
+		outputs[task] = values
+	}
+	out["outputs"] = outputs
+	if summary.Error != "" {
+		out["error"] = summary.Error
+	}
+	l.InfoLogger(fmt.Sprintf("Pipeline %s run %s finished: %s", child.Pipeline, child.RunID, summary.State))
+
+	if summary.State != structures.RunSucceeded && p.FailOnFail {
+		return fmt.Errorf("pipeline %s run %s %s", child.Pipeline, child.RunID, summary.State)
+	}
+	out["success"] = "true"
+	return nil
+}
+
+func init() {
+	structures.Registry["trigger_pipeline"] = TriggerPipelineService{}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -11,36 +12,37 @@ import (
 
 type WaitService struct{}
 
+type waitParams struct {
+	Duration time.Duration `param:"duration"`
+}
+
 func (s WaitService) Name() string {
 	return "wait"
 }
 
-func (s WaitService) Parameters() []string {
-	return []string{"duration"}
+func (s WaitService) Parameters() []structures.ParamSpec {
+	return []structures.ParamSpec{
+		{Name: "duration", Type: structures.ParamDuration, Required: true, Description: "How long to wait, e.g. 30s or 5m"},
+	}
 }
 
-func (s WaitService) Run(t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
+func (s WaitService) Run(c context.Context, t structures.Task, n string, ctx *structures.Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *structures.RunInfo) error {
 	runCtx := make(map[string]string, 1)
 	defer ctx.SetEventValues(n, runCtx)
 	runCtx["success"] = "false"
 
-	u_duration, err := t.StringParam("duration")
-	if err != nil {
-		return err
-	}
-	durationStr, err := resolver.ResolveStringParam(u_duration, ctx, infra_outputs, r)
-	if err != nil {
+	var p waitParams
+	if err := resolver.DecodeParams(c, t, s.Parameters(), &p, ctx, infra_outputs, r); err != nil {
 		return err
 	}
 
-	duration, err := time.ParseDuration(durationStr)
-	if err != nil {
-		return fmt.Errorf("invalid duration %q: %w (use format like 5s, 1m, 500ms)", durationStr, err)
+	l.InfoLogger(fmt.Sprintf("Waiting for %s", p.Duration))
+	select {
+	case <-time.After(p.Duration):
+	case <-c.Done():
+		return c.Err()
 	}
 
-	l.Info(fmt.Sprintf("Waiting for %s", duration))
-	time.Sleep(duration)
-
 	runCtx["success"] = "true"
 	return nil
 }
@@ -0,0 +1,179 @@
+package structures
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// RunWaitingForApproval is the state of a running run while at least one of
+// its tasks or deployments waits for a human decision.
+const RunWaitingForApproval RunState = "waiting_for_approval"
+
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+var (
+	ErrNoPendingApproval = errors.New("No pending approval")
+	ErrNotApprover       = errors.New("Approver is not allowed to decide this approval")
+)
+
+// Approval is a request for a human to approve a task or deployment before
+// it goes on. Plan holds the Terraform plan of a deployment's apply.
+type Approval struct {
+	State       string     `json:"state"`
+	Summary     string     `json:"summary,omitempty"`
+	Plan        string     `json:"plan,omitempty"`
+	Approvers   []string   `json:"approvers,omitempty"`
+	RequestedAt time.Time  `json:"requested_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+	Approver    string     `json:"approver,omitempty"`
+	Comment     string     `json:"comment,omitempty"`
+
+	decided chan struct{}
+}
+
+// ApprovalRequest describes what needs approving. Approvers, when set, limit
+// who may decide; a zero Timeout waits until someone does.
+type ApprovalRequest struct {
+	Summary   string
+	Plan      string
+	Approvers []string
+	Timeout   time.Duration
+}
+
+// ApprovalDecision is a decision on an approval. Force skips the approvers
+// check; it is meant for decisions flume or the operator of a local run make.
+type ApprovalDecision struct {
+	Approve  bool
+	Approver string
+	Comment  string
+	Force    bool
+}
+
+// OnApproval, when set, is called in its own goroutine for every new
+// approval. The CLI uses it to ask on the terminal; the server records the
+// waiting run and takes decisions over the API.
+var OnApproval func(r *RunInfo, name string, a Approval)
+
+// AwaitApproval pauses the caller until the approval named name is decided,
+// times out or c is cancelled. A timed out approval is rejected.
+func (r *RunInfo) AwaitApproval(c context.Context, name string, req ApprovalRequest) (Approval, error) {
+	a := r.Status.requestApproval(name, req)
+	ReleaseSlot(c)
+	if OnApproval != nil {
+		go OnApproval(r, name, a)
+	}
+
+	var expired <-chan time.Time
+	if req.Timeout > 0 {
+		timer := time.NewTimer(req.Timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-a.decided:
+	case <-expired:
+		r.Status.Decide(name, ApprovalDecision{Comment: fmt.Sprintf("No decision within %s", req.Timeout), Force: true})
+	case <-c.Done():
+		r.Status.Decide(name, ApprovalDecision{Comment: "Run cancelled", Force: true})
+		return r.Status.approval(name), c.Err()
+	}
+	return r.Status.approval(name), nil
+}
+
+// Err returns nil when the approval was granted, and otherwise an error
+// saying who rejected it and why.
+func (a Approval) Err(name string) error {
+	if a.State == ApprovalApproved {
+		return nil
+	}
+	msg := fmt.Sprintf("Approval for '%s' rejected", name)
+	if a.Approver != "" {
+		msg += " by " + a.Approver
+	}
+	if a.Comment != "" {
+		msg += ": " + a.Comment
+	}
+	return errors.New(msg)
+}
+
+func (s *RunStatus) requestApproval(name string, req ApprovalRequest) Approval {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	a := &Approval{
+		State:       ApprovalPending,
+		Summary:     req.Summary,
+		Plan:        req.Plan,
+		Approvers:   req.Approvers,
+		RequestedAt: now,
+		decided:     make(chan struct{}),
+	}
+	if req.Timeout > 0 {
+		expires := now.Add(req.Timeout)
+		a.ExpiresAt = &expires
+	}
+	if s.approvals == nil {
+		s.approvals = map[string]*Approval{}
+	}
+	s.approvals[name] = a
+	s.syncWaiting()
+	return *a
+}
+
+// Decide records a decision on a pending approval and returns the result.
+func (s *RunStatus) Decide(name string, d ApprovalDecision) (Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.approvals[name]
+	if !ok || a.State != ApprovalPending {
+		return Approval{}, ErrNoPendingApproval
+	}
+	if !d.Force && len(a.Approvers) > 0 && !slices.Contains(a.Approvers, d.Approver) {
+		return Approval{}, ErrNotApprover
+	}
+
+	now := time.Now().UTC()
+	a.State = ApprovalRejected
+	if d.Approve {
+		a.State = ApprovalApproved
+	}
+	a.Approver = d.Approver
+	a.Comment = d.Comment
+	a.DecidedAt = &now
+	close(a.decided)
+	s.syncWaiting()
+	return *a, nil
+}
+
+func (s *RunStatus) approval(name string) Approval {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if a, ok := s.approvals[name]; ok {
+		return *a
+	}
+	return Approval{}
+}
+
+// syncWaiting moves a running run in and out of waiting_for_approval. The
+// caller holds s.mu.
+func (s *RunStatus) syncWaiting() {
+	if s.state != RunRunning && s.state != RunWaitingForApproval {
+		return
+	}
+	s.state = RunRunning
+	for _, a := range s.approvals {
+		if a.State == ApprovalPending {
+			s.state = RunWaitingForApproval
+			return
+		}
+	}
+}
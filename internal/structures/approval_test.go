@@ -0,0 +1,125 @@
+package structures
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newApprovalRun() *RunInfo {
+	r := &RunInfo{RunID: "run-1", Status: NewRunStatus()}
+	r.Status.Start([]string{"deploy"})
+	return r
+}
+
+// waitForApproval returns once the run waits on an approval.
+func waitForApproval(r *RunInfo) {
+	for r.Status.State() != RunWaitingForApproval {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAwaitApproval(t *testing.T) {
+	r := newApprovalRun()
+	released := false
+	c := WithSlotRelease(context.Background(), func() { released = true })
+
+	errs := make(chan error, 3)
+	go func() {
+		waitForApproval(r)
+		_, err := r.Status.Decide("deploy", ApprovalDecision{Approve: true, Approver: "mallory"})
+		errs <- err
+		_, err = r.Status.Decide("deploy", ApprovalDecision{Approve: true, Approver: "alice", Comment: "lgtm"})
+		errs <- err
+		_, err = r.Status.Decide("deploy", ApprovalDecision{Approve: false, Approver: "bob"})
+		errs <- err
+	}()
+
+	a, err := r.AwaitApproval(c, "deploy", ApprovalRequest{Summary: "ship it", Approvers: []string{"alice", "bob"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; !errors.Is(err, ErrNotApprover) {
+		t.Errorf("decision by a non-approver: err = %v, want %v", err, ErrNotApprover)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("decision by an approver: %v", err)
+	}
+	if err := <-errs; !errors.Is(err, ErrNoPendingApproval) {
+		t.Errorf("second decision: err = %v, want %v", err, ErrNoPendingApproval)
+	}
+
+	if a.State != ApprovalApproved || a.Approver != "alice" || a.Comment != "lgtm" || a.DecidedAt == nil {
+		t.Errorf("approval = %+v, want approved by alice", a)
+	}
+	if err := a.Err("deploy"); err != nil {
+		t.Errorf("Err = %v, want nil", err)
+	}
+	if !released {
+		t.Error("the waiting task kept its slots")
+	}
+	if got := r.Status.State(); got != RunRunning {
+		t.Errorf("run state = %s, want %s", got, RunRunning)
+	}
+	if got := r.Summary().Approvals["deploy"].State; got != ApprovalApproved {
+		t.Errorf("summary approval state = %s, want %s", got, ApprovalApproved)
+	}
+}
+
+func TestAwaitApprovalTimeout(t *testing.T) {
+	r := newApprovalRun()
+	a, err := r.AwaitApproval(context.Background(), "deploy", ApprovalRequest{Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.State != ApprovalRejected || a.Comment != "No decision within 10ms" || a.ExpiresAt == nil {
+		t.Errorf("approval = %+v, want rejected for want of a decision", a)
+	}
+	if got, want := a.Err("deploy").Error(), "Approval for 'deploy' rejected: No decision within 10ms"; got != want {
+		t.Errorf("Err = %q, want %q", got, want)
+	}
+	if got := r.Status.State(); got != RunRunning {
+		t.Errorf("run state = %s, want %s", got, RunRunning)
+	}
+}
+
+func TestAwaitApprovalCancelled(t *testing.T) {
+	r := newApprovalRun()
+	c, cancel := context.WithCancel(context.Background())
+	go func() {
+		waitForApproval(r)
+		cancel()
+	}()
+
+	a, err := r.AwaitApproval(c, "deploy", ApprovalRequest{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if a.State != ApprovalRejected || a.Comment != "Run cancelled" {
+		t.Errorf("approval = %+v, want rejected by the cancel", a)
+	}
+}
+
+func TestDecideWithoutApproval(t *testing.T) {
+	r := newApprovalRun()
+	if _, err := r.Status.Decide("deploy", ApprovalDecision{Approve: true, Approver: "alice"}); !errors.Is(err, ErrNoPendingApproval) {
+		t.Errorf("err = %v, want %v", err, ErrNoPendingApproval)
+	}
+}
+
+func TestApprovalErr(t *testing.T) {
+	tests := []struct {
+		a    Approval
+		want string
+	}{
+		{Approval{State: ApprovalRejected}, "Approval for 'deploy' rejected"},
+		{Approval{State: ApprovalRejected, Approver: "bob"}, "Approval for 'deploy' rejected by bob"},
+		{Approval{State: ApprovalRejected, Approver: "bob", Comment: "not today"}, "Approval for 'deploy' rejected by bob: not today"},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Err("deploy"); got == nil || got.Error() != tt.want {
+			t.Errorf("Err = %v, want %q", got, tt.want)
+		}
+	}
+}
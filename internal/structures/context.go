@@ -1,19 +1,180 @@
 package structures
 
+import (
+	"sort"
+	"sync"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+)
+
+// Context holds the outputs of every task that has finished in a run, keyed
+// by task name. Values can be strings, numbers, booleans, lists or nested
+// maps. It is safe for concurrent use: writers store a copy and readers get
+// a copy, so no caller can see another goroutine's map being mutated.
+// Secret values known to the redactor are masked as outputs are stored.
 type Context struct {
-	Events map[string]map[string]string
+	mu       sync.RWMutex
+	events   map[string]map[string]any
+	redactor *logging.Redactor
 }
 
 func NewContext() *Context {
 	return &Context{
-		Events: make(map[string]map[string]string),
+		events: make(map[string]map[string]any),
 	}
 }
 
+// SetRedactor masks the redactor's values in stored outputs. It must be
+// called before the run starts.
+func (c *Context) SetRedactor(r *logging.Redactor) {
+	c.redactor = r
+}
+
+// SetEventValues records flat string outputs for a task.
 func (c *Context) SetEventValues(key string, values map[string]string) {
-	c.Events[key] = values
+	out := make(map[string]any, len(values))
+	for k, v := range values {
+		out[k] = c.redactor.Redact(v)
+	}
+	c.mu.Lock()
+	c.events[key] = out
+	c.mu.Unlock()
 }
 
+// SetOutputs records typed outputs for a task.
+func (c *Context) SetOutputs(key string, values map[string]any) {
+	out := copyOutputs(values)
+	for k, v := range out {
+		out[k] = redactValue(c.redactor, v)
+	}
+	c.mu.Lock()
+	c.events[key] = out
+	c.mu.Unlock()
+}
+
+// GetEventValues returns a task's outputs with every value formatted as a
+// string.
 func (c *Context) GetEventValues(key string) map[string]string {
-	return c.Events[key]
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	values := c.events[key]
+	if values == nil {
+		return nil
+	}
+	out := make(map[string]string, len(values))
+	for k, v := range values {
+		out[k] = FormatValue(v)
+	}
+	return out
+}
+
+func (c *Context) GetOutputs(key string) map[string]any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return copyOutputs(c.events[key])
+}
+
+// Tasks lists the tasks that have recorded outputs, sorted by name.
+func (c *Context) Tasks() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.events))
+	for name := range c.events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Snapshot returns a deep copy of every task's outputs.
+func (c *Context) Snapshot() map[string]map[string]any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make(map[string]map[string]any, len(c.events))
+	for name, values := range c.events {
+		out[name] = copyOutputs(values)
+	}
+	return out
+}
+
+// Lookup finds the value at path inside a task's outputs, e.g. task
+// "api_call" and path "json.items[0].id". found is false when the task, key
+// or index does not exist.
+func (c *Context) Lookup(task string, path string) (any, bool, error) {
+	segments, err := ParseOutputPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	values, ok := c.events[task]
+	if !ok {
+		return nil, false, nil
+	}
+	v, found := LookupPath(values, segments)
+	return copyValue(v), found, nil
+}
+
+func copyOutputs(values map[string]any) map[string]any {
+	if values == nil {
+		return nil
+	}
+	out := make(map[string]any, len(values))
+	for k, v := range values {
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+func copyValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		return copyOutputs(t)
+	case []any:
+		out := make([]any, len(t))
+		for i, item := range t {
+			out[i] = copyValue(item)
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]string, len(t))
+		for k, s := range t {
+			out[k] = s
+		}
+		return out
+	case []string:
+		return append([]string(nil), t...)
+	default:
+		return v
+	}
+}
+
+// redactValue masks secrets in the strings of a value that is already a
+// private copy, so maps and slices are rewritten in place.
+func redactValue(r *logging.Redactor, v any) any {
+	if r == nil {
+		return v
+	}
+	switch t := v.(type) {
+	case string:
+		return r.Redact(t)
+	case map[string]any:
+		for k, item := range t {
+			t[k] = redactValue(r, item)
+		}
+	case []any:
+		for i, item := range t {
+			t[i] = redactValue(r, item)
+		}
+	case map[string]string:
+		for k, item := range t {
+			t[k] = r.Redact(item)
+		}
+	case []string:
+		for i, item := range t {
+			t[i] = r.Redact(item)
+		}
+	}
+	return v
 }
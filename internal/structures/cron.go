@@ -0,0 +1,48 @@
+package structures
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser accepts standard five field expressions, six field ones with a
+// leading seconds field, and descriptors such as @hourly or @every 30s.
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseCron parses a cron trigger's expression in its timezone. Without a
+// timezone the server's local time is used.
+func ParseCron(t TriggerSpec) (cron.Schedule, error) {
+	expr := strings.TrimSpace(t.CronExpression)
+	if expr == "" {
+		return nil, fmt.Errorf("cron trigger needs a 'cron_expression'")
+	}
+	if t.Timezone != "" {
+		if strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+			return nil, fmt.Errorf("timezone is set both in 'tz' and in the cron expression")
+		}
+		if _, err := time.LoadLocation(t.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone '%s'", t.Timezone)
+		}
+		expr = "CRON_TZ=" + t.Timezone + " " + expr
+	}
+	s, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression '%s': %v", t.CronExpression, err)
+	}
+	return s, nil
+}
+
+// CronJitter returns the trigger's jitter, zero when unset.
+func CronJitter(t TriggerSpec) (time.Duration, error) {
+	if t.Jitter == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(t.Jitter)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("jitter must be a duration like 30s, got '%s'", t.Jitter)
+	}
+	return d, nil
+}
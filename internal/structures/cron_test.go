@@ -0,0 +1,81 @@
+package structures
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	tests := []struct {
+		name string
+		spec TriggerSpec
+		want time.Time
+	}{
+		{"five fields", TriggerSpec{CronExpression: "30 9 * * *", Timezone: "UTC"}, time.Date(2026, 3, 4, 9, 30, 0, 0, time.UTC)},
+		{"seconds field", TriggerSpec{CronExpression: "15 */10 * * * *", Timezone: "UTC"}, time.Date(2026, 3, 4, 5, 10, 15, 0, time.UTC)},
+		{"descriptor", TriggerSpec{CronExpression: "@every 30s"}, from.Add(30 * time.Second)},
+		{"hourly", TriggerSpec{CronExpression: "@hourly", Timezone: "UTC"}, time.Date(2026, 3, 4, 6, 0, 0, 0, time.UTC)},
+		// 09:30 in Tokyo is 00:30 UTC, so the next one is on the 5th.
+		{"timezone", TriggerSpec{CronExpression: "30 9 * * *", Timezone: "Asia/Tokyo"}, time.Date(2026, 3, 5, 0, 30, 0, 0, time.UTC)},
+		{"timezone in expression", TriggerSpec{CronExpression: "CRON_TZ=Asia/Tokyo 30 9 * * *"}, time.Date(2026, 3, 5, 0, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next = %s, want %s", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		spec TriggerSpec
+		err  string
+	}{
+		{TriggerSpec{}, "needs a 'cron_expression'"},
+		{TriggerSpec{CronExpression: "61 * * * *"}, "invalid cron expression '61 * * * *'"},
+		{TriggerSpec{CronExpression: "* * *"}, "invalid cron expression"},
+		{TriggerSpec{CronExpression: "0 9 * * *", Timezone: "Mars/Olympus"}, "unknown timezone 'Mars/Olympus'"},
+		{TriggerSpec{CronExpression: "CRON_TZ=UTC 0 9 * * *", Timezone: "UTC"}, "timezone is set both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec.CronExpression, func(t *testing.T) {
+			_, err := ParseCron(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseCron error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCronJitter(t *testing.T) {
+	tests := []struct {
+		jitter string
+		want   time.Duration
+		err    bool
+	}{
+		{"", 0, false},
+		{"30s", 30 * time.Second, false},
+		{"1m30s", 90 * time.Second, false},
+		{"soon", 0, true},
+		{"-5s", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.jitter, func(t *testing.T) {
+			got, err := CronJitter(TriggerSpec{Jitter: tt.jitter})
+			if (err != nil) != tt.err {
+				t.Fatalf("CronJitter error = %v, want error %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("CronJitter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,18 +2,40 @@ package structures
 
 import (
 	"fmt"
-	"gopkg.in/yaml.v3"
 	"os"
+
+	"gopkg.in/yaml.v3"
 )
 
 type Pipeline struct {
 	Name           string                `yaml:"name"`
 	Tasks          map[string]Task       `yaml:"tasks"`
 	DisableLogging bool                  `yaml:"disable_logging,omitempty"`
+	OnFailure      string                `yaml:"on_failure,omitempty"`
+	MaxParallel    int                   `yaml:"max_parallel,omitempty"`
 	Trigger        TriggerSpec           `yaml:"trigger"`
 	Infrastructure map[string]Deployment `yaml:"infrastructure"`
+	ReportStatus   *StatusReport         `yaml:"report_status,omitempty"`
+}
+
+// StatusReport opts a pipeline into GitHub check runs. Repo (owner/name) and
+// SHA are usually ${trigger:repo} and ${trigger:sha}.
+type StatusReport struct {
+	Repo       string `yaml:"repo"`
+	SHA        string `yaml:"sha"`
+	Name       string `yaml:"name,omitempty"`
+	DetailsURL string `yaml:"details_url,omitempty"`
 }
 
+// Failure policies for Pipeline.OnFailure. fail_fast cancels running tasks on
+// the first failure, finish_running lets them complete but starts nothing new,
+// and continue keeps running every task that does not depend on the failure.
+const (
+	FailFast        = "fail_fast"
+	ContinueOnError = "continue"
+	FinishRunning   = "finish_running"
+)
+
 type RetryConfig struct {
 	MaxAttempts int    `yaml:"max_attempts,omitempty"`
 	Delay       string `yaml:"delay,omitempty"`
@@ -29,62 +51,167 @@ type Task struct {
 	Resources    []string       `yaml:"resources,omitempty"`
 	Retry        RetryConfig    `yaml:"retry,omitempty"`
 	Timeout      string         `yaml:"timeout,omitempty"`
+	AllowFailure bool           `yaml:"allow_failure,omitempty"`
 }
 
 type TriggerSpec struct {
-	Type           string `yaml:"type"`
-	CronExpression string `yaml:"cron_expression,omitempty"`
-	Timezone       string `yaml:"tz,omitempty"`
-	Path           string `yaml:"path,omitempty"`
+	Type           string   `yaml:"type"`
+	CronExpression string   `yaml:"cron_expression,omitempty"`
+	Timezone       string   `yaml:"tz,omitempty"`
+	Jitter         string   `yaml:"jitter,omitempty"`
+	Overlap        string   `yaml:"overlap,omitempty"`
+	Path           string   `yaml:"path,omitempty"`
+	Events         []string `yaml:"events,omitempty"`
+	Branches       []string `yaml:"branches,omitempty"`
+	Paths          []string `yaml:"paths,omitempty"`
+	Debounce       string   `yaml:"debounce,omitempty"`
+	Pipelines      []string `yaml:"pipelines,omitempty"`
+	When           string   `yaml:"when,omitempty"`
+	Enabled        *bool    `yaml:"enabled,omitempty"`
+}
+
+// IsEnabled reports whether the trigger starts runs. Triggers are enabled
+// unless they set enabled: false; the pipeline can still be run through the
+// API.
+func (t TriggerSpec) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// Trigger types. cron runs on CronExpression, in Timezone when set, delayed
+// by up to Jitter and subject to Overlap. github runs on webhook deliveries matching Events, Branches
+// and Paths; Branches and Paths are globs where * stays within one path
+// segment and ** spans several. file runs when files matching Path change,
+// once Debounce has passed without further changes. after_pipeline runs when
+// a run of one of Pipelines ends in the state named by When.
+const (
+	TriggerAPI           = "api"
+	TriggerCron          = "cron"
+	TriggerGitHub        = "github"
+	TriggerFile          = "file"
+	TriggerAfterPipeline = "after_pipeline"
+)
+
+// Values for TriggerSpec.Overlap, deciding what a cron trigger does when
+// its previous scheduled run is still going: start another one anyway, skip
+// this one, or start it once the previous run finishes.
+const (
+	OverlapAllow = "allow"
+	OverlapSkip  = "skip"
+	OverlapQueue = "queue"
+)
+
+// Values for TriggerSpec.When.
+const (
+	WhenSuccess = "success"
+	WhenFailure = "failure"
+	WhenAny     = "any"
+)
+
+// GitHubEvents are the webhook events a github trigger can listen to.
+var GitHubEvents = map[string]bool{
+	"push":         true,
+	"pull_request": true,
+}
+
+// FileEvents are the filesystem events a file trigger can listen to.
+var FileEvents = map[string]bool{
+	"create": true,
+	"write":  true,
+	"remove": true,
+	"rename": true,
+	"chmod":  true,
 }
 
 type Deployment struct {
-	Service string `yaml:"service"`
-	Action  string `yaml:"action"`
-	Repo    string `yaml:"repo"`
-	VarFile string `yaml:"var-file,omitempty"`
+	Service       string            `yaml:"service"`
+	Action        string            `yaml:"action"`
+	Repo          string            `yaml:"repo"`
+	VarFile       string            `yaml:"var-file,omitempty"`
+	WorkingDir    string            `yaml:"working_dir,omitempty"`
+	Workspace     string            `yaml:"workspace,omitempty"`
+	BackendConfig map[string]string `yaml:"backend_config,omitempty"`
+	Vars          map[string]string `yaml:"vars,omitempty"`
+	Targets       []string          `yaml:"targets,omitempty"`
+	Dependencies  []string          `yaml:"dependencies,omitempty"`
+	// Resources are the pools the deployment holds a slot in while it
+	// runs, like Task.Resources.
+	Resources []string `yaml:"resources,omitempty"`
+
+	// Binary overrides the CLI the terraform, opentofu and pulumi services
+	// run, e.g. a pinned version outside PATH.
+	Binary string `yaml:"binary,omitempty"`
+	// Stack names the pulumi or cloudformation stack; it defaults to the
+	// deployment's name.
+	Stack        string   `yaml:"stack,omitempty"`
+	Template     string   `yaml:"template,omitempty"`
+	Capabilities []string `yaml:"capabilities,omitempty"`
+	Region       string   `yaml:"region,omitempty"`
+
+	// RequireApproval pauses the deployment before it applies anything
+	// until someone approves the plan; see RunInfo.AwaitApproval.
+	RequireApproval bool     `yaml:"require_approval,omitempty"`
+	Approvers       []string `yaml:"approvers,omitempty"`
+	ApprovalTimeout string   `yaml:"approval_timeout,omitempty"`
+}
+
+// Infrastructure providers a deployment's service can name.
+const (
+	ServiceTerraform      = "terraform"
+	ServiceOpenTofu       = "opentofu"
+	ServicePulumi         = "pulumi"
+	ServiceCloudFormation = "cloudformation"
+)
+
+// Deployment actions. plan only saves and logs a plan; apply applies it;
+// sync applies it only when it has changes; destroy and refresh plan and
+// apply a destroy or refresh-only run.
+const (
+	ActionPlan    = "plan"
+	ActionApply   = "apply"
+	ActionSync    = "sync"
+	ActionDestroy = "destroy"
+	ActionRefresh = "refresh"
+)
+
+// DeploymentActions are the values a deployment's action can take.
+var DeploymentActions = map[string]bool{
+	ActionPlan:    true,
+	ActionApply:   true,
+	ActionSync:    true,
+	ActionDestroy: true,
+	ActionRefresh: true,
 }
 
 func Initialize(filepath string) (*Pipeline, error) {
-	var p Pipeline
 	data, err := os.ReadFile(filepath)
 	if err != nil {
 		return nil, fmt.Errorf("Error reading filepath: %w", err)
 	}
+	return Parse(data)
+}
 
-	err = yaml.Unmarshal(data, &p)
+// Parse decodes and validates a pipeline file's contents.
+func Parse(data []byte) (*Pipeline, error) {
+	var p Pipeline
+
+	// The node tree is kept so validation errors can point at a line.
+	var root yaml.Node
+	err := yaml.Unmarshal(data, &root)
 	if err != nil {
 		return nil, fmt.Errorf("Error unmarshalling yaml file: %w", err)
 	}
 
-	err = validateTasks(p.Tasks)
+	err = root.Decode(&p)
 	if err != nil {
-		return nil, fmt.Errorf("Error validating tasks: %w", err)
+		return nil, fmt.Errorf("Error unmarshalling yaml file: %w", err)
 	}
 
-	return &p, nil
-}
-
-func validateTasks(t map[string]Task) error {
-	for _, task := range t {
-		s, ok := Registry[task.Service]
-		if !ok {
-			return fmt.Errorf("Invalid Service Name: %s", task.Service)
-		}
-
-		if len(task.Parameters) != len(s.Parameters()) {
-			return fmt.Errorf("Extra Parameters in Task: %s", task.Service)
-		}
-
-		for _, p := range s.Parameters() {
-			_, ok := task.Parameters[p]
-			if !ok {
-				return fmt.Errorf("Parameter Name Not Found: %s", p)
-			}
-		}
+	err = validatePipeline(&root, &p)
+	if err != nil {
+		return nil, fmt.Errorf("Error validating pipeline:\n%w", err)
 	}
 
-	return nil
+	return &p, nil
 }
 
 func (t Task) StringParam(key string) (string, error) {
@@ -2,13 +2,18 @@ package structures
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 )
 
+// Graph holds the tasks and infrastructure deployments of a pipeline.
+// Deployments are nodes like tasks, so Adj and InDeg cover both.
 type Graph struct {
-	Nodes map[string]Task
-	Adj   map[string][]string
-	InDeg map[string]int
+	Nodes       map[string]Task
+	Deployments map[string]Deployment
+	Adj         map[string][]string
+	InDeg       map[string]int
 }
 
 func BuildGraph(p *Pipeline) (*Graph, error) {
@@ -16,26 +21,34 @@ func BuildGraph(p *Pipeline) (*Graph, error) {
 		return nil, fmt.Errorf("Cannot build empty pipeline")
 	}
 
+	size := len(p.Tasks) + len(p.Infrastructure)
 	g := &Graph{
-		Nodes: make(map[string]Task, len(p.Tasks)),
-		Adj:   make(map[string][]string, len(p.Tasks)),
-		InDeg: make(map[string]int, len(p.Tasks)),
+		Nodes:       make(map[string]Task, len(p.Tasks)),
+		Deployments: make(map[string]Deployment, len(p.Infrastructure)),
+		Adj:         make(map[string][]string, size),
+		InDeg:       make(map[string]int, size),
 	}
 
 	for name, t := range p.Tasks {
 		g.Nodes[name] = t
 		g.InDeg[name] = 0
 	}
+	for name, d := range p.Infrastructure {
+		if _, ok := g.Nodes[name]; ok {
+			return nil, fmt.Errorf("Deployment '%s' has the same name as a task", name)
+		}
+		g.Deployments[name] = d
+		g.InDeg[name] = 0
+	}
 
-	for name, t := range p.Tasks {
-		seen := make(map[string]struct{}, len(p.Tasks))
-		for _, dependency := range t.Dependencies {
+	for name := range g.InDeg {
+		seen := make(map[string]struct{}, size)
+		for _, dependency := range p.Upstream(name) {
 			if dependency == name {
 				return nil, fmt.Errorf("Task can't depend on itself")
 			}
-			_, ok := g.Nodes[dependency]
-			if !ok {
-				return nil, fmt.Errorf("Dependency is not an existing task")
+			if _, ok := g.InDeg[dependency]; !ok {
+				return nil, fmt.Errorf("Dependency is not an existing task or deployment")
 			}
 
 			if _, dup := seen[dependency]; dup {
@@ -51,6 +64,80 @@ func BuildGraph(p *Pipeline) (*Graph, error) {
 
 }
 
+// Size is the number of nodes, tasks and deployments together.
+func (g *Graph) Size() int {
+	return len(g.Nodes) + len(g.Deployments)
+}
+
+// Upstream returns what the task or deployment named name waits for: its
+// dependencies, plus every deployment it reads with ${infra:...}. Reading
+// ${tfstate:...} waits for every other terraform deployment.
+func (p *Pipeline) Upstream(name string) []string {
+	var deps []string
+	var refs any
+	if t, ok := p.Tasks[name]; ok {
+		deps = append(deps, t.Dependencies...)
+		refs = []any{t.Parameters, t.RunIf, t.SkipIf}
+	} else if d, ok := p.Infrastructure[name]; ok {
+		deps = append(deps, d.Dependencies...)
+		// Every setting infra.Run resolves before the deployment starts.
+		refs = []any{d.Repo, d.VarFile, d.WorkingDir, d.Workspace, d.BackendConfig, d.Vars, d.Targets, d.Binary, d.Stack, d.Template, d.Region}
+	}
+	found := infraRefs(refs, nil)
+	if slices.Contains(found, "") {
+		found = append(slices.DeleteFunc(found, func(s string) bool { return s == "" }), p.terraformDeployments(name)...)
+	}
+	slices.Sort(found)
+	for _, ref := range found {
+		if !slices.Contains(deps, ref) {
+			deps = append(deps, ref)
+		}
+	}
+	return deps
+}
+
+// infraRefs collects the deployments named by ${infra:...} references in
+// the strings under v. A ${tfstate:...} reference, which can be in any
+// deployment's state, is collected as "".
+func infraRefs(v any, out []string) []string {
+	switch v := v.(type) {
+	case string:
+		for _, m := range placeholderRE.FindAllString(v, -1) {
+			ph, err := ParsePlaceholder(m)
+			if err != nil {
+				continue
+			}
+			name, _, ok := strings.Cut(ph.Key, ".")
+			switch {
+			case ph.Namespace == "tfstate":
+				name, ok = "", true
+			case ph.Namespace != "infra":
+				ok = false
+			}
+			if ok && !slices.Contains(out, name) {
+				out = append(out, name)
+			}
+		}
+	case []any:
+		for _, e := range v {
+			out = infraRefs(e, out)
+		}
+	case []string:
+		for _, e := range v {
+			out = infraRefs(e, out)
+		}
+	case map[string]any:
+		for _, e := range v {
+			out = infraRefs(e, out)
+		}
+	case map[string]string:
+		for _, e := range v {
+			out = infraRefs(e, out)
+		}
+	}
+	return out
+}
+
 func (g *Graph) Levels() ([][]string, error) {
 	if g == nil {
 		return nil, fmt.Errorf("Graph is empty")
@@ -61,7 +148,7 @@ func (g *Graph) Levels() ([][]string, error) {
 		in[n] = v
 	}
 
-	levels := make([][]string, len(g.Nodes))
+	levels := make([][]string, 0, len(g.Nodes))
 	curr := make([]string, 0, len(g.Nodes))
 
 	for n, v := range in {
@@ -71,6 +158,7 @@ func (g *Graph) Levels() ([][]string, error) {
 	}
 
 	for len(curr) > 0 {
+		sort.Strings(curr)
 		levels = append(levels, curr)
 		next := []string{}
 
@@ -80,8 +168,8 @@ func (g *Graph) Levels() ([][]string, error) {
 			}
 
 			for _, a := range g.Adj[n] {
-				g.InDeg[a]--
-				if g.InDeg[a] == 0 {
+				in[a]--
+				if in[a] == 0 {
 					next = append(next, a)
 				}
 			}
@@ -91,3 +179,16 @@ func (g *Graph) Levels() ([][]string, error) {
 
 	return levels, nil
 }
+
+// terraformDeployments lists the terraform and opentofu deployments other
+// than except.
+func (p *Pipeline) terraformDeployments(except string) []string {
+	names := []string{}
+	for name, d := range p.Infrastructure {
+		if (d.Service == ServiceTerraform || d.Service == ServiceOpenTofu) && name != except {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
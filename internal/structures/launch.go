@@ -0,0 +1,38 @@
+package structures
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// LaunchRequest asks for another pipeline to be run on behalf of Parent.
+type LaunchRequest struct {
+	PipelineRef string
+	Params      map[string]string
+	Trigger     string
+	Event       map[string]string
+	Parent      *RunInfo
+}
+
+// Launcher starts a run in the background and returns it with a function
+// that cancels it.
+type Launcher func(req LaunchRequest) (*RunInfo, context.CancelFunc, error)
+
+// Launch is set by whatever hosts the engine, the server or the CLI, so
+// services can start other pipelines. It is nil when nothing can.
+var Launch Launcher
+
+// ChildChain returns the chain of pipelines a run started from parent would
+// have, refusing to start a pipeline that is already upstream of itself.
+func ChildChain(parent *RunInfo, pipeline string) ([]string, error) {
+	if parent == nil {
+		return nil, nil
+	}
+	chain := append(slices.Clone(parent.Chain), parent.Pipeline)
+	if slices.Contains(chain, pipeline) {
+		return nil, fmt.Errorf("pipeline cycle: %s -> %s", strings.Join(chain, " -> "), pipeline)
+	}
+	return chain, nil
+}
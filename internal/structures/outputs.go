@@ -0,0 +1,119 @@
+package structures
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PathSegment is one step of an output path: a map key or a list index.
+type PathSegment struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// ParseOutputPath splits a path such as `json.items[0].id` or
+// `headers["content-type"]` into segments.
+func ParseOutputPath(path string) ([]PathSegment, error) {
+	segments := []PathSegment{}
+	i := 0
+	for i < len(path) {
+		switch path[i] {
+		case '.':
+			if i == 0 || i == len(path)-1 {
+				return nil, fmt.Errorf("invalid output path %q", path)
+			}
+			i++
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed '[' in output path %q", path)
+			}
+			inner := path[i+1 : i+end]
+			if unquoted, err := strconv.Unquote(inner); err == nil {
+				segments = append(segments, PathSegment{Key: unquoted})
+			} else if n, err := strconv.Atoi(inner); err == nil && n >= 0 {
+				segments = append(segments, PathSegment{Index: n, IsIndex: true})
+			} else {
+				return nil, fmt.Errorf("invalid index %q in output path %q", inner, path)
+			}
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			segments = append(segments, PathSegment{Key: path[i : i+end]})
+			i += end
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("empty output path")
+	}
+	return segments, nil
+}
+
+// LookupPath walks v along path. found is false as soon as a key or index is
+// missing or a segment doesn't match the value's shape.
+func LookupPath(v any, path []PathSegment) (any, bool) {
+	for _, seg := range path {
+		if seg.IsIndex {
+			l, ok := v.([]any)
+			if !ok || seg.Index >= len(l) {
+				return nil, false
+			}
+			v = l[seg.Index]
+			continue
+		}
+
+		switch m := v.(type) {
+		case map[string]any:
+			next, ok := m[seg.Key]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case map[string]string:
+			next, ok := m[seg.Key]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// FormatValue renders an output for string interpolation. Scalars print as
+// themselves and lists and maps as JSON.
+func FormatValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case bool:
+		return strconv.FormatBool(t)
+	case int:
+		return strconv.Itoa(t)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case time.Time:
+		return t.Format(time.RFC3339)
+	case []any, map[string]any, map[string]string, []string:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(t)
+	}
+}
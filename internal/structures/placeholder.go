@@ -0,0 +1,200 @@
+package structures
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Placeholder is a parsed ${...} reference such as
+//
+//	${param:version | default "latest" | upper}
+//
+// A key ending in ? marks the reference optional: a missing value resolves
+// to empty instead of failing the task.
+type Placeholder struct {
+	Raw       string
+	Namespace string
+	Key       string
+	Optional  bool
+	Filters   []Filter
+}
+
+type Filter struct {
+	Name string
+	Args []string
+}
+
+// filterArity is the minimum and maximum number of arguments each filter
+// takes. The filters themselves are applied by the resolver.
+var filterArity = map[string][2]int{
+	"format":  {1, 1},
+	"default": {1, 1},
+	"upper":   {0, 0},
+	"lower":   {0, 0},
+	"trim":    {0, 0},
+	"replace": {2, 2},
+	"sha256":  {0, 0},
+	"base64":  {0, 0},
+	"json":    {0, 0},
+	"join":    {0, 1},
+}
+
+// builtinKeys lists the keys of the namespaces filled in from the run itself.
+// A nil entry means the namespace takes no key.
+var builtinKeys = map[string]map[string]bool{
+	"run":       {"id": true, "dir": true, "trigger": true},
+	"pipeline":  {"name": true},
+	"timestamp": nil,
+}
+
+// ParsePlaceholder parses one ${...} reference, checking filter names and
+// argument counts.
+func ParsePlaceholder(m string) (Placeholder, error) {
+	p := Placeholder{Raw: m}
+	if !strings.HasPrefix(m, "${") || !strings.HasSuffix(m, "}") {
+		return p, fmt.Errorf("invalid placeholder '%s'", m)
+	}
+
+	stages, err := splitPipes(m[2 : len(m)-1])
+	if err != nil {
+		return p, fmt.Errorf("invalid placeholder '%s': %w", m, err)
+	}
+
+	head := strings.TrimSpace(stages[0])
+	if strings.HasSuffix(head, "?") {
+		p.Optional = true
+		head = strings.TrimSpace(strings.TrimSuffix(head, "?"))
+	}
+	ns, key, hasKey := strings.Cut(head, ":")
+	p.Namespace, p.Key = strings.TrimSpace(ns), strings.TrimSpace(key)
+	if p.Namespace == "" {
+		return p, fmt.Errorf("invalid placeholder '%s', expected ${namespace:key}", m)
+	}
+
+	if keys, builtin := builtinKeys[p.Namespace]; builtin {
+		switch {
+		case keys == nil && hasKey:
+			return p, fmt.Errorf("'%s' in '%s' takes no key", p.Namespace, m)
+		case keys != nil && !keys[p.Key]:
+			return p, fmt.Errorf("unknown key '%s' for '%s' in '%s'", p.Key, p.Namespace, m)
+		}
+	} else if !hasKey || p.Key == "" {
+		return p, fmt.Errorf("invalid placeholder '%s', expected ${namespace:key}", m)
+	}
+
+	for _, stage := range stages[1:] {
+		words, err := splitArgs(stage)
+		if err != nil {
+			return p, fmt.Errorf("invalid placeholder '%s': %w", m, err)
+		}
+		if len(words) == 0 {
+			return p, fmt.Errorf("empty filter in '%s'", m)
+		}
+		f := Filter{Name: words[0], Args: words[1:]}
+		arity, ok := filterArity[f.Name]
+		if !ok {
+			return p, fmt.Errorf("unknown filter '%s' in '%s'", f.Name, m)
+		}
+		if len(f.Args) < arity[0] || len(f.Args) > arity[1] {
+			return p, fmt.Errorf("filter '%s' takes %s in '%s'", f.Name, argCount(arity), m)
+		}
+		p.Filters = append(p.Filters, f)
+	}
+	return p, nil
+}
+
+// HasFilter reports whether the placeholder applies the named filter.
+func (p Placeholder) HasFilter(name string) bool {
+	for _, f := range p.Filters {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func argCount(arity [2]int) string {
+	switch {
+	case arity[1] == 0:
+		return "no arguments"
+	case arity[0] == arity[1] && arity[0] == 1:
+		return "1 argument"
+	case arity[0] == arity[1]:
+		return fmt.Sprintf("%d arguments", arity[0])
+	default:
+		return fmt.Sprintf("%d to %d arguments", arity[0], arity[1])
+	}
+}
+
+// splitPipes splits on | outside of quotes.
+func splitPipes(s string) ([]string, error) {
+	stages := []string{}
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '|':
+			stages = append(stages, s[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	return append(stages, s[start:]), nil
+}
+
+// splitArgs splits a filter into words. Double-quoted words use Go escapes,
+// single-quoted words are taken literally.
+func splitArgs(s string) ([]string, error) {
+	words := []string{}
+	i := 0
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			w, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[i:end+1])
+			}
+			words = append(words, w)
+			i = end + 1
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			words = append(words, s[i+1:i+1+end])
+			i += end + 2
+		default:
+			end := strings.IndexAny(s[i:], " \t")
+			if end < 0 {
+				end = len(s) - i
+			}
+			words = append(words, s[i:i+end])
+			i += end
+		}
+	}
+	return words, nil
+}
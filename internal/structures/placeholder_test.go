@@ -0,0 +1,137 @@
+package structures
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePlaceholder(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Placeholder
+	}{
+		{"${param:version}", Placeholder{Namespace: "param", Key: "version"}},
+		{"${ param : version }", Placeholder{Namespace: "param", Key: "version"}},
+		{"${env:HOME?}", Placeholder{Namespace: "env", Key: "HOME", Optional: true}},
+		{"${context:api.json.items[0].id}", Placeholder{Namespace: "context", Key: "api.json.items[0].id"}},
+		{"${run:id}", Placeholder{Namespace: "run", Key: "id"}},
+		{"${pipeline:name}", Placeholder{Namespace: "pipeline", Key: "name"}},
+		{"${timestamp}", Placeholder{Namespace: "timestamp"}},
+		{
+			`${param:version | default "latest" | upper}`,
+			Placeholder{Namespace: "param", Key: "version", Filters: []Filter{
+				{Name: "default", Args: []string{"latest"}},
+				{Name: "upper", Args: []string{}},
+			}},
+		},
+		{
+			`${timestamp | format "2006-01-02"}`,
+			Placeholder{Namespace: "timestamp", Filters: []Filter{{Name: "format", Args: []string{"2006-01-02"}}}},
+		},
+		{
+			`${param:branch | replace '/' "-"}`,
+			Placeholder{Namespace: "param", Key: "branch", Filters: []Filter{{Name: "replace", Args: []string{"/", "-"}}}},
+		},
+		{
+			`${param:msg | default "a | b"}`,
+			Placeholder{Namespace: "param", Key: "msg", Filters: []Filter{{Name: "default", Args: []string{"a | b"}}}},
+		},
+		{
+			`${param:msg | default "say \"hi\"\n"}`,
+			Placeholder{Namespace: "param", Key: "msg", Filters: []Filter{{Name: "default", Args: []string{"say \"hi\"\n"}}}},
+		},
+		{
+			`${param:msg | default 'C:\temp'}`,
+			Placeholder{Namespace: "param", Key: "msg", Filters: []Filter{{Name: "default", Args: []string{`C:\temp`}}}},
+		},
+		{
+			"${context:list.items? | join}",
+			Placeholder{Namespace: "context", Key: "list.items", Optional: true, Filters: []Filter{{Name: "join", Args: []string{}}}},
+		},
+		{
+			`${context:list.items | join ", "}`,
+			Placeholder{Namespace: "context", Key: "list.items", Filters: []Filter{{Name: "join", Args: []string{", "}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePlaceholder(tt.in)
+			if err != nil {
+				t.Fatalf("ParsePlaceholder: %v", err)
+			}
+			tt.want.Raw = tt.in
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePlaceholder = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePlaceholderErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"param:version", "invalid placeholder"},
+		{"${param:version", "invalid placeholder"},
+		{"${:version}", "expected ${namespace:key}"},
+		{"${param}", "expected ${namespace:key}"},
+		{"${param:}", "expected ${namespace:key}"},
+		{"${timestamp:now}", "takes no key"},
+		{"${run:name}", "unknown key 'name' for 'run'"},
+		{"${param:version | }", "empty filter"},
+		{"${param:version | shout}", "unknown filter 'shout'"},
+		{"${param:version | default}", "filter 'default' takes 1 argument"},
+		{"${param:version | upper x}", "filter 'upper' takes no arguments"},
+		{"${param:version | replace a}", "filter 'replace' takes 2 arguments"},
+		{"${param:version | join a b}", "filter 'join' takes 0 to 1 arguments"},
+		{`${param:version | default "latest}`, "unterminated string"},
+		{`${param:version | default 'latest}`, "unterminated string"},
+		{`${param:version | default "\q"}`, "invalid string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := ParsePlaceholder(tt.in)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParsePlaceholder error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseOutputPath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []PathSegment
+		err  string
+	}{
+		{in: "stdout", want: []PathSegment{{Key: "stdout"}}},
+		{in: "json.items[0].id", want: []PathSegment{{Key: "json"}, {Key: "items"}, {Index: 0, IsIndex: true}, {Key: "id"}}},
+		{in: `headers["content-type"]`, want: []PathSegment{{Key: "headers"}, {Key: "content-type"}}},
+		{in: "rows[2][10]", want: []PathSegment{{Key: "rows"}, {Index: 2, IsIndex: true}, {Index: 10, IsIndex: true}}},
+		{in: "", err: "empty output path"},
+		{in: ".json", err: "invalid output path"},
+		{in: "json.", err: "invalid output path"},
+		{in: "items[0", err: "unclosed '['"},
+		{in: "items[-1]", err: "invalid index"},
+		{in: "items[x]", err: "invalid index"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseOutputPath(tt.in)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("ParseOutputPath error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseOutputPath: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseOutputPath = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
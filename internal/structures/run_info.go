@@ -5,8 +5,11 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/AlexSTJO/flume/internal/logging"
 )
 
 func newID() string {
@@ -19,13 +22,29 @@ func newID() string {
 }
 
 type RunInfo struct {
-	RunID    string
-	RunDir   string
-	Pipeline string
-	Remote   bool
-	FileRef  string
-	S3       *RemotePipeline
-	Params   map[string]string
+	RunID     string
+	RunDir    string
+	StartedAt time.Time
+	Pipeline  string
+	Remote    bool
+	FileRef   string
+	S3        *RemotePipeline
+	Params    map[string]string
+	Trigger   string
+	Event     map[string]string
+	Chain     []string
+	Status    *RunStatus
+	Context   *Context
+	Secrets   *logging.Redactor
+}
+
+// LogPath is where the run's JSONL log is written, empty when the run has no
+// run directory.
+func (r *RunInfo) LogPath() string {
+	if r.RunDir == "" {
+		return ""
+	}
+	return filepath.Join(r.RunDir, "logs", r.RunID+".jsonl")
 }
 
 type RemotePipeline struct {
@@ -33,31 +52,36 @@ type RemotePipeline struct {
 	Key    string
 }
 
-func GenerateRunInfo(fileRef string, params map[string]string) (*RunInfo, error) {
-	remote := false
-	pipeline := ""
+// ParsePipelineRef splits a pipeline_ref into the pipeline name and, for
+// s3:// references, the bucket and key it lives at.
+func ParsePipelineRef(fileRef string) (string, bool, *RemotePipeline, error) {
 	var remote_pipeline RemotePipeline
 	if strings.HasPrefix(fileRef, "s3://") {
-		remote = true
 		path := strings.TrimPrefix(fileRef, "s3://")
 
 		parts := strings.SplitN(path, "/", 2)
 		if len(parts) != 2 {
-			return nil, fmt.Errorf("Invalid s3 uri: %s", fileRef)
+			return "", false, nil, fmt.Errorf("Invalid s3 uri: %s", fileRef)
 		}
 
 		remote_pipeline.Bucket = parts[0]
 		remote_pipeline.Key = parts[1]
 		segments := strings.Split(strings.TrimSuffix(remote_pipeline.Key, "/"), "/")
 		if len(segments) != 3 {
-			return nil, fmt.Errorf("Invalid object key in S3 Uri: %s", remote_pipeline.Key)
+			return "", false, nil, fmt.Errorf("Invalid object key in S3 Uri: %s", remote_pipeline.Key)
 		}
 
-		pipeline = segments[1]
-	} else {
-		fmt.Println("hey")
-		raw_fileRef := strings.TrimSuffix(fileRef, ".yaml")
-		pipeline = strings.TrimPrefix(raw_fileRef, "local://")
+		return segments[1], true, &remote_pipeline, nil
+	}
+
+	raw_fileRef := strings.TrimSuffix(fileRef, ".yaml")
+	return strings.TrimPrefix(raw_fileRef, "local://"), false, &remote_pipeline, nil
+}
+
+func GenerateRunInfo(fileRef string, params map[string]string) (*RunInfo, error) {
+	pipeline, remote, remote_pipeline, err := ParsePipelineRef(fileRef)
+	if err != nil {
+		return nil, err
 	}
 	run_id := newID()
 	run_dir, err := os.MkdirTemp("", fmt.Sprintf("flume-run-%s", run_id))
@@ -67,13 +91,22 @@ func GenerateRunInfo(fileRef string, params map[string]string) (*RunInfo, error)
 	if params == nil {
 		params = make(map[string]string)
 	}
+	secrets := logging.NewRedactor()
+	ctx := NewContext()
+	ctx.SetRedactor(secrets)
+	status := NewRunStatus()
+	status.SetRedactor(secrets)
 	return &RunInfo{
-		RunID:    run_id,
-		RunDir:   run_dir,
-		Pipeline: pipeline,
-		Remote:   remote,
-		FileRef:  fileRef,
-		S3:       &remote_pipeline,
-		Params:   params,
+		RunID:     run_id,
+		RunDir:    run_dir,
+		StartedAt: time.Now().UTC(),
+		Pipeline:  pipeline,
+		Remote:    remote,
+		FileRef:   fileRef,
+		S3:        remote_pipeline,
+		Params:    params,
+		Status:    status,
+		Context:   ctx,
+		Secrets:   secrets,
 	}, nil
 }
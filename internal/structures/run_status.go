@@ -0,0 +1,243 @@
+package structures
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+)
+
+type RunState string
+
+const (
+	RunQueued    RunState = "queued"
+	RunRunning   RunState = "running"
+	RunSucceeded RunState = "succeeded"
+	RunFailed    RunState = "failed"
+	RunCancelled RunState = "cancelled"
+)
+
+type TaskState string
+
+const (
+	TaskPending        TaskState = "pending"
+	TaskRunning        TaskState = "running"
+	TaskSucceeded      TaskState = "succeeded"
+	TaskFailed         TaskState = "failed"
+	TaskSkipped        TaskState = "skipped"
+	TaskCancelled      TaskState = "cancelled"
+	TaskUpstreamFailed TaskState = "upstream_failed"
+)
+
+type TaskStatus struct {
+	State          TaskState  `json:"state"`
+	Attempts       int        `json:"attempts,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+	DurationMS     int64      `json:"duration_ms,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	AllowedFailure bool       `json:"allowed_failure,omitempty"`
+}
+
+// RunStatus tracks the lifecycle of a single run. It is written by the engine
+// workers and read concurrently by the server, so all access goes through its
+// methods. Secret values known to the redactor are masked in the errors it
+// records, since those are persisted and served by the API.
+type RunStatus struct {
+	mu        sync.RWMutex
+	redactor  *logging.Redactor
+	state     RunState
+	startedAt *time.Time
+	endedAt   *time.Time
+	err       string
+	tasks     map[string]*TaskStatus
+	approvals map[string]*Approval
+	done      chan struct{}
+}
+
+type RunSummary struct {
+	RunID      string                    `json:"run_id"`
+	Pipeline   string                    `json:"pipeline"`
+	Trigger    string                    `json:"trigger,omitempty"`
+	Params     map[string]string         `json:"parameters,omitempty"`
+	LogPath    string                    `json:"log_path,omitempty"`
+	State      RunState                  `json:"state"`
+	StartedAt  *time.Time                `json:"started_at,omitempty"`
+	EndedAt    *time.Time                `json:"ended_at,omitempty"`
+	DurationMS int64                     `json:"duration_ms,omitempty"`
+	Error      string                    `json:"error,omitempty"`
+	Tasks      map[string]TaskStatus     `json:"tasks"`
+	Outputs    map[string]map[string]any `json:"outputs,omitempty"`
+	Approvals  map[string]Approval       `json:"approvals,omitempty"`
+}
+
+func NewRunStatus() *RunStatus {
+	return &RunStatus{
+		state: RunQueued,
+		tasks: make(map[string]*TaskStatus),
+		done:  make(chan struct{}),
+	}
+}
+
+// SetRedactor masks the redactor's values in recorded errors. It must be
+// called before the run starts.
+func (s *RunStatus) SetRedactor(r *logging.Redactor) {
+	s.redactor = r
+}
+
+func (s *RunStatus) Start(tasks []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	s.state = RunRunning
+	s.startedAt = &now
+	for _, name := range tasks {
+		if _, ok := s.tasks[name]; !ok {
+			s.tasks[name] = &TaskStatus{State: TaskPending}
+		}
+	}
+}
+
+// Finish records the end of the run. A run that returned no error but had a
+// failed task is still reported as failed.
+func (s *RunStatus) Finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer close(s.done)
+	now := time.Now().UTC()
+	s.endedAt = &now
+	if s.startedAt == nil {
+		s.startedAt = &now
+	}
+	if errors.Is(err, context.Canceled) {
+		s.state = RunCancelled
+		return
+	}
+	if err != nil {
+		s.state = RunFailed
+		s.err = s.redactor.Redact(err.Error())
+		return
+	}
+	for _, t := range s.tasks {
+		if t.State == TaskFailed && !t.AllowedFailure {
+			s.state = RunFailed
+			return
+		}
+	}
+	s.state = RunSucceeded
+}
+
+// Done is closed once the run has reached its final state.
+func (s *RunStatus) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *RunStatus) State() RunState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+func (s *RunStatus) TaskStarted(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	t := s.task(name)
+	t.State = TaskRunning
+	t.StartedAt = &now
+}
+
+func (s *RunStatus) TaskAttempt(name string, attempt int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.task(name).Attempts = attempt
+}
+
+func (s *RunStatus) TaskFinished(name string, state TaskState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	t := s.task(name)
+	t.State = state
+	t.EndedAt = &now
+	if err != nil {
+		t.Error = s.redactor.Redact(err.Error())
+	}
+}
+
+// TaskState returns the current state of a task. ok is false for tasks the
+// run doesn't know about.
+func (s *RunStatus) TaskState(name string) (TaskState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tasks[name]
+	if !ok {
+		return "", false
+	}
+	return t.State, true
+}
+
+// TaskAllowedFailure marks a failed task whose failure does not fail the run.
+func (s *RunStatus) TaskAllowedFailure(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.task(name).AllowedFailure = true
+}
+
+func (s *RunStatus) task(name string) *TaskStatus {
+	t, ok := s.tasks[name]
+	if !ok {
+		t = &TaskStatus{State: TaskPending}
+		s.tasks[name] = t
+	}
+	return t
+}
+
+func (r *RunInfo) Summary() RunSummary {
+	s := r.Status
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := make(map[string]TaskStatus, len(s.tasks))
+	for name, t := range s.tasks {
+		ts := *t
+		ts.DurationMS = durationMS(t.StartedAt, t.EndedAt)
+		tasks[name] = ts
+	}
+	var approvals map[string]Approval
+	if len(s.approvals) > 0 {
+		approvals = make(map[string]Approval, len(s.approvals))
+		for name, a := range s.approvals {
+			approvals[name] = *a
+		}
+	}
+	var outputs map[string]map[string]any
+	if r.Context != nil {
+		outputs = r.Context.Snapshot()
+	}
+
+	return RunSummary{
+		RunID:      r.RunID,
+		Pipeline:   r.Pipeline,
+		Trigger:    r.Trigger,
+		Params:     r.Params,
+		LogPath:    r.LogPath(),
+		State:      s.state,
+		StartedAt:  s.startedAt,
+		EndedAt:    s.endedAt,
+		DurationMS: durationMS(s.startedAt, s.endedAt),
+		Error:      s.err,
+		Tasks:      tasks,
+		Outputs:    outputs,
+		Approvals:  approvals,
+	}
+}
+
+func durationMS(start, end *time.Time) int64 {
+	if start == nil || end == nil {
+		return 0
+	}
+	return end.Sub(*start).Milliseconds()
+}
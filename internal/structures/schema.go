@@ -0,0 +1,42 @@
+package structures
+
+import "strings"
+
+type ParamType string
+
+const (
+	ParamString   ParamType = "string"
+	ParamInt      ParamType = "int"
+	ParamBool     ParamType = "bool"
+	ParamDuration ParamType = "duration"
+	ParamList     ParamType = "list"
+	ParamMap      ParamType = "map"
+	ParamAny      ParamType = "any"
+)
+
+// ParamSpec describes one parameter a service accepts. Optional parameters
+// that are missing from a task are filled in with Default when the pipeline
+// is loaded, so services can read them unconditionally. Secret parameters
+// are masked wherever resolved values are shown, such as dry-run plans.
+type ParamSpec struct {
+	Name        string
+	Type        ParamType
+	Required    bool
+	Default     any
+	Allowed     []string
+	Description string
+	Secret      bool
+}
+
+// Allows reports whether v is one of the allowed values, ignoring case.
+func (p ParamSpec) Allows(v string) bool {
+	if len(p.Allowed) == 0 {
+		return true
+	}
+	for _, a := range p.Allowed {
+		if strings.EqualFold(a, v) {
+			return true
+		}
+	}
+	return false
+}
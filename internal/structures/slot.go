@@ -0,0 +1,23 @@
+package structures
+
+import "context"
+
+type slotKey struct{}
+
+// WithSlotRelease returns a context whose holder can give back its
+// concurrency slots with ReleaseSlot. The engine sets it for every task and
+// deployment it runs.
+func WithSlotRelease(c context.Context, release func()) context.Context {
+	return context.WithValue(c, slotKey{}, release)
+}
+
+// ReleaseSlot gives back the FLUME_MAX_WORKERS slot and resource pool slots
+// of the task running with c. Tasks call it before waiting on something
+// outside the run, such as an approval or a child run, so a waiting task
+// can't starve the work it waits for. The slots are not taken again for the
+// rest of the attempt.
+func ReleaseSlot(c context.Context) {
+	if release, ok := c.Value(slotKey{}).(func()); ok {
+		release()
+	}
+}
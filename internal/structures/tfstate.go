@@ -0,0 +1,57 @@
+package structures
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// StateAddress is a ${tfstate:...} reference: a resource in the Terraform
+// state of a run's deployments, and the path to one of its attributes.
+type StateAddress struct {
+	Module string // e.g. module.vpc, empty for the root module
+	Mode   string // managed or data
+	Type   string
+	Name   string
+	// Path starts with the instance key for resources using count or
+	// for_each, followed by the attribute path.
+	Path []PathSegment
+}
+
+// StateLookup finds the value at a StateAddress in the state of the
+// deployments that ran so far. The infra package sets it.
+var StateLookup func(r *RunInfo, addr StateAddress) (any, bool, error)
+
+// ParseStateAddress parses references such as `aws_instance.web.id`,
+// `module.vpc.aws_subnet.private[0].cidr_block` or `data.aws_ami.ubuntu.id`.
+// Without an attribute path the reference is to all of the instance's
+// attributes.
+func ParseStateAddress(key string) (StateAddress, error) {
+	segments, err := ParseOutputPath(key)
+	if err != nil {
+		return StateAddress{}, err
+	}
+	addr := StateAddress{Mode: "managed"}
+	i := 0
+	for i+1 < len(segments) && !segments[i].IsIndex && segments[i].Key == "module" && !segments[i+1].IsIndex {
+		if addr.Module != "" {
+			addr.Module += "."
+		}
+		addr.Module += "module." + segments[i+1].Key
+		i += 2
+		if i < len(segments) && segments[i].IsIndex {
+			addr.Module += "[" + strconv.Itoa(segments[i].Index) + "]"
+			i++
+		}
+	}
+	if i < len(segments) && !segments[i].IsIndex && segments[i].Key == "data" {
+		addr.Mode = "data"
+		i++
+	}
+	if i+1 >= len(segments) || segments[i].IsIndex || segments[i+1].IsIndex {
+		return StateAddress{}, fmt.Errorf("expected resource_type.name.attribute in %q", key)
+	}
+	addr.Type = segments[i].Key
+	addr.Name = segments[i+1].Key
+	addr.Path = segments[i+2:]
+	return addr, nil
+}
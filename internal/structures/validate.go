@@ -0,0 +1,631 @@
+package structures
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexSTJO/flume/internal/expr"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a single problem found in a pipeline file, located by
+// the YAML line and column it came from.
+type ValidationError struct {
+	Line   int
+	Column int
+	Task   string
+	Msg    string
+}
+
+func (e ValidationError) Error() string {
+	if e.Task != "" {
+		return fmt.Sprintf("%d:%d: task '%s': %s", e.Line, e.Column, e.Task, e.Msg)
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ValidationErrors collects every problem in a pipeline so they can all be
+// fixed in one pass.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+var placeholderRE = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// placeholderNamespaces are the prefixes the resolver understands.
+var placeholderNamespaces = map[string]bool{
+	"context":   true,
+	"infra":     true,
+	"env":       true,
+	"param":     true,
+	"secret":    true,
+	"trigger":   true,
+	"run":       true,
+	"pipeline":  true,
+	"timestamp": true,
+	"tfstate":   true,
+}
+
+var (
+	pipelineKeys   = yamlKeys(Pipeline{})
+	taskKeys       = yamlKeys(Task{})
+	retryKeys      = yamlKeys(RetryConfig{})
+	triggerKeys    = yamlKeys(TriggerSpec{})
+	deploymentKeys = yamlKeys(Deployment{})
+	reportKeys     = yamlKeys(StatusReport{})
+)
+
+// providerKeys are the deployment keys only some services understand.
+var providerKeys = map[string][]string{
+	"var-file":       {ServiceTerraform, ServiceOpenTofu},
+	"workspace":      {ServiceTerraform, ServiceOpenTofu},
+	"backend_config": {ServiceTerraform, ServiceOpenTofu},
+	"targets":        {ServiceTerraform, ServiceOpenTofu, ServicePulumi},
+	"binary":         {ServiceTerraform, ServiceOpenTofu, ServicePulumi},
+	"stack":          {ServicePulumi, ServiceCloudFormation},
+	"template":       {ServiceCloudFormation},
+	"capabilities":   {ServiceCloudFormation},
+	"region":         {ServiceCloudFormation},
+}
+
+func yamlKeys(v any) map[string]bool {
+	t := reflect.TypeOf(v)
+	keys := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+type validator struct {
+	p    *Pipeline
+	errs ValidationErrors
+}
+
+func (v *validator) add(n *yaml.Node, task string, format string, args ...any) {
+	v.errs = append(v.errs, ValidationError{
+		Line:   n.Line,
+		Column: n.Column,
+		Task:   task,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+}
+
+// validatePipeline checks p against the YAML it was decoded from and fills in
+// parameter defaults. root is the document node of the same file.
+func validatePipeline(root *yaml.Node, p *Pipeline) error {
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	v := &validator{p: p}
+	if root.Kind != yaml.MappingNode {
+		v.add(root, "", "pipeline must be a mapping")
+		return v.errs
+	}
+
+	v.checkKeys(root, "", "pipeline", pipelineKeys)
+
+	if n := mappingValue(root, "on_failure"); n != nil {
+		switch p.OnFailure {
+		case "", FailFast, ContinueOnError, FinishRunning:
+		default:
+			v.add(n, "", "invalid on_failure policy '%s', expected %s, %s or %s", p.OnFailure, FailFast, ContinueOnError, FinishRunning)
+		}
+	}
+	if n := mappingValue(root, "max_parallel"); n != nil && p.MaxParallel < 0 {
+		v.add(n, "", "max_parallel must not be negative")
+	}
+
+	if n := mappingValue(root, "trigger"); n != nil {
+		v.checkKeys(n, "", "trigger", triggerKeys)
+		v.checkTrigger(n)
+	}
+
+	if n := mappingValue(root, "report_status"); n != nil {
+		v.checkKeys(n, "", "report_status", reportKeys)
+		for _, key := range []string{"repo", "sha"} {
+			if k := mappingValue(n, key); k == nil || k.Value == "" {
+				v.add(n, "", "report_status needs '%s'", key)
+			}
+		}
+		v.checkPlaceholders(n, "")
+	}
+
+	if n := mappingValue(root, "infrastructure"); n != nil && n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v.checkDeployment(n.Content[i].Value, n.Content[i+1])
+		}
+	}
+
+	tasks := mappingValue(root, "tasks")
+	if tasks == nil || tasks.Kind != yaml.MappingNode || len(tasks.Content) == 0 {
+		at := root
+		if tasks != nil {
+			at = tasks
+		}
+		v.add(at, "", "pipeline has no tasks")
+		return v.errs
+	}
+
+	for i := 0; i+1 < len(tasks.Content); i += 2 {
+		v.checkTask(tasks.Content[i].Value, tasks.Content[i+1])
+	}
+
+	// Cycles are only worth looking for once every dependency exists.
+	if len(v.errs) == 0 {
+		v.checkCycles(tasks)
+	}
+
+	if len(v.errs) > 0 {
+		sort.SliceStable(v.errs, func(i, j int) bool {
+			if v.errs[i].Line != v.errs[j].Line {
+				return v.errs[i].Line < v.errs[j].Line
+			}
+			return v.errs[i].Column < v.errs[j].Column
+		})
+		return v.errs
+	}
+	return nil
+}
+
+func (v *validator) checkTrigger(n *yaml.Node) {
+	t := v.p.Trigger
+	at := func(key string) *yaml.Node {
+		if k := mappingValue(n, key); k != nil {
+			return k
+		}
+		return n
+	}
+
+	switch t.Type {
+	case TriggerAPI:
+	case TriggerCron:
+		if _, err := time.LoadLocation(t.Timezone); err != nil {
+			v.add(at("tz"), "", "unknown timezone '%s'", t.Timezone)
+		} else if _, err := ParseCron(t); err != nil {
+			v.add(at("cron_expression"), "", "%v", err)
+		}
+		if _, err := CronJitter(t); err != nil {
+			v.add(at("jitter"), "", "%v", err)
+		}
+		switch t.Overlap {
+		case "", OverlapAllow, OverlapSkip, OverlapQueue:
+		default:
+			v.add(at("overlap"), "", "invalid overlap '%s', expected %s, %s or %s", t.Overlap, OverlapAllow, OverlapSkip, OverlapQueue)
+		}
+	case TriggerGitHub:
+		for _, e := range t.Events {
+			if !GitHubEvents[e] {
+				v.add(at("events"), "", "unknown github event '%s', expected push or pull_request", e)
+			}
+		}
+	case TriggerFile:
+		if t.Path == "" {
+			v.add(n, "", "file trigger needs a 'path'")
+		}
+		for _, e := range t.Events {
+			if !FileEvents[e] {
+				v.add(at("events"), "", "unknown file event '%s', expected create, write, remove, rename or chmod", e)
+			}
+		}
+		if t.Debounce != "" {
+			if d, err := time.ParseDuration(t.Debounce); err != nil || d < 0 {
+				v.add(at("debounce"), "", "debounce must be a duration like 2s, got '%s'", t.Debounce)
+			}
+		}
+	case TriggerAfterPipeline:
+		if len(t.Pipelines) == 0 {
+			v.add(n, "", "after_pipeline trigger needs 'pipelines'")
+		}
+		switch t.When {
+		case "", WhenSuccess, WhenFailure, WhenAny:
+		default:
+			v.add(at("when"), "", "invalid when '%s', expected %s, %s or %s", t.When, WhenSuccess, WhenFailure, WhenAny)
+		}
+	default:
+		v.add(at("type"), "", "unknown trigger type '%s'", t.Type)
+		return
+	}
+
+	only := map[string][]string{
+		"cron_expression": {TriggerCron},
+		"tz":              {TriggerCron},
+		"jitter":          {TriggerCron},
+		"overlap":         {TriggerCron},
+		"events":          {TriggerGitHub, TriggerFile},
+		"branches":        {TriggerGitHub},
+		"paths":           {TriggerGitHub},
+		"path":            {TriggerFile},
+		"debounce":        {TriggerFile},
+		"pipelines":       {TriggerAfterPipeline},
+		"when":            {TriggerAfterPipeline},
+	}
+	for _, key := range []string{"cron_expression", "tz", "jitter", "overlap", "events", "branches", "paths", "path", "debounce", "pipelines", "when"} {
+		k := mappingValue(n, key)
+		if k == nil || slices.Contains(only[key], t.Type) {
+			continue
+		}
+		v.add(k, "", "trigger key '%s' only applies to %s triggers", key, strings.Join(only[key], " and "))
+	}
+}
+
+func (v *validator) checkDeployment(name string, n *yaml.Node) {
+	v.checkKeys(n, "", fmt.Sprintf("deployment '%s'", name), deploymentKeys)
+	d := v.p.Infrastructure[name]
+	if v.hasTask(name) {
+		v.add(n, "", "deployment '%s' has the same name as a task", name)
+	}
+	if deps := mappingValue(n, "dependencies"); deps != nil && deps.Kind == yaml.SequenceNode {
+		for _, dep := range deps.Content {
+			switch {
+			case dep.Value == name:
+				v.add(dep, "", "deployment '%s' depends on itself", name)
+			case !v.hasNode(dep.Value):
+				v.add(dep, "", "deployment '%s' has unknown dependency '%s'", name, dep.Value)
+			}
+		}
+	}
+	at := func(key string) *yaml.Node {
+		if k := mappingValue(n, key); k != nil {
+			return k
+		}
+		return n
+	}
+
+	switch d.Service {
+	case ServiceTerraform, ServiceOpenTofu, ServicePulumi, ServiceCloudFormation:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := n.Content[i]
+			if services, ok := providerKeys[k.Value]; ok && !slices.Contains(services, d.Service) {
+				v.add(k, "", "deployment '%s' key '%s' does not apply to service '%s'", name, k.Value, d.Service)
+			}
+		}
+	default:
+		v.add(at("service"), "", "deployment '%s' has unknown service '%s', expected terraform, opentofu, pulumi or cloudformation", name, d.Service)
+	}
+	if d.Service == ServiceCloudFormation {
+		if d.Template == "" {
+			v.add(n, "", "deployment '%s' needs a template", name)
+		} else if !filepath.IsLocal(d.Template) {
+			v.add(at("template"), "", "deployment '%s' template must be a relative path inside the repo", name)
+		}
+	}
+	if !DeploymentActions[d.Action] {
+		v.add(at("action"), "", "deployment '%s' has invalid action '%s', expected plan, apply, sync, destroy or refresh", name, d.Action)
+	}
+	if d.WorkingDir != "" && !filepath.IsLocal(d.WorkingDir) {
+		v.add(at("working_dir"), "", "deployment '%s' working_dir must be a relative path inside the repo", name)
+	}
+	if d.ApprovalTimeout != "" {
+		if t, err := time.ParseDuration(d.ApprovalTimeout); err != nil || t < 0 {
+			v.add(at("approval_timeout"), "", "approval_timeout must be a duration like 30m, got '%s'", d.ApprovalTimeout)
+		}
+	}
+	if !d.RequireApproval {
+		for _, key := range []string{"approvers", "approval_timeout"} {
+			if k := mappingValue(n, key); k != nil {
+				v.add(k, "", "deployment '%s' sets '%s' without require_approval", name, key)
+			}
+		}
+	}
+	v.checkRefs(n, "", name)
+}
+
+func (v *validator) checkKeys(n *yaml.Node, task string, what string, known map[string]bool) {
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k := n.Content[i]
+		if !known[k.Value] {
+			v.add(k, task, "unknown %s key '%s'", what, k.Value)
+		}
+	}
+}
+
+func (v *validator) checkTask(name string, n *yaml.Node) {
+	if n.Kind != yaml.MappingNode {
+		v.add(n, name, "task must be a mapping")
+		return
+	}
+	v.checkKeys(n, name, "task", taskKeys)
+	if r := mappingValue(n, "retry"); r != nil {
+		v.checkKeys(r, name, "retry", retryKeys)
+	}
+
+	task := v.p.Tasks[name]
+
+	if deps := mappingValue(n, "dependencies"); deps != nil && deps.Kind == yaml.SequenceNode {
+		for _, d := range deps.Content {
+			switch {
+			case d.Value == name:
+				v.add(d, name, "task depends on itself")
+			case !v.hasNode(d.Value):
+				v.add(d, name, "unknown dependency '%s'", d.Value)
+			}
+		}
+	}
+
+	for _, key := range []string{"run_if", "skip_if"} {
+		if c := mappingValue(n, key); c != nil {
+			v.checkCondition(key, c, name)
+		}
+	}
+
+	svcNode := mappingValue(n, "service")
+	if svcNode == nil || task.Service == "" {
+		v.add(n, name, "missing service")
+		return
+	}
+	s, ok := Registry[task.Service]
+	if !ok {
+		v.add(svcNode, name, "unknown service '%s'", task.Service)
+		return
+	}
+
+	params := mappingValue(n, "parameters")
+	specs := s.Parameters()
+	known := make(map[string]ParamSpec, len(specs))
+	for _, spec := range specs {
+		known[spec.Name] = spec
+	}
+
+	if params != nil && params.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(params.Content); i += 2 {
+			k, val := params.Content[i], params.Content[i+1]
+			spec, ok := known[k.Value]
+			if !ok {
+				v.add(k, name, "unknown parameter '%s' for service '%s'", k.Value, task.Service)
+				continue
+			}
+			v.checkParam(spec, val, name)
+			v.checkPlaceholders(val, name)
+		}
+	}
+
+	at := n
+	if params != nil {
+		at = params
+	}
+	for _, spec := range specs {
+		if _, ok := task.Parameters[spec.Name]; ok {
+			continue
+		}
+		if spec.Required {
+			v.add(at, name, "missing required parameter '%s' for service '%s'", spec.Name, task.Service)
+			continue
+		}
+		if spec.Default != nil {
+			if task.Parameters == nil {
+				task.Parameters = map[string]any{}
+			}
+			task.Parameters[spec.Name] = spec.Default
+		}
+	}
+	v.p.Tasks[name] = task
+}
+
+func (v *validator) checkCondition(key string, n *yaml.Node, task string) {
+	if n.Kind != yaml.ScalarNode {
+		v.add(n, task, "%s must be a string", key)
+		return
+	}
+	v.checkPlaceholders(n, task)
+
+	e, err := expr.Parse(n.Value)
+	if err != nil {
+		v.add(n, task, "invalid %s: %v", key, err)
+		return
+	}
+	for _, ref := range e.Tasks() {
+		if !v.hasTask(ref) {
+			v.add(n, task, "%s references unknown task '%s'", key, ref)
+		} else if !v.isAncestor(task, ref) {
+			v.add(n, task, "%s references task '%s', which is not an upstream dependency", key, ref)
+		}
+	}
+	// A failure upstream marks this task upstream_failed before its
+	// conditions are evaluated, unless the failed task allows failure.
+	for _, ref := range e.Calls("failed") {
+		if t, ok := v.p.Tasks[ref]; ok && !t.AllowFailure && v.isAncestor(task, ref) {
+			v.add(n, task, "%s uses failed('%s'), which is never true: '%s' failing stops this task unless '%s' has allow_failure: true", key, ref, ref, ref)
+		}
+	}
+}
+
+func (v *validator) checkParam(spec ParamSpec, n *yaml.Node, task string) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	// A placeholder can stand in for any scalar; its value is only known at
+	// run time.
+	templated := n.Kind == yaml.ScalarNode && n.Tag == "!!str" && placeholderRE.MatchString(n.Value)
+
+	var ok bool
+	switch spec.Type {
+	case ParamString:
+		ok = n.Kind == yaml.ScalarNode && n.Tag != "!!null"
+	case ParamInt:
+		ok = templated || (n.Kind == yaml.ScalarNode && n.Tag == "!!int")
+	case ParamBool:
+		ok = templated || (n.Kind == yaml.ScalarNode && n.Tag == "!!bool")
+	case ParamDuration:
+		ok = n.Kind == yaml.ScalarNode && n.Tag == "!!str"
+		if ok && !templated {
+			if _, err := time.ParseDuration(n.Value); err != nil {
+				v.add(n, task, "parameter '%s' must be a duration like 30s or 5m, got '%s'", spec.Name, n.Value)
+				return
+			}
+		}
+	case ParamList:
+		ok = n.Kind == yaml.SequenceNode
+	case ParamMap:
+		ok = n.Kind == yaml.MappingNode
+	default:
+		ok = true
+	}
+	if !ok {
+		v.add(n, task, "parameter '%s' must be a %s", spec.Name, spec.Type)
+		return
+	}
+
+	if len(spec.Allowed) > 0 && n.Kind == yaml.ScalarNode && !templated && !spec.Allows(n.Value) {
+		v.add(n, task, "parameter '%s' must be one of %s, got '%s'", spec.Name, strings.Join(spec.Allowed, ", "), n.Value)
+	}
+}
+
+// checkPlaceholders walks every string under n and checks that each ${...}
+// reference uses a known namespace and points at a task or deployment that
+// exists.
+func (v *validator) checkPlaceholders(n *yaml.Node, task string) {
+	v.checkRefs(n, task, task)
+}
+
+// checkRefs is checkPlaceholders for references made by node, which is a
+// task or deployment, reporting errors under task.
+func (v *validator) checkRefs(n *yaml.Node, task string, node string) {
+	switch n.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			v.checkRefs(c, task, node)
+		}
+		return
+	case yaml.ScalarNode:
+	default:
+		return
+	}
+
+	if strings.Count(n.Value, "${") != len(placeholderRE.FindAllString(n.Value, -1)) {
+		v.add(n, task, "unterminated placeholder in %s", strconv.Quote(n.Value))
+	}
+
+	for _, m := range placeholderRE.FindAllStringSubmatch(n.Value, -1) {
+		ph, err := ParsePlaceholder(m[0])
+		if err != nil {
+			v.add(n, task, "%v", err)
+			continue
+		}
+		ns, rest := ph.Namespace, ph.Key
+		if !placeholderNamespaces[ns] {
+			v.add(n, task, "unknown placeholder namespace '%s' in '%s'", ns, m[0])
+			continue
+		}
+
+		switch ns {
+		case "context":
+			target, key, ok := strings.Cut(rest, ".")
+			if !ok || key == "" {
+				v.add(n, task, "invalid placeholder '%s', expected ${context:task.key}", m[0])
+			} else if !v.hasTask(target) {
+				v.add(n, task, "placeholder '%s' references unknown task '%s'", m[0], target)
+			} else if !v.isAncestor(node, target) {
+				v.add(n, task, "placeholder '%s' references task '%s', which is not an upstream dependency", m[0], target)
+			} else if _, err := ParseOutputPath(key); err != nil {
+				v.add(n, task, "placeholder '%s': %v", m[0], err)
+			}
+		case "infra":
+			target, key, ok := strings.Cut(rest, ".")
+			if !ok || key == "" {
+				v.add(n, task, "invalid placeholder '%s', expected ${infra:deployment.output}", m[0])
+			} else if _, exists := v.p.Infrastructure[target]; !exists {
+				v.add(n, task, "placeholder '%s' references unknown deployment '%s'", m[0], target)
+			} else if _, err := ParseOutputPath(key); err != nil {
+				v.add(n, task, "placeholder '%s': %v", m[0], err)
+			}
+		case "tfstate":
+			if _, err := ParseStateAddress(rest); err != nil {
+				v.add(n, task, "invalid placeholder '%s': %v", m[0], err)
+			} else if len(v.p.terraformDeployments(node)) == 0 {
+				v.add(n, task, "placeholder '%s' needs a terraform deployment to read state from", m[0])
+			}
+		}
+	}
+}
+
+// checkCycles reports tasks and deployments that wait on each other, which
+// would leave them never starting.
+func (v *validator) checkCycles(at *yaml.Node) {
+	g, err := BuildGraph(v.p)
+	if err != nil {
+		v.add(at, "", "%v", err)
+		return
+	}
+	levels, _ := g.Levels()
+	scheduled := map[string]bool{}
+	for _, level := range levels {
+		for _, name := range level {
+			scheduled[name] = true
+		}
+	}
+	stuck := []string{}
+	for name := range g.InDeg {
+		if !scheduled[name] {
+			stuck = append(stuck, name)
+		}
+	}
+	if len(stuck) > 0 {
+		sort.Strings(stuck)
+		v.add(at, "", "dependency cycle: %s can never start", strings.Join(stuck, ", "))
+	}
+}
+
+func (v *validator) hasTask(name string) bool {
+	_, ok := v.p.Tasks[name]
+	return ok
+}
+
+// hasNode reports whether name is a task or a deployment.
+func (v *validator) hasNode(name string) bool {
+	_, ok := v.p.Infrastructure[name]
+	return ok || v.hasTask(name)
+}
+
+// isAncestor reports whether target is reachable through task's dependencies,
+// which is the only way its outputs are guaranteed to exist when task runs.
+// task may also name a deployment.
+func (v *validator) isAncestor(task, target string) bool {
+	seen := map[string]bool{}
+	stack := v.p.Upstream(task)
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if name == target {
+			return true
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		stack = append(stack, v.p.Upstream(name)...)
+	}
+	return false
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
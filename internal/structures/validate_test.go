@@ -0,0 +1,269 @@
+package structures
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/AlexSTJO/flume/internal/logging"
+)
+
+// stubService accepts a required url and an optional count.
+type stubService struct{}
+
+func (stubService) Name() string {
+	return "stub"
+}
+
+func (stubService) Parameters() []ParamSpec {
+	return []ParamSpec{
+		{Name: "url", Type: ParamString, Required: true},
+		{Name: "count", Type: ParamInt, Default: 1},
+	}
+}
+
+func (stubService) Run(c context.Context, t Task, n string, ctx *Context, infra_outputs *map[string]map[string]string, l *logging.Config, r *RunInfo) error {
+	return nil
+}
+
+func init() {
+	Registry["stub"] = stubService{}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		errs []string
+	}{
+		{
+			name: "valid",
+			yaml: `
+name: web
+tasks:
+  build:
+    service: stub
+    parameters:
+      url: https://example.com
+  cleanup:
+    service: stub
+    dependencies: [build, lint]
+    run_if: failed(lint)
+    parameters:
+      url: https://example.com
+  lint:
+    service: stub
+    allow_failure: true
+    parameters:
+      url: https://example.com
+`,
+		},
+		{
+			name: "unknown keys",
+			yaml: `
+name: web
+timeout: 5m
+tasks:
+  build:
+    service: stub
+    depends_on: [lint]
+    retry:
+      max_attempts: 2
+      backoff: 1s
+    parameters:
+      url: https://example.com
+      verbose: true
+`,
+			errs: []string{
+				"3:1: unknown pipeline key 'timeout'",
+				"7:5: task 'build': unknown task key 'depends_on'",
+				"10:7: task 'build': unknown retry key 'backoff'",
+				"13:7: task 'build': unknown parameter 'verbose' for service 'stub'",
+			},
+		},
+		{
+			name: "parameters",
+			yaml: `
+name: web
+tasks:
+  build:
+    service: stub
+    parameters:
+      count: many
+  deploy:
+    service: rocket
+  test:
+    parameters:
+      url: https://example.com
+`,
+			errs: []string{
+				"7:7: task 'build': missing required parameter 'url' for service 'stub'",
+				"7:14: task 'build': parameter 'count' must be a int",
+				"9:14: task 'deploy': unknown service 'rocket'",
+				"11:5: task 'test': missing service",
+			},
+		},
+		{
+			name: "dependencies",
+			yaml: `
+name: web
+tasks:
+  build:
+    service: stub
+    dependencies: [build, compile]
+    parameters:
+      url: https://example.com
+`,
+			errs: []string{
+				"6:20: task 'build': task depends on itself",
+				"6:27: task 'build': unknown dependency 'compile'",
+			},
+		},
+		{
+			name: "cycle",
+			yaml: `
+name: web
+tasks:
+  build:
+    service: stub
+    dependencies: [test]
+    parameters:
+      url: https://example.com
+  test:
+    service: stub
+    dependencies: [build]
+    parameters:
+      url: https://example.com
+  lint:
+    service: stub
+    parameters:
+      url: https://example.com
+`,
+			errs: []string{"4:3: dependency cycle: build, test can never start"},
+		},
+		{
+			name: "condition on a task that is not upstream",
+			yaml: `
+name: web
+tasks:
+  build:
+    service: stub
+    parameters:
+      url: https://example.com
+  lint:
+    service: stub
+    run_if: success(build) && success(deploy)
+    parameters:
+      url: https://example.com
+`,
+			errs: []string{
+				"10:13: task 'lint': run_if references task 'build', which is not an upstream dependency",
+				"10:13: task 'lint': run_if references unknown task 'deploy'",
+			},
+		},
+		{
+			name: "references",
+			yaml: `
+name: web
+infrastructure:
+  network:
+    service: terraform
+    action: plan
+    repo: octo/infra
+tasks:
+  api:
+    service: stub
+    parameters:
+      url: https://example.com
+  deploy:
+    service: stub
+    dependencies: [api]
+    parameters:
+      url: ${context:api.json.items[0].url}/${context:api.json.next?}
+      count: ${infra:network.count}
+  notify:
+    service: stub
+    parameters:
+      url: ${context:api.url?}
+  report:
+    service: stub
+    dependencies: [api]
+    parameters:
+      url: ${context:api}/${context:build.url}/${infra:cluster.url?}/${vault:token}
+`,
+			// ? only makes a missing value optional; the task still has to
+			// be upstream for its outputs to exist.
+			errs: []string{
+				"22:12: task 'notify': placeholder '${context:api.url?}' references task 'api', which is not an upstream dependency",
+				"27:12: task 'report': invalid placeholder '${context:api}', expected ${context:task.key}",
+				"27:12: task 'report': placeholder '${context:build.url}' references unknown task 'build'",
+				"27:12: task 'report': placeholder '${infra:cluster.url?}' references unknown deployment 'cluster'",
+				"27:12: task 'report': unknown placeholder namespace 'vault' in '${vault:token}'",
+			},
+		},
+		{
+			name: "failed without allow_failure",
+			yaml: `
+name: web
+tasks:
+  build:
+    service: stub
+    parameters:
+      url: https://example.com
+  notify:
+    service: stub
+    dependencies: [build]
+    run_if: failed(build)
+    parameters:
+      url: https://example.com
+`,
+			errs: []string{"11:13: task 'notify': run_if uses failed('build'), which is never true: 'build' failing stops this task unless 'build' has allow_failure: true"},
+		},
+		{
+			name: "failed in skip_if of an indirect dependent",
+			yaml: `
+name: web
+tasks:
+  build:
+    service: stub
+    parameters:
+      url: https://example.com
+  test:
+    service: stub
+    dependencies: [build]
+    parameters:
+      url: https://example.com
+  deploy:
+    service: stub
+    dependencies: [test]
+    skip_if: "!failed(build)"
+    parameters:
+      url: https://example.com
+`,
+			errs: []string{"16:14: task 'deploy': skip_if uses failed('build'), which is never true: 'build' failing stops this task unless 'build' has allow_failure: true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("Parse: %v", err)
+				}
+				return
+			}
+			var verrs ValidationErrors
+			if !errors.As(err, &verrs) {
+				t.Fatalf("Parse error = %v, want validation errors", err)
+			}
+			got := make([]string, len(verrs))
+			for i, e := range verrs {
+				got[i] = e.Error()
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.errs, "\n") {
+				t.Errorf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.errs, "\n"))
+			}
+		})
+	}
+}
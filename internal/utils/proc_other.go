@@ -0,0 +1,11 @@
+//go:build !unix
+
+package utils
+
+import (
+	"os/exec"
+)
+
+// KillProcessGroup falls back to exec's default of killing only the direct
+// child on platforms without process groups.
+func KillProcessGroup(cmd *exec.Cmd) {}
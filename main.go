@@ -1,14 +1,14 @@
 package main
 
 import (
-	"github.com/AlexSTJO/flume/internal/server"
+	"os"
+
+	"github.com/AlexSTJO/flume/internal/cli"
 	"github.com/AlexSTJO/flume/internal/services"
 )
 
 func main() {
 	var shell services.ShellService
 	_ = shell.Name()
-	if err := server.CreateServer(); err != nil {
-		panic(err)
-	}
+	os.Exit(cli.Main(os.Args[1:]))
 }